@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/calendarbackend"
+	"gomodules.avm99963.com/zenithplanner/internal/sync"
+)
+
+// runCorrect implements the "correct" command.
+func runCorrect(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("correct", flag.ContinueOnError)
+	from := fs.String("from", "", "First date to correct (YYYY-MM-DD)")
+	to := fs.String("to", "", "Last date to correct (YYYY-MM-DD, defaults to -from)")
+	location := fs.String("location", "", "Location code to set (e.g. V)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *location == "" {
+		return fmt.Errorf("-from and -location are required")
+	}
+	first, last, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := sync.LoadCatalog(a.cfg.App)
+	if err != nil {
+		return fmt.Errorf("failed to load location catalog: %w", err)
+	}
+	provider, err := calendarbackend.NewProvider(ctx, a.cfg)
+	if err != nil {
+		return err
+	}
+	provider = calendar.NewRateLimitedProvider(provider, calendar.NewExecutor(a.cfg.CalendarAPI))
+	syncer := sync.NewSyncer(a.dbRepo, provider, a.cfg, catalog)
+
+	corrected, err := syncer.CorrectSchedule(ctx, first, last, *location)
+	for _, note := range corrected {
+		fmt.Println(note)
+	}
+	if err == nil && len(corrected) == 0 {
+		fmt.Println("Nothing to correct.")
+	}
+	return err
+}
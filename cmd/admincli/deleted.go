@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/calendarbackend"
+	"gomodules.avm99963.com/zenithplanner/internal/sync"
+)
+
+// runDeleted implements the "deleted" command.
+func runDeleted(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli deleted list [-limit N] | restore <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		return listDeletedEvents(ctx, a, args[1:])
+	case "restore":
+		return restoreDeletedEvent(ctx, a, args[1:])
+	default:
+		return fmt.Errorf("unknown deleted subcommand: %s", args[0])
+	}
+}
+
+func listDeletedEvents(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("deleted list", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "Maximum number of deleted events to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	deletedEvents, err := a.dbRepo.ListDeletedEvents(ctx, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDELETED AT\tDATE\tEVENT ID\tREASON\tSYNC RUN\tRESTORED AS")
+	for _, d := range deletedEvents {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID, d.DeletedAt.Format("2006-01-02 15:04:05"), d.Date.Format("2006-01-02"), d.EventID, d.Reason, d.SyncRunID, deref(d.RestoredEventID))
+	}
+	return w.Flush()
+}
+
+func restoreDeletedEvent(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admincli deleted restore <id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid deleted event ID %q", args[0])
+	}
+
+	catalog, err := sync.LoadCatalog(a.cfg.App)
+	if err != nil {
+		return fmt.Errorf("failed to load location catalog: %w", err)
+	}
+	provider, err := calendarbackend.NewProvider(ctx, a.cfg)
+	if err != nil {
+		return err
+	}
+	provider = calendar.NewRateLimitedProvider(provider, calendar.NewExecutor(a.cfg.CalendarAPI))
+	syncer := sync.NewSyncer(a.dbRepo, provider, a.cfg, catalog)
+
+	restored, err := syncer.RestoreDeletedEvent(ctx, id)
+	if restored != nil {
+		fmt.Printf("Restored deleted event %d as event %s (%s).\n", id, restored.Id, restored.Summary)
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/calendarbackend"
+	"gomodules.avm99963.com/zenithplanner/internal/sync"
+)
+
+// runHistory implements the "history" command.
+func runHistory(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli history list|revert -from <date> [-to <date>] [flags]")
+	}
+
+	switch args[0] {
+	case "list":
+		return listHistory(ctx, a, args[1:])
+	case "revert":
+		return revertHistory(ctx, a, args[1:])
+	default:
+		return fmt.Errorf("unknown history subcommand: %s", args[0])
+	}
+}
+
+func listHistory(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("history list", flag.ContinueOnError)
+	from := fs.String("from", "", "First date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Last date (YYYY-MM-DD, defaults to -from)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return fmt.Errorf("-from is required")
+	}
+	first, last, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	history, err := a.dbRepo.GetScheduleEntryHistory(ctx, first, last)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANGED AT\tDATE\tOLD\tNEW\tTRIGGER\tEVENT ID\tSYNC RUN")
+	for _, c := range history {
+		old := "<none>"
+		if c.OldLocationCode != nil {
+			old = fmt.Sprintf("%s (%s)", *c.OldLocationCode, deref(c.OldStatus))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s (%s)\t%s\t%s\t%s\n",
+			c.ChangedAt.In(a.cfg.App.Timezone).Format("2006-01-02 15:04:05"), c.Date.Format("2006-01-02"), old, c.NewLocationCode, c.NewStatus, c.Trigger, deref(c.EventID), c.SyncRunID)
+	}
+	return w.Flush()
+}
+
+func revertHistory(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("history revert", flag.ContinueOnError)
+	from := fs.String("from", "", "First date to revert (YYYY-MM-DD)")
+	to := fs.String("to", "", "Last date to revert (YYYY-MM-DD, defaults to -from)")
+	at := fs.String("at", "", "Time whose locations are restored, including the changes made at that time (YYYY-MM-DD HH:MM[:SS] in the configured timezone, as shown by history list)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *at == "" {
+		return fmt.Errorf("-from and -at are required")
+	}
+	first, last, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	revertTime, err := parseTime(*at, a.cfg.App.Timezone)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := sync.LoadCatalog(a.cfg.App)
+	if err != nil {
+		return fmt.Errorf("failed to load location catalog: %w", err)
+	}
+	provider, err := calendarbackend.NewProvider(ctx, a.cfg)
+	if err != nil {
+		return err
+	}
+	provider = calendar.NewRateLimitedProvider(provider, calendar.NewExecutor(a.cfg.CalendarAPI))
+	syncer := sync.NewSyncer(a.dbRepo, provider, a.cfg, catalog)
+
+	reverted, err := syncer.RevertSchedule(ctx, first, last, revertTime)
+	for _, note := range reverted {
+		fmt.Println(note)
+	}
+	if err == nil && len(reverted) == 0 {
+		fmt.Println("Nothing to revert.")
+	}
+	return err
+}
+
+// parseTime parses the value of the -at flag. The time is interpreted in
+// loc, and the seconds are optional. It returns the end of the given second
+// (or minute), so the changes shown by "history list" with that time are
+// included.
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	for layout, precision := range map[string]time.Duration{"2006-01-02 15:04:05": time.Second, "2006-01-02 15:04": time.Minute} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.Add(precision - time.Nanosecond), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -at time %q (the format is YYYY-MM-DD HH:MM[:SS])", value)
+}
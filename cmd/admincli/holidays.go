@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"gomodules.avm99963.com/zenithplanner/internal/holidays"
+)
+
+// runHolidays implements the "holidays" command.
+func runHolidays(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 || args[0] != "import" {
+		return fmt.Errorf("usage: admincli holidays import [-dry-run]")
+	}
+
+	fs := flag.NewFlagSet("holidays import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Show the changes without saving them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	files := a.cfg.App.Holidays.ICSFiles
+	if len(files) == 0 {
+		return fmt.Errorf("no holiday files configured (set HOLIDAY_ICS_FILES)")
+	}
+
+	var diff *holidays.Diff
+	if *dryRun {
+		newHolidays, err := holidays.LoadFiles(files)
+		if err != nil {
+			return err
+		}
+		oldHolidays, err := a.dbRepo.ListHolidays(ctx)
+		if err != nil {
+			return err
+		}
+		diff = holidays.ComputeDiff(oldHolidays, newHolidays)
+	} else {
+		var err error
+		diff, err = holidays.Import(ctx, a.dbRepo, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	if diff.IsEmpty() {
+		fmt.Println("Holidays are up to date.")
+		return nil
+	}
+	for _, line := range diff.Lines() {
+		fmt.Println(line)
+	}
+	if *dryRun {
+		fmt.Println("Dry run: no changes were saved.")
+	} else {
+		fmt.Println("Holidays imported. Calendar events will be updated by the next horizon maintenance or full sync.")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// runJobs implements the "jobs" command.
+func runJobs(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli jobs list [-status S] [-limit N] | requeue <id> | enqueue incremental|full|reconcile_range [-from <date>] [-to <date>]")
+	}
+
+	switch args[0] {
+	case "list":
+		return listJobs(ctx, a, args[1:])
+	case "requeue":
+		return requeueJob(ctx, a, args[1:])
+	case "enqueue":
+		return enqueueJob(ctx, a, args[1:])
+	default:
+		return fmt.Errorf("unknown jobs subcommand: %s", args[0])
+	}
+}
+
+func listJobs(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("jobs list", flag.ContinueOnError)
+	status := fs.String("status", "", "Only show the jobs with this status (pending, running, done or dead)")
+	limit := fs.Int("limit", 50, "Maximum number of jobs to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	jobs, err := a.dbRepo.ListSyncJobs(ctx, *status, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED AT\tKIND\tRANGE\tSTATUS\tATTEMPTS\tNEXT RUN AT\tLAST ERROR")
+	for _, j := range jobs {
+		dateRange := ""
+		if j.RangeStart != nil && j.RangeEnd != nil {
+			dateRange = j.RangeStart.Format("2006-01-02") + " → " + j.RangeEnd.Format("2006-01-02")
+		}
+		nextRun := ""
+		if j.Status == database.SyncJobPending {
+			nextRun = j.NextRunAt.In(a.cfg.App.Timezone).Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			j.ID, j.CreatedAt.In(a.cfg.App.Timezone).Format("2006-01-02 15:04:05"), j.Kind, dateRange, j.Status, j.Attempts, nextRun, deref(j.LastError))
+	}
+	return w.Flush()
+}
+
+func requeueJob(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admincli jobs requeue <id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job ID %q", args[0])
+	}
+	if err := a.dbRepo.RequeueSyncJob(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("Requeued job %d. The backend will run it shortly.\n", id)
+	return nil
+}
+
+func enqueueJob(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli jobs enqueue incremental|full|reconcile_range [-from <date>] [-to <date>]")
+	}
+	job := database.SyncJob{Kind: args[0]}
+
+	fs := flag.NewFlagSet("jobs enqueue", flag.ContinueOnError)
+	from := fs.String("from", "", "First date to reconcile (YYYY-MM-DD, only for reconcile_range)")
+	to := fs.String("to", "", "Last date to reconcile (YYYY-MM-DD, defaults to -from)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch job.Kind {
+	case database.SyncJobIncremental, database.SyncJobFull:
+		if *from != "" || *to != "" {
+			return fmt.Errorf("-from and -to are only valid for %s jobs", database.SyncJobReconcileRange)
+		}
+	case database.SyncJobReconcileRange:
+		if *from == "" {
+			return fmt.Errorf("-from is required")
+		}
+		first, last, err := parseDateRange(*from, *to)
+		if err != nil {
+			return err
+		}
+		job.RangeStart, job.RangeEnd = &first, &last
+	default:
+		return fmt.Errorf("unknown job kind %q (valid kinds are %s, %s and %s)", job.Kind, database.SyncJobIncremental, database.SyncJobFull, database.SyncJobReconcileRange)
+	}
+
+	if err := a.dbRepo.EnqueueSyncJob(ctx, job); err != nil {
+		return err
+	}
+	fmt.Printf("Queued a %s job. The backend will run it shortly.\n", job.Kind)
+	return nil
+}
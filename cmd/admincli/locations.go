@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// runLocations implements the "locations" command.
+func runLocations(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli locations list|set <code> [flags]")
+	}
+
+	switch args[0] {
+	case "list":
+		return listLocations(ctx, a)
+	case "set":
+		return setLocation(ctx, a, args[1:])
+	default:
+		return fmt.Errorf("unknown locations subcommand: %s", args[0])
+	}
+}
+
+func listLocations(ctx context.Context, a *app) error {
+	locations, err := a.dbRepo.ListLocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tDISPLAY NAME\tCATEGORY\tADDRESS\tCOORDINATES\tACTIVE")
+	for _, l := range locations {
+		coordinates := ""
+		if l.Latitude != nil && l.Longitude != nil {
+			coordinates = fmt.Sprintf("%f,%f", *l.Latitude, *l.Longitude)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n",
+			l.Code, deref(l.DisplayName), deref(l.Category), deref(l.Address), coordinates, l.Active)
+	}
+	return w.Flush()
+}
+
+func setLocation(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli locations set <code> [flags]")
+	}
+	code := args[0]
+
+	fs := flag.NewFlagSet("locations set", flag.ContinueOnError)
+	displayName := fs.String("display-name", "", "Human-friendly name (empty to clear)")
+	category := fs.String("category", "", "Grouping category (empty to clear)")
+	address := fs.String("address", "", "Postal address (empty to clear)")
+	latitude := fs.String("lat", "", "Latitude (empty to clear)")
+	longitude := fs.String("lon", "", "Longitude (empty to clear)")
+	active := fs.Bool("active", true, "Whether the location is still in use")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	location, err := a.dbRepo.GetLocation(ctx, code)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		return fmt.Errorf("location %s not found (locations are registered automatically once they appear in the calendar)", code)
+	}
+
+	// Only override the fields which were explicitly passed.
+	var visitErr error
+	fs.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "display-name":
+			location.DisplayName = optionalString(*displayName)
+		case "category":
+			location.Category = optionalString(*category)
+		case "address":
+			location.Address = optionalString(*address)
+		case "lat":
+			location.Latitude, err = optionalFloat(*latitude)
+		case "lon":
+			location.Longitude, err = optionalFloat(*longitude)
+		case "active":
+			location.Active = *active
+		}
+		if err != nil && visitErr == nil {
+			visitErr = fmt.Errorf("invalid value for -%s: %w", f.Name, err)
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	if err := a.dbRepo.UpdateLocation(ctx, *location); err != nil {
+		return err
+	}
+	fmt.Printf("Location %s updated.\n", code)
+	return nil
+}
+
+// deref returns the value of a string pointer, or "" if nil.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// optionalString returns nil for an empty string and a pointer to it
+// otherwise.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalFloat parses a float, returning nil for an empty string.
+func optionalFloat(s string) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// app holds the dependencies shared by all the commands.
+type app struct {
+	cfg    *config.Config
+	dbRepo *database.Repository
+}
+
+// command is a subcommand of the admin CLI.
+type command struct {
+	description string
+	run         func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"correct": {
+		description: "Set the location of dates, even if they are frozen",
+		run:         runCorrect,
+	},
+	"deleted": {
+		description: "List the events deleted by ZenithPlanner or restore one",
+		run:         runDeleted,
+	},
+	"holidays": {
+		description: "Re-import the holiday .ics files and show what changed",
+		run:         runHolidays,
+	},
+	"history": {
+		description: "List the changes of dates or revert them to an earlier location",
+		run:         runHistory,
+	},
+	"jobs": {
+		description: "List the sync jobs, requeue failed ones or queue new ones",
+		run:         runJobs,
+	},
+	"locations": {
+		description: "List locations or edit their display metadata",
+		run:         runLocations,
+	},
+	"outbox": {
+		description: "List the calendar mutations of the outbox or requeue dead ones",
+		run:         runOutbox,
+	},
+	"plan": {
+		description: "Show what reconciliation would do, without changing anything",
+		run:         runPlan,
+	},
+	"rejections": {
+		description: "List event titles rejected by strict validation",
+		run:         runRejections,
+	},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	a, err := newApp(ctx)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer a.dbRepo.Close()
+
+	if err := cmd.run(ctx, a, os.Args[2:]); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// newApp loads the configuration (the same one used by the backend) and
+// connects to the database.
+func newApp(ctx context.Context) (*app, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	dbPool, err := database.NewDBPool(ctx, cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &app{
+		cfg:    cfg,
+		dbRepo: database.NewRepository(dbPool),
+	}, nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: admincli <command> [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].description)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// runOutbox implements the "outbox" command.
+func runOutbox(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: admincli outbox list [-status S] [-limit N] | requeue <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		return listOutbox(ctx, a, args[1:])
+	case "requeue":
+		return requeueOutboxItem(ctx, a, args[1:])
+	default:
+		return fmt.Errorf("unknown outbox subcommand: %s", args[0])
+	}
+}
+
+func listOutbox(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("outbox list", flag.ContinueOnError)
+	status := fs.String("status", "", "Only show the mutations with this status (pending, done or dead)")
+	limit := fs.Int("limit", 50, "Maximum number of mutations to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	items, err := a.dbRepo.ListOutboxItems(ctx, *status, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED AT\tDATE\tOPERATION\tEVENT ID\tSTATUS\tATTEMPTS\tNEXT ATTEMPT AT\tLAST ERROR")
+	for _, item := range items {
+		nextAttempt := ""
+		if item.Status() == database.OutboxPending {
+			nextAttempt = item.NextAttemptAt.In(a.cfg.App.Timezone).Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			item.ID, item.CreatedAt.In(a.cfg.App.Timezone).Format("2006-01-02 15:04:05"), item.Date.Format("2006-01-02"),
+			item.Operation, item.EventID, item.Status(), item.Attempts, nextAttempt, deref(item.LastError))
+	}
+	return w.Flush()
+}
+
+func requeueOutboxItem(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admincli outbox requeue <id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid outbox item ID %q", args[0])
+	}
+	if err := a.dbRepo.RequeueOutboxItem(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("Requeued outbox item %d. The backend will execute it within a minute.\n", id)
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/sync"
+)
+
+// runPlan implements the "plan" command.
+func runPlan(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	format := fs.String("format", "table", "Output format: table or json")
+	from := fs.String("from", "", "First date to plan (YYYY-MM-DD, defaults to the start of the sync window)")
+	to := fs.String("to", "", "Last date to plan (YYYY-MM-DD, defaults to -from or the end of the sync window)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q (valid formats are table and json)", *format)
+	}
+
+	dates, err := planDates(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := sync.LoadCatalog(a.cfg.App)
+	if err != nil {
+		return fmt.Errorf("failed to load location catalog: %w", err)
+	}
+	// The plan is computed from the event cache, so the syncer doesn't
+	// need a calendar.
+	syncer := sync.NewSyncer(a.dbRepo, nil, a.cfg, catalog)
+	plan, err := syncer.PlanReconciliation(ctx, dates)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+	return printPlan(plan)
+}
+
+// planDates returns the dates from the -from and -to flags, or nil (the
+// sync window) if they are empty.
+func planDates(from, to string) ([]time.Time, error) {
+	if from == "" {
+		if to != "" {
+			return nil, fmt.Errorf("-to requires -from")
+		}
+		return nil, nil
+	}
+	first, last, err := parseDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var dates []time.Time
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		dates = append(dates, date)
+	}
+	return dates, nil
+}
+
+// parseDateRange parses the values of the -from and -to flags. -to defaults
+// to -from.
+func parseDateRange(from, to string) (first, last time.Time, err error) {
+	if to == "" {
+		to = from
+	}
+	first, err = time.Parse("2006-01-02", from)
+	if err != nil {
+		return first, last, fmt.Errorf("invalid -from date: %w", err)
+	}
+	last, err = time.Parse("2006-01-02", to)
+	if err != nil {
+		return first, last, fmt.Errorf("invalid -to date: %w", err)
+	}
+	if last.Before(first) {
+		return first, last, fmt.Errorf("-to is before -from")
+	}
+	return first, last, nil
+}
+
+func printPlan(plan *sync.ReconciliationPlan) error {
+	if plan.NumActions() == 0 {
+		fmt.Printf("Nothing to do for %d dates.\n", len(plan.Dates))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tACTION\tEVENT ID\tDETAILS")
+	var notes []string
+	for _, datePlan := range plan.Dates {
+		for _, action := range datePlan.Actions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", datePlan.Date, action.Kind, action.EventID, action.Details)
+		}
+		if datePlan.LocationChange != "" {
+			notes = append(notes, fmt.Sprintf("%s: %s", datePlan.Date, datePlan.LocationChange))
+		}
+		notes = append(notes, datePlan.Notes...)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(notes) > 0 {
+		fmt.Println("\nThe confirmation email would include:")
+		for _, note := range notes {
+			fmt.Printf("  %s\n", note)
+		}
+	}
+	fmt.Printf("\nDry run: %d actions planned, nothing was changed.\n", plan.NumActions())
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runRejections implements the "rejections" command.
+func runRejections(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 || args[0] != "list" {
+		return fmt.Errorf("usage: admincli rejections list [-limit N]")
+	}
+
+	fs := flag.NewFlagSet("rejections list", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "Maximum number of rejections to show")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	rejectedTitles, err := a.dbRepo.ListRejectedTitles(ctx, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REJECTED AT\tDATE\tTITLE\tACTION\tKEPT LOCATION\tEVENT ID")
+	for _, r := range rejectedTitles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.RejectedAt.Format("2006-01-02 15:04:05"), r.Date.Format("2006-01-02"), r.Title, r.Action, deref(r.RestoredLocationCode), r.EventID)
+	}
+	return w.Flush()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -10,14 +11,19 @@ import (
 	"time"
 
 	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/calendarbackend"
 	"gomodules.avm99963.com/zenithplanner/internal/config"
 	"gomodules.avm99963.com/zenithplanner/internal/database"
 	"gomodules.avm99963.com/zenithplanner/internal/handler"
+	"gomodules.avm99963.com/zenithplanner/internal/holidays"
 	"gomodules.avm99963.com/zenithplanner/internal/scheduler"
 	"gomodules.avm99963.com/zenithplanner/internal/sync"
 )
 
 func main() {
+	archiveSync := flag.Bool("archive-sync", false, "Fetch the whole history of the calendar in the initial sync, instead of only the full sync window")
+	flag.Parse()
+
 	log.Println("Starting ZenithPlanner Backend Service...")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -31,6 +37,7 @@ func main() {
 	}()
 
 	cfg := loadConfiguration()
+	catalog := loadLocationCatalog(cfg)
 
 	dbPool, err := database.NewDBPool(ctx, cfg.DB)
 	if err != nil {
@@ -40,27 +47,20 @@ func main() {
 	log.Println("Database connection pool initialized.")
 	dbRepo := database.NewRepository(dbPool)
 
-	calendarService, err := calendar.NewService(ctx, cfg.Google)
-	if err != nil {
-		log.Fatalf("Failed to create Calendar client: %v", err)
-	}
-	log.Println("Google Calendar client initialized.")
-
-	syncer := sync.NewSyncer(dbRepo, calendarService, cfg)
+	importHolidays(ctx, dbRepo, cfg)
 
-	if cfg.App.EnableCalendarSubscription {
-		err := syncer.EnsureWebhookChannelExists(ctx)
-		if err != nil {
-			log.Fatalf("Failed to ensure webhook channel exists on startup: %v", err)
-		}
-	}
+	calendarProvider := calendar.NewRateLimitedProvider(newCalendarProvider(ctx, cfg), calendar.NewExecutor(cfg.CalendarAPI))
+	syncer := sync.NewSyncer(dbRepo, calendarProvider, cfg, catalog)
 
-	runInitialSync(syncer)
+	runInitialSync(ctx, syncer, *archiveSync)
 
-	taskScheduler := scheduler.NewScheduler(syncer, &cfg.App)
+	// The scheduler also ensures the webhook channel exists once this
+	// instance becomes the leader.
+	taskScheduler := scheduler.NewScheduler(syncer, &cfg.App, dbRepo)
 	taskScheduler.Start()
 
 	syncer.StartSyncWorker(ctx)
+	syncer.StartOutboxWorker(ctx)
 
 	httpServer := startHttpServer(syncer, cfg)
 
@@ -95,10 +95,48 @@ func loadConfiguration() *config.Config {
 	return cfg
 }
 
-func runInitialSync(syncer *sync.Syncer) {
+func loadLocationCatalog(cfg *config.Config) *calendar.Catalog {
+	catalog, err := sync.LoadCatalog(cfg.App)
+	if err != nil {
+		log.Fatalf("Failed to load location catalog: %v", err)
+	}
+	log.Printf("Location catalog loaded with %d location types.\n", len(catalog.Locations))
+	return catalog
+}
+
+func newCalendarProvider(ctx context.Context, cfg *config.Config) calendar.CalendarProvider {
+	provider, err := calendarbackend.NewProvider(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create calendar provider: %v", err)
+	}
+	return provider
+}
+
+func importHolidays(ctx context.Context, dbRepo *database.Repository, cfg *config.Config) {
+	if len(cfg.App.Holidays.ICSFiles) == 0 {
+		return
+	}
+	diff, err := holidays.Import(ctx, dbRepo, cfg.App.Holidays.ICSFiles)
+	if err != nil {
+		log.Fatalf("Failed to import holidays: %v", err)
+	}
+	log.Printf("Holidays imported from %d files (%d added, %d removed, %d renamed).",
+		len(cfg.App.Holidays.ICSFiles), len(diff.Added), len(diff.Removed), len(diff.Renamed))
+}
+
+func runInitialSync(ctx context.Context, syncer *sync.Syncer, archive bool) {
 	go func() {
+		if archive {
+			log.Println("Running archive sync on startup...")
+			if err := syncer.RunArchiveSync(ctx); err != nil {
+				log.Printf("Error during archive sync: %v", err)
+			}
+			return
+		}
 		log.Println("Requesting initial sync on startup...")
-		syncer.RequestSync()
+		if err := syncer.RequestSync(ctx); err != nil {
+			log.Printf("Error requesting the initial sync: %v", err)
+		}
 	}()
 }
 
@@ -5,6 +5,72 @@ CREATE TABLE IF NOT EXISTS schedule_entries (
     status TEXT NOT NULL                    -- Status derived from code (e.g., 'Default', 'Vacation', 'Office', 'Library')
 );
 
+-- Stats attributes derived from the location catalog
+ALTER TABLE schedule_entries ADD COLUMN IF NOT EXISTS category TEXT;                                -- Stats category of the status (e.g., 'Remote', 'On-site')
+ALTER TABLE schedule_entries ADD COLUMN IF NOT EXISTS is_working_day BOOLEAN NOT NULL DEFAULT true; -- False if the status doesn't count as a working day (e.g., 'Vacation')
+
+-- Information written by the user in the event description
+ALTER TABLE schedule_entries ADD COLUMN IF NOT EXISTS note TEXT;                                    -- Free-form note (e.g., 'with team')
+ALTER TABLE schedule_entries ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}'::jsonb;      -- 'key: value' lines (e.g., {"desk": "14"})
+CREATE INDEX IF NOT EXISTS idx_schedule_entries_tags ON schedule_entries USING GIN (tags);
+
+-- Table to store the location of each half of a day. Days without a split
+-- title (e.g., 'HOM/LIB-CENTRAL') have the same location in both halves.
+CREATE TABLE IF NOT EXISTS schedule_entry_segments (
+    date DATE NOT NULL REFERENCES schedule_entries (date) ON DELETE CASCADE, -- The day this segment belongs to
+    half TEXT NOT NULL CHECK (half IN ('AM', 'PM')), -- Half of the day
+    location_code TEXT NOT NULL,            -- Location code of this half (e.g., 'HOM')
+    status TEXT NOT NULL,                   -- Status derived from the code of this half
+    category TEXT,                          -- Stats category of the status
+    is_working_day BOOLEAN NOT NULL DEFAULT true, -- False if the status doesn't count as a working day
+    PRIMARY KEY (date, half)
+);
+
+-- Backfill the segments of the entries stored before they existed (which
+-- can't be split), so they are counted by schedule_stats.
+INSERT INTO schedule_entry_segments (date, half, location_code, status, category, is_working_day)
+SELECT e.date, h.half, e.location_code, e.status, e.category, e.is_working_day
+FROM schedule_entries e CROSS JOIN (VALUES ('AM'), ('PM')) AS h (half)
+ON CONFLICT (date, half) DO NOTHING;
+
+-- View for stats, where each half day counts as 0.5 days.
+CREATE OR REPLACE VIEW schedule_stats AS
+SELECT date, half, location_code, status, category, is_working_day, 0.5 AS days
+FROM schedule_entry_segments;
+
+-- Append-only log of the changes of schedule_entries, to know when and why
+-- each day changed (and revert it)
+CREATE TABLE IF NOT EXISTS schedule_entry_history (
+    id BIGSERIAL PRIMARY KEY,
+    date DATE NOT NULL,
+    old_location_code TEXT,                 -- NULL if the date didn't have an entry
+    old_status TEXT,
+    new_location_code TEXT NOT NULL,
+    new_status TEXT NOT NULL,
+    trigger TEXT NOT NULL,                  -- e.g. 'incremental_sync', 'full_sync', 'horizon_maintenance', 'revert', 'correction'
+    event_id TEXT,                          -- Calendar event which holds the location (if any)
+    sync_run_id TEXT NOT NULL,              -- Sync run which made the change
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_entry_history_date ON schedule_entry_history (date, changed_at);
+
+CREATE OR REPLACE RULE schedule_entry_history_no_update AS ON UPDATE TO schedule_entry_history DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE schedule_entry_history_no_delete AS ON DELETE TO schedule_entry_history DO INSTEAD NOTHING;
+
+-- Reference table with display metadata for every location code seen in the
+-- calendar. Dashboards can join schedule_entries.location_code on it.
+CREATE TABLE IF NOT EXISTS locations (
+    code TEXT PRIMARY KEY,                  -- Location code as written in the event title (e.g., 'LIB-CENTRAL')
+    display_name TEXT,                      -- Human-friendly name (e.g., 'Central Library')
+    category TEXT,                          -- Grouping category (e.g., building or stats category)
+    address TEXT,                           -- Postal address
+    latitude DOUBLE PRECISION,              -- Coordinates of the location
+    longitude DOUBLE PRECISION,
+    active BOOLEAN NOT NULL DEFAULT true,   -- False if the location is no longer in use
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now() -- When the code was first registered
+);
+
 -- Table to cache relevant details fetched from Google Calendar events
 -- This acts as an intermediate store before reconciliation.
 CREATE TABLE IF NOT EXISTS calendar_event_cache (
@@ -20,12 +86,103 @@ CREATE TABLE IF NOT EXISTS calendar_event_cache (
     original_start_time TIMESTAMPTZ             -- Original start time (for recurring instances)
 );
 
+ALTER TABLE calendar_event_cache ADD COLUMN IF NOT EXISTS auto_default_code TEXT; -- Location code the event was auto-created with (NULL if created by the user)
+
 -- Add indexes for faster lookups on the cache table
 CREATE INDEX IF NOT EXISTS idx_calendar_event_cache_date ON calendar_event_cache (date);
 CREATE INDEX IF NOT EXISTS idx_calendar_event_cache_updated_ts ON calendar_event_cache (updated_ts);
 CREATE INDEX IF NOT EXISTS idx_calendar_event_cache_recurring_id ON calendar_event_cache (recurring_event_id);
 
 
+-- Table to store public holidays imported from .ics files
+CREATE TABLE IF NOT EXISTS holidays (
+    date DATE PRIMARY KEY,                  -- Date of the holiday
+    name TEXT NOT NULL,                     -- Name of the holiday (event summary)
+    source TEXT NOT NULL                    -- Path of the .ics file it was imported from
+);
+
+-- Conflicts between several schedule events of a date which were reported
+-- in a confirmation email and left in the calendar (with the keep-all
+-- conflict resolution policy), so they are only reported again if the
+-- conflicting events change
+CREATE TABLE IF NOT EXISTS reported_conflicts (
+    date DATE PRIMARY KEY,
+    event_ids TEXT NOT NULL,                -- Sorted IDs of the conflicting events, separated by commas
+    reported_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Table to record event titles rejected by strict validation, so they can be
+-- reviewed later
+CREATE TABLE IF NOT EXISTS rejected_titles (
+    id BIGSERIAL PRIMARY KEY,
+    date DATE NOT NULL,                     -- Date of the rejected event
+    event_id TEXT NOT NULL,                 -- Google Calendar event ID
+    title TEXT NOT NULL,                    -- Title which was rejected
+    action TEXT NOT NULL,                   -- Action taken ('revert', 'mark' or 'ignore')
+    restored_location_code TEXT,            -- Location code kept in schedule_entries
+    rejected_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Outbox of the calendar mutations decided during reconciliation. They are
+-- recorded in the same transaction as the DB changes, and executed (and
+-- retried) afterwards by a worker.
+CREATE TABLE IF NOT EXISTS calendar_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    idempotency_key TEXT NOT NULL,          -- Identifies the mutation, so pending duplicates aren't recorded
+    operation TEXT NOT NULL,                -- 'insert', 'patch' or 'delete'
+    event_id TEXT NOT NULL,                 -- Event to modify (or ID of the event to insert)
+    payload JSONB NOT NULL DEFAULT '{}'::jsonb, -- Event or patch to send
+    date DATE NOT NULL,                     -- Date which was being reconciled
+    attempts INTEGER NOT NULL DEFAULT 0,    -- Number of failed attempts
+    last_error TEXT,                        -- Error of the last failed attempt
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    done_at TIMESTAMPTZ                     -- When the mutation was executed (NULL if pending)
+);
+
+ALTER TABLE calendar_outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ; -- When the mutation was given up, since it failed too many times or can't succeed (NULL if it wasn't)
+
+-- Dead mutations don't prevent recording the same mutation again
+DROP INDEX IF EXISTS idx_calendar_outbox_pending_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_outbox_queued_key ON calendar_outbox (idempotency_key) WHERE done_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_calendar_outbox_due ON calendar_outbox (next_attempt_at) WHERE done_at IS NULL;
+
+-- Queue of the syncs to run (requested by webhooks, polling, scheduled tasks
+-- or the admin CLI), which survives restarts and retries the failed ones
+CREATE TABLE IF NOT EXISTS sync_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,                     -- 'incremental', 'full' or 'reconcile_range'
+    range_start DATE,                       -- First date to reconcile (only 'reconcile_range')
+    range_end DATE,                         -- Last date to reconcile (only 'reconcile_range')
+    dedup_key TEXT NOT NULL,                -- Identifies the work, so queued duplicates aren't recorded
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'done' or 'dead' (failed too many times)
+    attempts INTEGER NOT NULL DEFAULT 0,    -- Number of failed attempts
+    last_error TEXT,                        -- Error of the last failed attempt
+    next_run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_jobs_queued_key ON sync_jobs (dedup_key) WHERE status = 'pending' AND attempts = 0;
+CREATE INDEX IF NOT EXISTS idx_sync_jobs_due ON sync_jobs (next_run_at) WHERE status = 'pending';
+
+-- Snapshots of the events deleted by ZenithPlanner (e.g. duplicates), so
+-- they can be restored if the wrong one was deleted
+CREATE TABLE IF NOT EXISTS deleted_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT NOT NULL,                 -- ID of the deleted event
+    date DATE NOT NULL,                     -- Date the event was deleted from
+    event JSONB NOT NULL,                   -- Full event, as returned by the calendar
+    reason TEXT NOT NULL,                   -- Why the event was deleted
+    sync_run_id TEXT NOT NULL,              -- Sync run which decided the deletion
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    restored_at TIMESTAMPTZ,                -- When the snapshot was restored (NULL if it wasn't)
+    restored_event_id TEXT                  -- ID of the event created by the restoration
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deleted_events_run_event ON deleted_events (sync_run_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_deleted_events_date ON deleted_events (date);
+
 -- Table to store synchronization state (e.g., sync token, webhook channel info)
 CREATE TABLE IF NOT EXISTS sync_state (
     key TEXT PRIMARY KEY,   -- e.g., 'syncToken', 'channelId', 'resourceId', 'channelExpiration'
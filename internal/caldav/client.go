@@ -0,0 +1,179 @@
+// Package caldav implements a calendar.CalendarProvider backed by a CalDAV
+// calendar collection (e.g. in Nextcloud or Radicale).
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// client performs the WebDAV requests to a calendar collection.
+type client struct {
+	httpClient    *http.Client
+	collectionURL *url.URL
+	username      string
+	password      string
+}
+
+// multistatus is the body of a 207 Multi-Status response.
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+	SyncToken string     `xml:"DAV: sync-token"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Status    string     `xml:"DAV: status"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ETag         string `xml:"DAV: getetag"`
+		CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	} `xml:"DAV: prop"`
+}
+
+// statusCode returns the HTTP status code of a "HTTP/1.1 200 OK" status
+// line, or 0 if it can't be parsed.
+func statusCode(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return 0
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// resolve returns the absolute URL of an href returned by the server.
+func (c *client) resolve(href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("invalid href %q: %w", href, err)
+	}
+	return c.collectionURL.ResolveReference(ref), nil
+}
+
+// do sends a request and returns the response if its status code is 2xx.
+// Other status codes are returned as a *googleapi.Error, so callers can
+// handle them like the Google Calendar ones.
+func (c *client) do(ctx context.Context, method string, u *url.URL, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, u.Redacted(), err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &googleapi.Error{
+			Code:    resp.StatusCode,
+			Message: fmt.Sprintf("%s %s: %s", method, u.Redacted(), strings.TrimSpace(string(message))),
+			Body:    string(message),
+		}
+	}
+	return resp, nil
+}
+
+// syncCollection sends a sync-collection REPORT (RFC 6578) with the given
+// sync token ("" for the initial sync), requesting the calendar data of
+// the changed resources.
+func (c *client) syncCollection(ctx context.Context, syncToken string) (*multistatus, error) {
+	var tokenXML bytes.Buffer
+	if err := xml.EscapeText(&tokenXML, []byte(syncToken)); err != nil {
+		return nil, err
+	}
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:sync-token>` + tokenXML.String() + `</d:sync-token>
+  <d:sync-level>1</d:sync-level>
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+</d:sync-collection>`
+
+	resp, err := c.do(ctx, "REPORT", c.collectionURL, []byte(body), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		// RFC 6578 only defines the report for depth 0 (the depth of
+		// the sync is given by sync-level).
+		"Depth": "0",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ms := &multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, fmt.Errorf("failed to parse sync-collection response: %w", err)
+	}
+	return ms, nil
+}
+
+// get retrieves a calendar object resource and its ETag.
+func (c *client) get(ctx context.Context, u *url.URL) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", u.Redacted(), err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// put stores a calendar object resource. If etag is set, the request
+// fails with 412 Precondition Failed if the resource changed in the
+// meantime; if it is "*", it fails if the resource already exists.
+func (c *client) put(ctx context.Context, u *url.URL, data []byte, etag string) error {
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	switch {
+	case etag == "*":
+		headers["If-None-Match"] = "*"
+	case etag != "":
+		headers["If-Match"] = etag
+	}
+	resp, err := c.do(ctx, http.MethodPut, u, data, headers)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// delete removes a calendar object resource.
+func (c *client) delete(ctx context.Context, u *url.URL) error {
+	resp, err := c.do(ctx, http.MethodDelete, u, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
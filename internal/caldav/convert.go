@@ -0,0 +1,173 @@
+package caldav
+
+import (
+	"strings"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/ics"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+const (
+	// propertyPrefix is the prefix of the iCalendar properties which hold
+	// the ZenithPlanner private properties (e.g. X-ZENITHPLANNER-MANAGED
+	// for "zenithplanner_managed").
+	propertyPrefix = "X-ZENITHPLANNER-"
+	// privateKeyPrefix is the prefix of the private property keys which
+	// are stored in the calendar.
+	privateKeyPrefix = "zenithplanner_"
+)
+
+// colorNames maps the Google Calendar color IDs to the closest CSS3 color
+// names, which is what the COLOR property (RFC 7986) holds.
+var colorNames = map[string]string{
+	"1":  "lavender",
+	"2":  "darkseagreen",
+	"3":  "mediumorchid",
+	"4":  "lightcoral",
+	"5":  "gold",
+	"6":  "darkorange",
+	"7":  "deepskyblue",
+	"8":  "gray",
+	"9":  "royalblue",
+	"10": "seagreen",
+	"11": "tomato",
+}
+
+// colorIDForName returns the color ID of a COLOR property value, or "" if
+// it doesn't correspond to any of them.
+func colorIDForName(name string) string {
+	for id, colorName := range colorNames {
+		if strings.EqualFold(colorName, name) {
+			return id
+		}
+	}
+	return ""
+}
+
+// propertyName returns the iCalendar property which holds a private
+// property, or "" if the key isn't stored in the calendar.
+func propertyName(key string) string {
+	suffix, ok := strings.CutPrefix(key, privateKeyPrefix)
+	if !ok || suffix == "" {
+		return ""
+	}
+	return propertyPrefix + strings.ToUpper(strings.ReplaceAll(suffix, "_", "-"))
+}
+
+// privateKey returns the private property key held by an iCalendar
+// property, or "" if it doesn't hold any.
+func privateKey(name string) string {
+	suffix, ok := strings.CutPrefix(name, propertyPrefix)
+	if !ok || suffix == "" {
+		return ""
+	}
+	return privateKeyPrefix + strings.ToLower(strings.ReplaceAll(suffix, "-", "_"))
+}
+
+// toEvent converts a VEVENT into the event representation used by the
+// sync code.
+func toEvent(vevent *ics.Component, id string) *gcal.Event {
+	event := &gcal.Event{
+		Id:          id,
+		Summary:     ics.UnescapeText(vevent.PropertyValue("SUMMARY")),
+		Description: ics.UnescapeText(vevent.PropertyValue("DESCRIPTION")),
+		ColorId:     colorIDForName(vevent.PropertyValue("COLOR")),
+		Status:      "confirmed",
+		Updated:     ics.UpdatedTimestamp(vevent),
+	}
+	if strings.EqualFold(vevent.PropertyValue("STATUS"), "CANCELLED") {
+		event.Status = "cancelled"
+	}
+
+	if start, isDate, err := ics.ParseDate(vevent.Property("DTSTART")); err == nil {
+		end := start.AddDate(0, 0, 1)
+		if endDate, _, err := ics.ParseDate(vevent.Property("DTEND")); err == nil && endDate.After(start) {
+			end = endDate
+		}
+		if isDate {
+			event.Start = &gcal.EventDateTime{Date: start.Format("2006-01-02")}
+			event.End = &gcal.EventDateTime{Date: end.Format("2006-01-02")}
+		} else {
+			// Events with a time of day are ignored by the sync code, so
+			// only their date is kept.
+			event.Start = &gcal.EventDateTime{DateTime: start.Format(time.RFC3339)}
+			event.End = &gcal.EventDateTime{DateTime: end.Format(time.RFC3339)}
+		}
+	}
+
+	for _, p := range vevent.Properties {
+		if key := privateKey(p.Name); key != "" {
+			if event.ExtendedProperties == nil {
+				event.ExtendedProperties = &gcal.EventExtendedProperties{Private: map[string]string{}}
+			}
+			event.ExtendedProperties.Private[key] = ics.UnescapeText(p.Value)
+		}
+		if p.Name == "RRULE" {
+			event.Recurrence = append(event.Recurrence, "RRULE:"+p.Value)
+		}
+	}
+	return event
+}
+
+// newVEvent creates a VEVENT with the given UID from an event.
+func newVEvent(uid string, event *gcal.Event, now time.Time) *ics.Component {
+	vevent := &ics.Component{Name: "VEVENT"}
+	vevent.SetProperty("UID", uid, nil)
+	applyEvent(vevent, event, nil, now)
+	return vevent
+}
+
+// applyEvent sets the fields of the event in the VEVENT. For patches, only
+// the non-empty fields and the ones in ForceSendFields are set.
+func applyEvent(vevent *ics.Component, event *gcal.Event, forceSendFields []string, now time.Time) {
+	forced := make(map[string]bool, len(forceSendFields))
+	for _, field := range forceSendFields {
+		forced[field] = true
+	}
+	setText := func(name, value string, force bool) {
+		switch {
+		case value != "":
+			vevent.SetProperty(name, ics.EscapeText(value), nil)
+		case force:
+			vevent.RemoveProperty(name, 0)
+		}
+	}
+
+	setText("SUMMARY", event.Summary, forced["Summary"])
+	setText("DESCRIPTION", event.Description, forced["Description"])
+	if event.ColorId != "" || forced["ColorId"] {
+		setText("COLOR", colorNames[event.ColorId], true)
+	}
+	if event.Start != nil && event.Start.Date != "" {
+		vevent.SetProperty("DTSTART", strings.ReplaceAll(event.Start.Date, "-", ""), map[string]string{"VALUE": "DATE"})
+	}
+	if event.End != nil && event.End.Date != "" {
+		vevent.SetProperty("DTEND", strings.ReplaceAll(event.End.Date, "-", ""), map[string]string{"VALUE": "DATE"})
+	}
+	for _, rule := range event.Recurrence {
+		if value, ok := strings.CutPrefix(rule, "RRULE:"); ok {
+			vevent.SetProperty("RRULE", value, nil)
+		}
+	}
+	if event.ExtendedProperties != nil {
+		for key, value := range event.ExtendedProperties.Private {
+			if name := propertyName(key); name != "" {
+				vevent.SetProperty(name, ics.EscapeText(value), nil)
+			}
+		}
+	}
+
+	timestamp := now.UTC().Format("20060102T150405Z")
+	vevent.SetProperty("DTSTAMP", timestamp, nil)
+	vevent.SetProperty("LAST-MODIFIED", timestamp, nil)
+}
+
+// newCalendar wraps VEVENTs in a VCALENDAR.
+func newCalendar(vevents ...*ics.Component) *ics.Component {
+	vcalendar := &ics.Component{Name: "VCALENDAR", Children: vevents}
+	vcalendar.SetProperty("VERSION", "2.0", nil)
+	vcalendar.SetProperty("PRODID", "-//ZenithPlanner//CalDAV provider//EN", nil)
+	return vcalendar
+}
@@ -0,0 +1,38 @@
+package caldav
+
+import (
+	"testing"
+)
+
+func TestPropertyName(t *testing.T) {
+	tests := []struct {
+		key  string
+		name string
+	}{
+		{"zenithplanner_managed", "X-ZENITHPLANNER-MANAGED"},
+		{"zenithplanner_auto_default", "X-ZENITHPLANNER-AUTO-DEFAULT"},
+		{"other", ""},
+		{"zenithplanner_", ""},
+	}
+	for _, tt := range tests {
+		if got := propertyName(tt.key); got != tt.name {
+			t.Errorf("propertyName(%q) = %q, want %q", tt.key, got, tt.name)
+		}
+		if tt.name != "" {
+			if got := privateKey(tt.name); got != tt.key {
+				t.Errorf("privateKey(%q) = %q, want %q", tt.name, got, tt.key)
+			}
+		}
+	}
+}
+
+func TestColorIDForName(t *testing.T) {
+	for id, name := range colorNames {
+		if got := colorIDForName(name); got != id {
+			t.Errorf("colorIDForName(%q) = %q, want %q", name, got, id)
+		}
+	}
+	if got := colorIDForName("#123456"); got != "" {
+		t.Errorf("colorIDForName() of an unknown color = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,533 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/ics"
+
+	"github.com/google/uuid"
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// instanceIDRegex matches the IDs given to recurring event instances:
+// the ID of the recurring event followed by the date of the instance.
+var instanceIDRegex = regexp.MustCompile(`^(.+)_(\d{8})$`)
+
+// ErrPushNotSupported is returned when trying to create push notification
+// channels, since CalDAV doesn't have them. Changes are polled instead.
+var ErrPushNotSupported = errors.New("push notifications aren't supported by CalDAV calendars")
+
+// Provider is a calendar.CalendarProvider backed by a CalDAV calendar
+// collection. Events are identified by the name of their resource (without
+// the .ics extension), and the instances of recurring events by the
+// recurring event ID followed by "_" and the instance date (e.g.
+// "abc_20250310"), like in Google Calendar.
+//
+// Sync tokens are the ones of the sync-collection REPORT (RFC 6578). Only
+// the ones issued by the provider are accepted (others fail with 410 Gone,
+// which forces a full sync), since the changes to recurring events are
+// computed from the instances listed by the same process. The
+// managed-ness and the other ZenithPlanner private properties are stored
+// as X-ZENITHPLANNER-* properties, and colors are stored in the COLOR
+// property (RFC 7986).
+type Provider struct {
+	client *client
+	// Function which returns the current time (replaceable for testing).
+	now func() time.Time
+
+	mu sync.Mutex
+	// IDs of the instances last listed for each recurring event, used to
+	// report them as cancelled when they disappear.
+	instances map[string][]string
+	// Sync and page tokens returned by ListEvents.
+	issuedTokens map[string]bool
+}
+
+var _ calendar.CalendarProvider = (*Provider)(nil)
+
+// NewProvider creates a provider for the calendar collection configured
+// in cfg.
+func NewProvider(cfg config.CalDAVConfig) (*Provider, error) {
+	collectionURL, err := url.Parse(cfg.URL)
+	if err != nil || collectionURL.Scheme == "" || collectionURL.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV calendar URL %q", cfg.URL)
+	}
+	if !strings.HasSuffix(collectionURL.Path, "/") {
+		collectionURL.Path += "/"
+	}
+
+	return &Provider{
+		client: &client{
+			httpClient:    &http.Client{Timeout: 60 * time.Second},
+			collectionURL: collectionURL,
+			username:      cfg.Username,
+			password:      cfg.Password,
+		},
+		now:          time.Now,
+		instances:    make(map[string][]string),
+		issuedTokens: make(map[string]bool),
+	}, nil
+}
+
+// ListEvents implements calendar.CalendarProvider. The page token is the
+// sync token of a truncated sync-collection response.
+func (p *Provider) ListEvents(ctx context.Context, opts calendar.ListOptions) (*calendar.EventPage, error) {
+	token := opts.SyncToken
+	if opts.PageToken != "" {
+		token = opts.PageToken
+	}
+	fullListing := token == ""
+
+	p.mu.Lock()
+	issued := p.issuedTokens[token]
+	p.mu.Unlock()
+	if !fullListing && !issued {
+		// The instances listed before the token was issued aren't known
+		// (e.g. it was issued before a restart), so the removed ones
+		// couldn't be reported as cancelled.
+		return nil, &googleapi.Error{
+			Code:    http.StatusGone,
+			Message: "the sync token wasn't issued by this process, a full sync is required",
+		}
+	}
+
+	ms, err := p.client.syncCollection(ctx, token)
+	if err != nil {
+		var gErr *googleapi.Error
+		if token != "" && errors.As(err, &gErr) && isInvalidSyncTokenError(gErr) {
+			return nil, &googleapi.Error{
+				Code:    http.StatusGone,
+				Message: fmt.Sprintf("sync token is no longer valid, a full sync is required: %s", gErr.Message),
+			}
+		}
+		return nil, fmt.Errorf("failed to list calendar events: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []*gcal.Event
+	truncated := false
+	for _, r := range ms.Responses {
+		resourceURL, err := p.client.resolve(r.Href)
+		if err != nil {
+			log.Printf("CalDAV: skipping response: %v", err)
+			continue
+		}
+		if strings.TrimSuffix(resourceURL.Path, "/") == strings.TrimSuffix(p.client.collectionURL.Path, "/") {
+			truncated = truncated || statusCode(r.Status) == http.StatusInsufficientStorage
+			continue
+		}
+		id := resourceID(resourceURL)
+
+		if statusCode(r.Status) == http.StatusNotFound {
+			events = append(events, p.forgetResource(id)...)
+			continue
+		}
+		for _, ps := range r.Propstats {
+			if statusCode(ps.Status) != http.StatusOK || ps.Prop.CalendarData == "" {
+				continue
+			}
+			components, err := ics.Parse(strings.NewReader(ps.Prop.CalendarData))
+			if err != nil {
+				log.Printf("CalDAV: skipping resource %s with invalid calendar data: %v", r.Href, err)
+				continue
+			}
+			events = append(events, p.resourceEvents(id, components)...)
+		}
+	}
+
+	if fullListing {
+		listed := events[:0]
+		for _, event := range events {
+			if event.Status != "cancelled" {
+				listed = append(listed, event)
+			}
+		}
+		events = listed
+	}
+	if opts.SyncToken == "" {
+		// The collection is synced as a whole, so bounded listings are
+		// filtered here.
+		listed := events[:0]
+		for _, event := range events {
+			if opts.InTimeRange(event) {
+				listed = append(listed, event)
+			}
+		}
+		events = listed
+	}
+
+	p.issuedTokens[ms.SyncToken] = true
+	page := &calendar.EventPage{Events: events}
+	if truncated {
+		page.NextPageToken = ms.SyncToken
+	} else {
+		page.NextSyncToken = ms.SyncToken
+	}
+	return page, nil
+}
+
+// GetEvent implements calendar.CalendarProvider.
+func (p *Provider) GetEvent(ctx context.Context, eventID string) (*gcal.Event, error) {
+	res, err := p.fetchResource(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if res.instanceDate == "" {
+		return toEvent(res.master, eventID), nil
+	}
+
+	master, overrides := splitVEvents([]*ics.Component{res.calendar})
+	instances, err := p.expand(res.id, master, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand recurring event %s: %w", res.id, err)
+	}
+	for _, instance := range instances {
+		if instance.Id == eventID {
+			return instance, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("event %s not found", eventID)}
+}
+
+// InsertEvent implements calendar.CalendarProvider.
+func (p *Provider) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	id := event.Id
+	if id == "" {
+		id = uuid.New().String()
+	}
+	vevent := newVEvent(id, event, p.now())
+	if err := p.store(ctx, p.resourceURL(id), newCalendar(vevent), "*"); err != nil {
+		return nil, fmt.Errorf("failed to create event %s: %w", id, err)
+	}
+	return toEvent(vevent, id), nil
+}
+
+// PatchEvent implements calendar.CalendarProvider.
+func (p *Provider) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error) {
+	res, err := p.fetchResource(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	target := res.master
+	if res.instanceDate != "" {
+		target = res.override()
+	}
+	applyEvent(target, patch, patch.ForceSendFields, p.now())
+
+	if err := p.store(ctx, res.url, res.calendar, res.etag); err != nil {
+		return nil, fmt.Errorf("failed to update event %s: %w", eventID, err)
+	}
+
+	event := toEvent(target, eventID)
+	if res.instanceDate != "" {
+		event.RecurringEventId = res.id
+		event.OriginalStartTime = &gcal.EventDateTime{Date: res.instanceDate[:4] + "-" + res.instanceDate[4:6] + "-" + res.instanceDate[6:]}
+		event.Recurrence = nil
+	}
+	return event, nil
+}
+
+// DeleteEvent implements calendar.CalendarProvider. Deleting an instance
+// of a recurring event adds an EXDATE to it.
+func (p *Provider) DeleteEvent(ctx context.Context, eventID string) error {
+	res, err := p.fetchResource(ctx, eventID)
+	if err != nil {
+		return err
+	}
+
+	if res.instanceDate == "" {
+		if err := p.client.delete(ctx, res.url); err != nil {
+			return fmt.Errorf("failed to delete event %s: %w", eventID, err)
+		}
+		return nil
+	}
+
+	res.removeOverride()
+	res.master.AddProperty("EXDATE", res.instanceDate, map[string]string{"VALUE": "DATE"})
+	res.master.SetProperty("LAST-MODIFIED", p.now().UTC().Format("20060102T150405Z"), nil)
+	if err := p.store(ctx, res.url, res.calendar, res.etag); err != nil {
+		return fmt.Errorf("failed to delete instance %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// Watch implements calendar.CalendarProvider. It always fails with
+// ErrPushNotSupported.
+func (p *Provider) Watch(ctx context.Context, channel *gcal.Channel) (*gcal.Channel, error) {
+	return nil, ErrPushNotSupported
+}
+
+// StopChannel implements calendar.CalendarProvider. It always fails with
+// ErrPushNotSupported.
+func (p *Provider) StopChannel(ctx context.Context, channel *gcal.Channel) error {
+	return ErrPushNotSupported
+}
+
+// resourceURL returns the URL of the resource of an event.
+func (p *Provider) resourceURL(id string) *url.URL {
+	return p.client.collectionURL.ResolveReference(&url.URL{Path: url.PathEscape(id) + ".ics"})
+}
+
+// resourceID returns the ID of the event stored in a resource.
+func resourceID(resourceURL *url.URL) string {
+	return strings.TrimSuffix(path.Base(resourceURL.Path), ".ics")
+}
+
+// resourceEvents converts the events of a resource. Recurring events are
+// expanded into their instances, and instances which disappeared since
+// the last listing are returned as cancelled. Must be called with p.mu
+// held.
+func (p *Provider) resourceEvents(id string, components []*ics.Component) []*gcal.Event {
+	master, overrides := splitVEvents(components)
+	if master == nil || master.Property("RRULE") == nil {
+		delete(p.instances, id)
+		if master == nil {
+			return nil
+		}
+		return []*gcal.Event{toEvent(master, id)}
+	}
+
+	events, err := p.expand(id, master, overrides)
+	if err != nil {
+		log.Printf("CalDAV: can't expand recurring event %s: %v", id, err)
+		return nil
+	}
+
+	current := make(map[string]bool, len(events))
+	instanceIDs := make([]string, 0, len(events))
+	for _, event := range events {
+		current[event.Id] = true
+		instanceIDs = append(instanceIDs, event.Id)
+	}
+	for _, previousID := range p.instances[id] {
+		if !current[previousID] {
+			events = append(events, cancelledEvent(previousID, id))
+		}
+	}
+	p.instances[id] = instanceIDs
+	return events
+}
+
+// forgetResource returns the cancelled events corresponding to a deleted
+// resource. Must be called with p.mu held.
+func (p *Provider) forgetResource(id string) []*gcal.Event {
+	instanceIDs, isRecurring := p.instances[id]
+	delete(p.instances, id)
+	if !isRecurring {
+		return []*gcal.Event{cancelledEvent(id, "")}
+	}
+	events := make([]*gcal.Event, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		events = append(events, cancelledEvent(instanceID, id))
+	}
+	return events
+}
+
+// expand returns the instances of a recurring event.
+func (p *Provider) expand(id string, master *ics.Component, overrides map[string]*ics.Component) ([]*gcal.Event, error) {
+	start, isDate, err := ics.ParseDate(master.Property("DTSTART"))
+	if err != nil {
+		return nil, err
+	}
+	if !isDate {
+		return nil, fmt.Errorf("recurring events with a time of day aren't supported")
+	}
+	end := start.AddDate(0, 0, 1)
+	if endDate, _, err := ics.ParseDate(master.Property("DTEND")); err == nil && endDate.After(start) {
+		end = endDate
+	}
+	duration := int(end.Sub(start).Hours() / 24)
+
+	dates, err := ics.ExpandEvent(master, start, p.now())
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*gcal.Event
+	for _, date := range dates {
+		dateKey := date.Format("20060102")
+		instanceID := id + "_" + dateKey
+
+		var event *gcal.Event
+		if override, ok := overrides[dateKey]; ok {
+			event = toEvent(override, instanceID)
+		} else {
+			event = toEvent(master, instanceID)
+			event.Start = &gcal.EventDateTime{Date: date.Format("2006-01-02")}
+			event.End = &gcal.EventDateTime{Date: date.AddDate(0, 0, duration).Format("2006-01-02")}
+		}
+		event.RecurringEventId = id
+		event.OriginalStartTime = &gcal.EventDateTime{Date: date.Format("2006-01-02")}
+		event.Recurrence = nil
+		if event.Status != "cancelled" {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// splitVEvents returns the main VEVENT of a resource and the overridden
+// instances of recurring events, indexed by their date ("20060102").
+func splitVEvents(components []*ics.Component) (*ics.Component, map[string]*ics.Component) {
+	var master *ics.Component
+	overrides := make(map[string]*ics.Component)
+	for _, c := range components {
+		for _, child := range c.Children {
+			if child.Name != "VEVENT" {
+				continue
+			}
+			if recurrenceID := child.PropertyValue("RECURRENCE-ID"); recurrenceID != "" {
+				overrides[recurrenceID[:min(8, len(recurrenceID))]] = child
+			} else if master == nil {
+				master = child
+			}
+		}
+	}
+	return master, overrides
+}
+
+func cancelledEvent(id, recurringEventID string) *gcal.Event {
+	return &gcal.Event{
+		Id:               id,
+		RecurringEventId: recurringEventID,
+		Status:           "cancelled",
+	}
+}
+
+// resource is a calendar object resource fetched to be modified.
+type resource struct {
+	id       string
+	url      *url.URL
+	etag     string
+	calendar *ics.Component
+	master   *ics.Component
+	// Date of the targeted instance ("20060102"), or "" if the whole
+	// event is targeted.
+	instanceDate string
+}
+
+// fetchResource retrieves the resource which holds the given event or
+// recurring event instance.
+func (p *Provider) fetchResource(ctx context.Context, eventID string) (*resource, error) {
+	if m := instanceIDRegex.FindStringSubmatch(eventID); m != nil {
+		res, err := p.fetchResourceByID(ctx, m[1])
+		if err == nil && res.master.Property("RRULE") != nil {
+			res.instanceDate = m[2]
+			return res, nil
+		}
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+	}
+	return p.fetchResourceByID(ctx, eventID)
+}
+
+func (p *Provider) fetchResourceByID(ctx context.Context, id string) (*resource, error) {
+	resourceURL := p.resourceURL(id)
+	data, etag, err := p.client.get(ctx, resourceURL)
+	if err != nil {
+		return nil, err
+	}
+	components, err := ics.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar data in event %s: %w", id, err)
+	}
+	master, _ := splitVEvents(components)
+	if len(components) == 0 || master == nil {
+		return nil, fmt.Errorf("event %s doesn't contain a VEVENT", id)
+	}
+	return &resource{
+		id:       id,
+		url:      resourceURL,
+		etag:     etag,
+		calendar: components[0],
+		master:   master,
+	}, nil
+}
+
+// override returns the VEVENT which overrides the targeted instance,
+// creating it from the recurring event if it doesn't exist.
+func (r *resource) override() *ics.Component {
+	for _, child := range r.calendar.Children {
+		if recurrenceID := child.PropertyValue("RECURRENCE-ID"); child.Name == "VEVENT" && strings.HasPrefix(recurrenceID, r.instanceDate) {
+			return child
+		}
+	}
+
+	override := &ics.Component{Name: "VEVENT"}
+	for _, prop := range r.master.Properties {
+		switch prop.Name {
+		case "RRULE", "RDATE", "EXDATE", "DTSTART", "DTEND", "DURATION":
+			continue
+		}
+		params := make(map[string]string, len(prop.Params))
+		for k, v := range prop.Params {
+			params[k] = v
+		}
+		override.AddProperty(prop.Name, prop.Value, params)
+	}
+
+	start, _ := time.Parse("20060102", r.instanceDate)
+	duration := 1
+	masterStart, _, errStart := ics.ParseDate(r.master.Property("DTSTART"))
+	masterEnd, _, errEnd := ics.ParseDate(r.master.Property("DTEND"))
+	if errStart == nil && errEnd == nil && masterEnd.After(masterStart) {
+		duration = int(masterEnd.Sub(masterStart).Hours() / 24)
+	}
+	override.SetProperty("RECURRENCE-ID", r.instanceDate, map[string]string{"VALUE": "DATE"})
+	override.SetProperty("DTSTART", r.instanceDate, map[string]string{"VALUE": "DATE"})
+	override.SetProperty("DTEND", start.AddDate(0, 0, duration).Format("20060102"), map[string]string{"VALUE": "DATE"})
+	r.calendar.Children = append(r.calendar.Children, override)
+	return override
+}
+
+// removeOverride removes the VEVENT which overrides the targeted instance,
+// if any.
+func (r *resource) removeOverride() {
+	children := r.calendar.Children[:0]
+	for _, child := range r.calendar.Children {
+		if child.Name == "VEVENT" && strings.HasPrefix(child.PropertyValue("RECURRENCE-ID"), r.instanceDate) {
+			continue
+		}
+		children = append(children, child)
+	}
+	r.calendar.Children = children
+}
+
+// store uploads a calendar to a resource (see client.put for etag).
+func (p *Provider) store(ctx context.Context, resourceURL *url.URL, vcalendar *ics.Component, etag string) error {
+	var data bytes.Buffer
+	if err := ics.Encode(&data, vcalendar); err != nil {
+		return err
+	}
+	return p.client.put(ctx, resourceURL, data.Bytes(), etag)
+}
+
+// isInvalidSyncTokenError returns whether the server rejected a sync
+// token (the DAV:valid-sync-token precondition of RFC 6578).
+func isInvalidSyncTokenError(err *googleapi.Error) bool {
+	return strings.Contains(err.Body, "valid-sync-token") ||
+		err.Code == http.StatusForbidden || err.Code == http.StatusConflict || err.Code == http.StatusGone
+}
+
+func isNotFound(err error) bool {
+	var gErr *googleapi.Error
+	return errors.As(err, &gErr) && (gErr.Code == http.StatusNotFound || gErr.Code == http.StatusGone)
+}
@@ -0,0 +1,245 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+
+	"github.com/google/uuid"
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+var testNow = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// newTestProvider returns a provider for an empty calendar. If
+// CALDAV_TEST_URL is set (e.g. "http://localhost:5232/test/" for the
+// Radicale instance in compose.caldav.yml), a new calendar is created
+// inside it; otherwise, an in-process fake server is used.
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	cfg := config.CalDAVConfig{
+		Username: os.Getenv("CALDAV_TEST_USERNAME"),
+		Password: os.Getenv("CALDAV_TEST_PASSWORD"),
+	}
+	baseURL := os.Getenv("CALDAV_TEST_URL")
+	if baseURL == "" {
+		cfg.URL = newFakeServer(t).URL + "/calendar/"
+	} else {
+		cfg.URL = strings.TrimSuffix(baseURL, "/") + "/zenithplanner-test-" + uuid.New().String() + "/"
+	}
+
+	p, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	p.now = func() time.Time { return testNow }
+
+	if baseURL != "" {
+		ctx := context.Background()
+		resp, err := p.client.do(ctx, "MKCALENDAR", p.client.collectionURL, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create test calendar: %v", err)
+		}
+		resp.Body.Close()
+		t.Cleanup(func() {
+			if resp, err := p.client.do(ctx, http.MethodDelete, p.client.collectionURL, nil, nil); err == nil {
+				resp.Body.Close()
+			}
+		})
+	}
+	return p
+}
+
+func allDayEvent(title, date, end string) *gcal.Event {
+	return &gcal.Event{
+		Summary: title,
+		ColorId: "7",
+		Start:   &gcal.EventDateTime{Date: date},
+		End:     &gcal.EventDateTime{Date: end},
+		ExtendedProperties: &gcal.EventExtendedProperties{
+			Private: map[string]string{calendar.ManagedPropertyKey: "true"},
+		},
+	}
+}
+
+func listAll(t *testing.T, p *Provider, syncToken string) ([]*gcal.Event, string) {
+	t.Helper()
+	var events []*gcal.Event
+	opts := calendar.ListOptions{SyncToken: syncToken}
+	for {
+		page, err := p.ListEvents(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("ListEvents() failed: %v", err)
+		}
+		events = append(events, page.Events...)
+		if page.NextPageToken == "" {
+			return events, page.NextSyncToken
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+func eventsByID(events []*gcal.Event) map[string]*gcal.Event {
+	byID := make(map[string]*gcal.Event, len(events))
+	for _, event := range events {
+		byID[event.Id] = event
+	}
+	return byID
+}
+
+func TestProvider_EventLifecycle(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	created, err := p.InsertEvent(ctx, allDayEvent("HOM", "2025-03-10", "2025-03-11"))
+	if err != nil {
+		t.Fatalf("InsertEvent() failed: %v", err)
+	}
+
+	events, syncToken := listAll(t, p, "")
+	if len(events) != 1 {
+		t.Fatalf("full listing returned %d events, want 1", len(events))
+	}
+	got := events[0]
+	if got.Id != created.Id || got.Summary != "HOM" || got.ColorId != "7" || got.Start.Date != "2025-03-10" || got.End.Date != "2025-03-11" {
+		t.Errorf("listed event = %+v, want the inserted one", got)
+	}
+	if !calendar.HasManagedProperty(got) {
+		t.Errorf("listed event isn't managed: %+v", got.ExtendedProperties)
+	}
+	if syncToken == "" {
+		t.Fatal("full listing didn't return a sync token")
+	}
+
+	patch := &gcal.Event{Summary: "AM: HOM / PM: V", ColorId: "5", Description: "Notes, with; special\\characters"}
+	if _, err := p.PatchEvent(ctx, created.Id, patch); err != nil {
+		t.Fatalf("PatchEvent() failed: %v", err)
+	}
+	events, syncToken = listAll(t, p, syncToken)
+	if len(events) != 1 || events[0].Summary != patch.Summary || events[0].ColorId != "5" || events[0].Description != patch.Description {
+		t.Fatalf("incremental listing after patch = %+v, want the patched event", events)
+	}
+	if !calendar.HasManagedProperty(events[0]) {
+		t.Errorf("patching lost the managed property")
+	}
+
+	if err := p.DeleteEvent(ctx, created.Id); err != nil {
+		t.Fatalf("DeleteEvent() failed: %v", err)
+	}
+	events, _ = listAll(t, p, syncToken)
+	if len(events) != 1 || events[0].Id != created.Id || events[0].Status != "cancelled" {
+		t.Fatalf("incremental listing after delete = %+v, want the cancelled event", events)
+	}
+
+	err = p.DeleteEvent(ctx, created.Id)
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Code != http.StatusNotFound {
+		t.Errorf("DeleteEvent() of a deleted event = %v, want a 404 error", err)
+	}
+}
+
+func TestProvider_RecurringEvent(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	event := allDayEvent("HOM", "2025-03-10", "2025-03-11")
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=3"}
+	created, err := p.InsertEvent(ctx, event)
+	if err != nil {
+		t.Fatalf("InsertEvent() failed: %v", err)
+	}
+
+	events, syncToken := listAll(t, p, "")
+	byID := eventsByID(events)
+	for _, date := range []string{"20250310", "20250311", "20250312"} {
+		instance, ok := byID[created.Id+"_"+date]
+		if !ok {
+			t.Fatalf("instance of %s missing in %+v", date, events)
+		}
+		if instance.RecurringEventId != created.Id || instance.Start.Date != date[:4]+"-"+date[4:6]+"-"+date[6:] {
+			t.Errorf("instance %s = %+v", instance.Id, instance)
+		}
+	}
+	if len(events) != 3 {
+		t.Errorf("full listing returned %d events, want 3", len(events))
+	}
+
+	if _, err := p.PatchEvent(ctx, created.Id+"_20250311", &gcal.Event{Summary: "V"}); err != nil {
+		t.Fatalf("PatchEvent() of an instance failed: %v", err)
+	}
+	if err := p.DeleteEvent(ctx, created.Id+"_20250312"); err != nil {
+		t.Fatalf("DeleteEvent() of an instance failed: %v", err)
+	}
+
+	events, _ = listAll(t, p, syncToken)
+	byID = eventsByID(events)
+	if got := byID[created.Id+"_20250310"]; got == nil || got.Summary != "HOM" {
+		t.Errorf("untouched instance = %+v, want HOM", got)
+	}
+	if got := byID[created.Id+"_20250311"]; got == nil || got.Summary != "V" || got.Start.Date != "2025-03-11" {
+		t.Errorf("patched instance = %+v, want V on 2025-03-11", got)
+	}
+	if got := byID[created.Id+"_20250312"]; got == nil || got.Status != "cancelled" {
+		t.Errorf("deleted instance = %+v, want it cancelled", got)
+	}
+}
+
+func TestProvider_InvalidSyncToken(t *testing.T) {
+	p := newTestProvider(t)
+	_, syncToken := listAll(t, p, "")
+
+	// The token is rejected by the server.
+	invalid := syncToken + "-invalid"
+	p.issuedTokens[invalid] = true
+	_, err := p.ListEvents(context.Background(), calendar.ListOptions{SyncToken: invalid})
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Code != http.StatusGone {
+		t.Errorf("ListEvents() with an invalid sync token = %v, want a 410 error", err)
+	}
+}
+
+func TestProvider_SyncTokenOfAnotherProcess(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+	event := allDayEvent("HOM", "2025-03-10", "2025-03-11")
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=3"}
+	if _, err := p.InsertEvent(ctx, event); err != nil {
+		t.Fatalf("InsertEvent() failed: %v", err)
+	}
+	_, syncToken := listAll(t, p, "")
+
+	// After a restart, the listed instances aren't known, so the removed
+	// ones couldn't be reported: a full sync is required.
+	restarted := &Provider{
+		client:       p.client,
+		now:          p.now,
+		instances:    make(map[string][]string),
+		issuedTokens: make(map[string]bool),
+	}
+	_, err := restarted.ListEvents(ctx, calendar.ListOptions{SyncToken: syncToken})
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Code != http.StatusGone {
+		t.Errorf("ListEvents() with a sync token of another process = %v, want a 410 error", err)
+	}
+
+	_, syncToken = listAll(t, restarted, "")
+	if _, err := restarted.ListEvents(ctx, calendar.ListOptions{SyncToken: syncToken}); err != nil {
+		t.Errorf("ListEvents() with a sync token issued after the full listing failed: %v", err)
+	}
+}
+
+func TestProvider_WatchNotSupported(t *testing.T) {
+	p := newTestProvider(t)
+	if _, err := p.Watch(context.Background(), &gcal.Channel{}); !errors.Is(err, ErrPushNotSupported) {
+		t.Errorf("Watch() = %v, want ErrPushNotSupported", err)
+	}
+}
@@ -0,0 +1,144 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	stdsync "sync"
+	"testing"
+)
+
+// fakeServer is a minimal CalDAV server with a single calendar collection
+// at /calendar/, which supports the requests made by the provider.
+type fakeServer struct {
+	mu        stdsync.Mutex
+	seq       int
+	resources map[string]*fakeResource
+}
+
+type fakeResource struct {
+	data    string
+	seq     int
+	deleted bool
+}
+
+const fakeTokenPrefix = "http://fake.invalid/sync/"
+
+func newFakeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(&fakeServer{resources: make(map[string]*fakeResource)})
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/calendar/" && r.Method == "REPORT" {
+		s.syncCollection(w, r)
+		return
+	}
+	if path.Dir(r.URL.Path) != "/calendar" {
+		http.NotFound(w, r)
+		return
+	}
+	name := path.Base(r.URL.Path)
+	res, exists := s.resources[name]
+	exists = exists && !res.deleted
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag(res.seq))
+		w.Write([]byte(res.data))
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!exists || ifMatch != etag(res.seq)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		s.seq++
+		s.resources[name] = &fakeResource{data: string(data), seq: s.seq}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		s.seq++
+		res.deleted = true
+		res.seq = s.seq
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeServer) syncCollection(w http.ResponseWriter, r *http.Request) {
+	// Like sabre/dav, only depth 0 is accepted (RFC 6578 §3.2).
+	if r.Header.Get("Depth") != "0" {
+		http.Error(w, "sync-collection requires Depth: 0", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		SyncToken string `xml:"DAV: sync-token"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	since := 0
+	if req.SyncToken != "" {
+		seq, err := strconv.Atoi(strings.TrimPrefix(req.SyncToken, fakeTokenPrefix))
+		if err != nil || !strings.HasPrefix(req.SyncToken, fakeTokenPrefix) || seq > s.seq {
+			http.Error(w, `<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`, http.StatusForbidden)
+			return
+		}
+		since = seq
+	}
+
+	names := make([]string, 0, len(s.resources))
+	for name := range s.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+	for _, name := range names {
+		res := s.resources[name]
+		if res.seq <= since || (res.deleted && since == 0) {
+			continue
+		}
+		if res.deleted {
+			fmt.Fprintf(&body, `<d:response><d:href>/calendar/%s</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`, name)
+			continue
+		}
+		var data strings.Builder
+		xml.EscapeText(&data, []byte(res.data))
+		fmt.Fprintf(&body, `<d:response><d:href>/calendar/%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><c:calendar-data>%s</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, name, etag(res.seq), data.String())
+	}
+	fmt.Fprintf(&body, `<d:sync-token>%s%d</d:sync-token></d:multistatus>`, fakeTokenPrefix, s.seq)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(body.String()))
+}
+
+func etag(seq int) string {
+	return fmt.Sprintf(`"%d"`, seq)
+}
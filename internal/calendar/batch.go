@@ -0,0 +1,134 @@
+package calendar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// ExecuteBatch implements BatchProvider with the batch endpoint of the
+// Google Calendar API, which receives a multipart/mixed request where each
+// part is an HTTP request, and replies with the responses in the same
+// format.
+func (p *GoogleProvider) ExecuteBatch(ctx context.Context, ops []BatchOperation) ([]error, error) {
+	if len(ops) > MaxBatchSize {
+		return nil, fmt.Errorf("batch of %d operations exceeds the maximum of %d", len(ops), MaxBatchSize)
+	}
+	batchURL, apiPath, err := batchEndpoint(p.service.BasePath)
+	if err != nil {
+		return nil, err
+	}
+	eventsPath := apiPath + "calendars/" + url.PathEscape(p.calendarID) + "/events"
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, op := range ops {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", fmt.Sprintf("<op%d>", i))
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build batch request: %w", err)
+		}
+		if op.Insert != nil {
+			payload, err := json.Marshal(op.Insert)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode event to insert: %w", err)
+			}
+			fmt.Fprintf(part, "POST %s HTTP/1.1\r\nContent-Type: application/json\r\n\r\n%s\r\n", eventsPath, payload)
+		} else {
+			fmt.Fprintf(part, "DELETE %s/%s HTTP/1.1\r\n\r\n", eventsPath, url.PathEscape(op.DeleteEventID))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build batch request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, batchURL, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build batch request: %w", err)
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("batch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("batch request failed: %w", err)
+	}
+	return parseBatchResponse(resp, len(ops))
+}
+
+// batchEndpoint returns the URL of the batch endpoint and the path of the
+// API given its base path (e.g. https://www.googleapis.com/calendar/v3/ is
+// served by https://www.googleapis.com/batch/calendar/v3).
+func batchEndpoint(basePath string) (batchURL, apiPath string, err error) {
+	base, err := url.Parse(basePath)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid API base path %q: %w", basePath, err)
+	}
+	apiPath = base.Path
+	if !strings.HasSuffix(apiPath, "/") {
+		apiPath += "/"
+	}
+	batch := *base
+	batch.Path = "/batch" + strings.TrimSuffix(apiPath, "/")
+	return batch.String(), apiPath, nil
+}
+
+// parseBatchResponse returns the error of each operation from the
+// multipart response of a batch request.
+func parseBatchResponse(resp *http.Response, numOps int) ([]error, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unexpected batch response content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	errs := make([]error, numOps)
+	received := make([]bool, numOps)
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch response: %w", err)
+		}
+
+		// Responses are identified by the Content-ID of the request,
+		// prefixed with "response-".
+		contentID := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		index, err := strconv.Atoi(strings.TrimPrefix(contentID, "response-op"))
+		if err != nil || index < 0 || index >= numOps {
+			return nil, fmt.Errorf("unexpected Content-ID %q in batch response", contentID)
+		}
+		partResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch response for operation %d: %w", index, err)
+		}
+		errs[index] = googleapi.CheckResponse(partResp)
+		partResp.Body.Close()
+		received[index] = true
+	}
+
+	for i := range errs {
+		if !received[i] {
+			errs[i] = fmt.Errorf("the batch response doesn't include operation %d", i)
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,122 @@
+package calendar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// batchServer replies to each request of a batch with the status returned
+// by respond, and records the requests (as "METHOD path").
+func batchServer(t *testing.T, respond func(req *http.Request) int) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/batch/calendar/v3" {
+			t.Errorf("batch request sent to %s, want /batch/calendar/v3", r.URL.Path)
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatalf("invalid Content-Type: %v", err)
+		}
+
+		writer := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read batch request: %v", err)
+			}
+			req, err := http.ReadRequest(bufio.NewReader(part))
+			if err != nil {
+				t.Fatalf("failed to read request in batch: %v", err)
+			}
+			requests = append(requests, req.Method+" "+req.URL.Path)
+
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Type", "application/http")
+			header.Set("Content-ID", "<response-"+strings.Trim(part.Header.Get("Content-ID"), "<>")+">")
+			responsePart, _ := writer.CreatePart(header)
+			status := respond(req)
+			body := `{"id": "created"}`
+			if status >= 300 {
+				body = fmt.Sprintf(`{"error": {"code": %d, "message": "failed", "errors": [{"reason": "test"}]}}`, status)
+			}
+			fmt.Fprintf(responsePart, "HTTP/1.1 %d %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", status, http.StatusText(status), len(body), body)
+		}
+		writer.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestGoogleProvider(t *testing.T, server *httptest.Server) *GoogleProvider {
+	t.Helper()
+	service, err := gcal.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/calendar/v3/"))
+	if err != nil {
+		t.Fatalf("failed to create the service: %v", err)
+	}
+	return NewGoogleProvider(service, server.Client(), "work@example.com")
+}
+
+func TestGoogleProviderExecuteBatch(t *testing.T) {
+	server, requests := batchServer(t, func(req *http.Request) int {
+		if req.Method == http.MethodDelete && strings.HasSuffix(req.URL.Path, "/missing") {
+			return http.StatusNotFound
+		}
+		return http.StatusOK
+	})
+	p := newTestGoogleProvider(t, server)
+
+	errs, err := p.ExecuteBatch(context.Background(), []BatchOperation{
+		{Insert: &gcal.Event{Id: "new", Summary: "HOM"}},
+		{DeleteEventID: "old"},
+		{DeleteEventID: "missing"},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteBatch() failed: %v", err)
+	}
+
+	wantRequests := []string{
+		"POST /calendar/v3/calendars/work@example.com/events",
+		"DELETE /calendar/v3/calendars/work@example.com/events/old",
+		"DELETE /calendar/v3/calendars/work@example.com/events/missing",
+	}
+	if strings.Join(*requests, "\n") != strings.Join(wantRequests, "\n") {
+		t.Errorf("requests = %q, want %q", *requests, wantRequests)
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("errors = %v, want the first 2 operations to succeed", errs)
+	}
+	if gErr, ok := errs[2].(*googleapi.Error); !ok || gErr.Code != http.StatusNotFound {
+		t.Errorf("error of the last operation = %v, want a 404 *googleapi.Error", errs[2])
+	}
+}
+
+func TestGoogleProviderExecuteBatchReportsRetryableErrors(t *testing.T) {
+	server, _ := batchServer(t, func(req *http.Request) int { return http.StatusTooManyRequests })
+	p := newTestGoogleProvider(t, server)
+
+	errs, err := p.ExecuteBatch(context.Background(), []BatchOperation{{DeleteEventID: "a"}})
+	if err != nil {
+		t.Fatalf("ExecuteBatch() failed: %v", err)
+	}
+	if !IsRetryableError(errs[0]) {
+		t.Errorf("error = %v, want a retryable error", errs[0])
+	}
+}
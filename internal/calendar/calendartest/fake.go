@@ -0,0 +1,643 @@
+// Package calendartest provides an in-memory calendar.CalendarProvider to
+// test the code which syncs with the calendar.
+package calendartest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	syncTokenPrefix = "fake-sync-"
+	// maxInstances limits the expansion of recurring events without COUNT
+	// or UNTIL.
+	maxInstances = 730
+)
+
+// Fake is an in-memory calendar which behaves like the Google Calendar API
+// in the aspects the sync code relies on:
+//
+//   - Every change bumps the event's updated timestamp, which always
+//     increases.
+//   - Listings can be bounded with TimeMin and TimeMax, and their sync
+//     tokens still return the changes of all the events.
+//   - Sync tokens return the events changed since they were issued,
+//     including deleted ones (with the "cancelled" status), and fail with
+//     410 Gone once invalidated.
+//   - Recurring all-day events (with a DAILY or WEEKLY RRULE) are listed
+//     as their instances, which can be patched or deleted individually.
+//   - Deleting an event which was already deleted fails with 410 Gone, and
+//     unknown events fail with 404 Not Found.
+//   - Inserting an event with an ID which isn't made of 5 to 1024 base32hex
+//     characters fails with 400 Bad Request.
+//
+// It is safe for concurrent use.
+type Fake struct {
+	// Now returns the current time, used for the updated timestamps.
+	Now func() time.Time
+	// PageSize is the maximum number of events returned per page.
+	PageSize int
+
+	mu          sync.Mutex
+	events      map[string]*storedEvent
+	seq         int64
+	epoch       int
+	lastUpdated time.Time
+	nextID      int
+	pages       map[string]*calendar.EventPage
+	channels    map[string]*gcal.Channel
+	batches     int
+}
+
+// storedEvent is a single event, a recurring event (master) or a modified
+// instance of a recurring event.
+type storedEvent struct {
+	event *gcal.Event
+	// Sequence number of the last change.
+	seq int64
+}
+
+// NewFake creates an empty calendar.
+func NewFake() *Fake {
+	return &Fake{
+		Now:      time.Now,
+		PageSize: 50,
+		events:   make(map[string]*storedEvent),
+		pages:    make(map[string]*calendar.EventPage),
+		channels: make(map[string]*gcal.Channel),
+	}
+}
+
+var _ calendar.BatchProvider = (*Fake)(nil)
+
+// ListEvents implements calendar.CalendarProvider.
+func (f *Fake) ListEvents(ctx context.Context, opts calendar.ListOptions) (*calendar.EventPage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if opts.PageToken != "" {
+		page, ok := f.pages[opts.PageToken]
+		if !ok {
+			return nil, apiError(http.StatusBadRequest, "invalid page token %q", opts.PageToken)
+		}
+		delete(f.pages, opts.PageToken)
+		return f.paginate(page.Events, page.NextSyncToken), nil
+	}
+
+	var events []*gcal.Event
+	if opts.SyncToken != "" {
+		sinceSeq, err := f.parseSyncToken(opts.SyncToken)
+		if err != nil {
+			return nil, err
+		}
+		events = f.changesSince(sinceSeq)
+	} else {
+		for _, event := range f.currentEvents() {
+			if opts.InTimeRange(event) {
+				events = append(events, event)
+			}
+		}
+	}
+	return f.paginate(events, fmt.Sprintf("%s%d-%d", syncTokenPrefix, f.epoch, f.seq)), nil
+}
+
+// InsertEvent implements calendar.CalendarProvider.
+func (f *Fake) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := cloneEvent(event)
+	if e.Id == "" {
+		f.nextID++
+		e.Id = fmt.Sprintf("event%d", f.nextID)
+	} else if !isValidEventID(e.Id) {
+		return nil, apiError(http.StatusBadRequest, "invalid event ID %q", e.Id)
+	}
+	if _, exists := f.events[e.Id]; exists {
+		return nil, apiError(http.StatusConflict, "event %s already exists", e.Id)
+	}
+	if e.Start == nil || e.End == nil {
+		return nil, apiError(http.StatusBadRequest, "event %s doesn't have a start or end", e.Id)
+	}
+	if len(e.Recurrence) > 0 {
+		if e.Start.Date == "" {
+			return nil, apiError(http.StatusBadRequest, "recurring events with a time of day aren't supported by the fake")
+		}
+		if _, err := parseRecurrence(e.Recurrence); err != nil {
+			return nil, apiError(http.StatusBadRequest, "%v", err)
+		}
+	}
+	e.Status = "confirmed"
+	f.store(e)
+	return cloneEvent(e), nil
+}
+
+// GetEvent implements calendar.CalendarProvider.
+func (f *Fake) GetEvent(ctx context.Context, eventID string) (*gcal.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.modifiableEvent(eventID)
+}
+
+// PatchEvent implements calendar.CalendarProvider.
+func (f *Fake) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, err := f.modifiableEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	applyPatch(e, patch)
+	f.store(e)
+	return cloneEvent(e), nil
+}
+
+// DeleteEvent implements calendar.CalendarProvider.
+func (f *Fake) DeleteEvent(ctx context.Context, eventID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, err := f.modifiableEvent(eventID)
+	if err != nil {
+		return err
+	}
+	e.Status = "cancelled"
+	f.store(e)
+	return nil
+}
+
+// ExecuteBatch implements calendar.BatchProvider.
+func (f *Fake) ExecuteBatch(ctx context.Context, ops []calendar.BatchOperation) ([]error, error) {
+	if len(ops) > calendar.MaxBatchSize {
+		return nil, apiError(http.StatusBadRequest, "too many operations in a batch: %d", len(ops))
+	}
+	f.mu.Lock()
+	f.batches++
+	f.mu.Unlock()
+
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		if op.Insert != nil {
+			_, errs[i] = f.InsertEvent(ctx, op.Insert)
+		} else {
+			errs[i] = f.DeleteEvent(ctx, op.DeleteEventID)
+		}
+	}
+	return errs, nil
+}
+
+// Watch implements calendar.CalendarProvider.
+func (f *Fake) Watch(ctx context.Context, channel *gcal.Channel) (*gcal.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.channels[channel.Id]; exists {
+		return nil, apiError(http.StatusBadRequest, "channel %s already exists", channel.Id)
+	}
+	f.nextID++
+	created := *channel
+	created.ResourceId = fmt.Sprintf("resource%d", f.nextID)
+	created.Expiration = f.Now().Add(7 * 24 * time.Hour).UnixMilli()
+	f.channels[created.Id] = &created
+	result := created
+	return &result, nil
+}
+
+// StopChannel implements calendar.CalendarProvider.
+func (f *Fake) StopChannel(ctx context.Context, channel *gcal.Channel) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.channels[channel.Id]
+	if !ok || existing.ResourceId != channel.ResourceId {
+		return apiError(http.StatusNotFound, "channel %s not found", channel.Id)
+	}
+	delete(f.channels, channel.Id)
+	return nil
+}
+
+// InvalidateSyncTokens makes all the sync tokens issued so far fail with
+// 410 Gone, as Google does when they expire.
+func (f *Fake) InvalidateSyncTokens() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.epoch++
+}
+
+// Events returns the events currently in the calendar, with recurring
+// events expanded into their instances.
+func (f *Fake) Events() []*gcal.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.currentEvents()
+}
+
+// EventsOn returns the events currently in the calendar which start on
+// the given date (in the "2006-01-02" format).
+func (f *Fake) EventsOn(date string) []*gcal.Event {
+	var events []*gcal.Event
+	for _, e := range f.Events() {
+		if startDate(e) == date {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Event returns the event or instance with the given ID, or nil if it
+// doesn't exist or was deleted.
+func (f *Fake) Event(eventID string) *gcal.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.modifiableEvent(eventID)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+// Batches returns the number of batches executed with ExecuteBatch.
+func (f *Fake) Batches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.batches
+}
+
+// Channels returns the active push notification channels.
+func (f *Fake) Channels() []*gcal.Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	channels := make([]*gcal.Channel, 0, len(f.channels))
+	for _, c := range f.channels {
+		channel := *c
+		channels = append(channels, &channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Id < channels[j].Id })
+	return channels
+}
+
+// store saves the event as a new change, bumping its updated timestamp.
+func (f *Fake) store(e *gcal.Event) {
+	updated := f.Now().UTC()
+	if !updated.After(f.lastUpdated) {
+		updated = f.lastUpdated.Add(time.Millisecond)
+	}
+	f.lastUpdated = updated
+	e.Updated = updated.Format(time.RFC3339Nano)
+
+	f.seq++
+	f.events[e.Id] = &storedEvent{event: e, seq: f.seq}
+}
+
+// modifiableEvent returns a copy of the event with the given ID, which can
+// also be the ID of a recurring event instance which hasn't been modified
+// yet.
+func (f *Fake) modifiableEvent(eventID string) (*gcal.Event, error) {
+	if stored, ok := f.events[eventID]; ok {
+		if stored.event.Status == "cancelled" {
+			return nil, apiError(http.StatusGone, "event %s has been deleted", eventID)
+		}
+		return cloneEvent(stored.event), nil
+	}
+
+	masterID, _, found := strings.Cut(eventID, "_")
+	if master, ok := f.events[masterID]; found && ok && master.event.Status != "cancelled" {
+		for _, instance := range f.expand(master.event) {
+			if instance.Id == eventID {
+				return instance, nil
+			}
+		}
+	}
+	return nil, apiError(http.StatusNotFound, "event %s not found", eventID)
+}
+
+// currentEvents returns the events which aren't cancelled, with recurring
+// events expanded.
+func (f *Fake) currentEvents() []*gcal.Event {
+	var events []*gcal.Event
+	for _, stored := range f.events {
+		if stored.event.Status == "cancelled" {
+			continue
+		}
+		if master, ok := f.events[stored.event.RecurringEventId]; ok && master.event.Status != "cancelled" {
+			// Modified instances are listed by the expansion of their
+			// recurring event.
+			continue
+		}
+		if len(stored.event.Recurrence) > 0 {
+			events = append(events, f.expand(stored.event)...)
+		} else {
+			events = append(events, cloneEvent(stored.event))
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+// changesSince returns the events changed after the given sequence number.
+func (f *Fake) changesSince(sinceSeq int64) []*gcal.Event {
+	var events []*gcal.Event
+	for _, stored := range f.events {
+		if stored.seq <= sinceSeq {
+			continue
+		}
+		e := stored.event
+		switch {
+		case len(e.Recurrence) > 0 && e.Status == "cancelled":
+			for _, instance := range f.expand(e) {
+				events = append(events, cancelledEvent(instance))
+			}
+		case len(e.Recurrence) > 0:
+			events = append(events, f.expand(e)...)
+		case e.Status == "cancelled":
+			events = append(events, cancelledEvent(e))
+		default:
+			events = append(events, cloneEvent(e))
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+// parseSyncToken returns the sequence number at which the sync token was
+// issued. Tokens have the "fake-sync-<epoch>-<seq>" format.
+func (f *Fake) parseSyncToken(token string) (int64, error) {
+	invalid := apiError(http.StatusGone, "sync token %q is no longer valid, a full sync is required", token)
+	epochStr, seqStr, found := strings.Cut(strings.TrimPrefix(token, syncTokenPrefix), "-")
+	if !strings.HasPrefix(token, syncTokenPrefix) || !found {
+		return 0, invalid
+	}
+	epoch, err := strconv.Atoi(epochStr)
+	if err != nil || epoch != f.epoch {
+		return 0, invalid
+	}
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil || seq > f.seq {
+		return 0, invalid
+	}
+	return seq, nil
+}
+
+// paginate returns the first page of events, and keeps the rest to be
+// retrieved with the page token.
+func (f *Fake) paginate(events []*gcal.Event, syncToken string) *calendar.EventPage {
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = len(events) + 1
+	}
+	if len(events) <= pageSize {
+		return &calendar.EventPage{Events: events, NextSyncToken: syncToken}
+	}
+
+	f.nextID++
+	pageToken := fmt.Sprintf("page%d", f.nextID)
+	f.pages[pageToken] = &calendar.EventPage{Events: events[pageSize:], NextSyncToken: syncToken}
+	return &calendar.EventPage{Events: events[:pageSize], NextPageToken: pageToken}
+}
+
+// expand returns the instances of a recurring event, taking into account
+// the modified and deleted ones.
+func (f *Fake) expand(master *gcal.Event) []*gcal.Event {
+	rule, err := parseRecurrence(master.Recurrence)
+	if err != nil {
+		return nil
+	}
+	start, err := time.Parse("2006-01-02", master.Start.Date)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse("2006-01-02", master.End.Date)
+	if err != nil {
+		return nil
+	}
+	duration := int(end.Sub(start).Hours() / 24)
+
+	var instances []*gcal.Event
+	for _, date := range rule.dates(start) {
+		id := master.Id + "_" + date.Format("20060102")
+		if exception, ok := f.events[id]; ok {
+			if exception.event.Status != "cancelled" {
+				instances = append(instances, cloneEvent(exception.event))
+			}
+			continue
+		}
+		instance := cloneEvent(master)
+		instance.Id = id
+		instance.Recurrence = nil
+		instance.RecurringEventId = master.Id
+		instance.OriginalStartTime = &gcal.EventDateTime{Date: date.Format("2006-01-02")}
+		instance.Start = &gcal.EventDateTime{Date: date.Format("2006-01-02")}
+		instance.End = &gcal.EventDateTime{Date: date.AddDate(0, 0, duration).Format("2006-01-02")}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// recurrenceRule is the subset of RRULE supported by the fake.
+type recurrenceRule struct {
+	freqDays int
+	interval int
+	count    int
+	until    time.Time
+}
+
+func parseRecurrence(recurrence []string) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1}
+	for _, line := range recurrence {
+		value, isRule := strings.CutPrefix(line, "RRULE:")
+		if !isRule {
+			return nil, fmt.Errorf("unsupported recurrence line %q", line)
+		}
+		for _, part := range strings.Split(value, ";") {
+			key, val, _ := strings.Cut(part, "=")
+			var err error
+			switch key {
+			case "FREQ":
+				switch val {
+				case "DAILY":
+					rule.freqDays = 1
+				case "WEEKLY":
+					rule.freqDays = 7
+				default:
+					return nil, fmt.Errorf("unsupported frequency %q", val)
+				}
+			case "INTERVAL":
+				rule.interval, err = strconv.Atoi(val)
+			case "COUNT":
+				rule.count, err = strconv.Atoi(val)
+			case "UNTIL":
+				rule.until, err = time.Parse("20060102", val[:min(8, len(val))])
+			default:
+				return nil, fmt.Errorf("unsupported RRULE part %q", part)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE part %q: %w", part, err)
+			}
+		}
+	}
+	if rule.freqDays == 0 || rule.interval <= 0 {
+		return nil, fmt.Errorf("invalid recurrence %q", recurrence)
+	}
+	return rule, nil
+}
+
+// dates returns the dates of the occurrences starting at start.
+func (r *recurrenceRule) dates(start time.Time) []time.Time {
+	var dates []time.Time
+	for date := start; len(dates) < maxInstances; date = date.AddDate(0, 0, r.freqDays*r.interval) {
+		if r.count > 0 && len(dates) >= r.count {
+			break
+		}
+		if !r.until.IsZero() && date.After(r.until) {
+			break
+		}
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+// applyPatch applies the fields set in the patch, following the Patch
+// semantics of the Google Calendar API (private and shared properties
+// are merged key by key).
+func applyPatch(e, patch *gcal.Event) {
+	forced := make(map[string]bool, len(patch.ForceSendFields))
+	for _, field := range patch.ForceSendFields {
+		forced[field] = true
+	}
+
+	if patch.Summary != "" || forced["Summary"] {
+		e.Summary = patch.Summary
+	}
+	if patch.Description != "" || forced["Description"] {
+		e.Description = patch.Description
+	}
+	if patch.ColorId != "" || forced["ColorId"] {
+		e.ColorId = patch.ColorId
+	}
+	if patch.Start != nil {
+		start := *patch.Start
+		e.Start = &start
+	}
+	if patch.End != nil {
+		end := *patch.End
+		e.End = &end
+	}
+	if patch.Recurrence != nil {
+		e.Recurrence = append([]string(nil), patch.Recurrence...)
+	}
+	if patch.ExtendedProperties != nil {
+		if e.ExtendedProperties == nil {
+			e.ExtendedProperties = &gcal.EventExtendedProperties{}
+		}
+		e.ExtendedProperties.Private = mergeProperties(e.ExtendedProperties.Private, patch.ExtendedProperties.Private)
+		e.ExtendedProperties.Shared = mergeProperties(e.ExtendedProperties.Shared, patch.ExtendedProperties.Shared)
+	}
+}
+
+func mergeProperties(current, patch map[string]string) map[string]string {
+	if len(patch) == 0 {
+		return current
+	}
+	merged := make(map[string]string, len(current)+len(patch))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		merged[k] = v
+	}
+	return merged
+}
+
+// cloneEvent returns a copy of the event which doesn't share any mutable
+// field with it.
+func cloneEvent(e *gcal.Event) *gcal.Event {
+	c := *e
+	if e.Start != nil {
+		start := *e.Start
+		c.Start = &start
+	}
+	if e.End != nil {
+		end := *e.End
+		c.End = &end
+	}
+	if e.OriginalStartTime != nil {
+		ost := *e.OriginalStartTime
+		c.OriginalStartTime = &ost
+	}
+	if e.ExtendedProperties != nil {
+		c.ExtendedProperties = &gcal.EventExtendedProperties{
+			Private: mergeProperties(nil, e.ExtendedProperties.Private),
+			Shared:  mergeProperties(nil, e.ExtendedProperties.Shared),
+		}
+	}
+	c.Recurrence = append([]string(nil), e.Recurrence...)
+	if len(c.Recurrence) == 0 {
+		c.Recurrence = nil
+	}
+	c.ForceSendFields = nil
+	return &c
+}
+
+// cancelledEvent returns how a deleted event is listed with a sync token:
+// only its ID, recurring event ID, updated timestamp and status.
+func cancelledEvent(e *gcal.Event) *gcal.Event {
+	return &gcal.Event{
+		Id:               e.Id,
+		RecurringEventId: e.RecurringEventId,
+		Updated:          e.Updated,
+		Status:           "cancelled",
+	}
+}
+
+func startDate(e *gcal.Event) string {
+	if e.Start == nil {
+		return ""
+	}
+	if e.Start.Date != "" {
+		return e.Start.Date
+	}
+	if len(e.Start.DateTime) >= 10 {
+		return e.Start.DateTime[:10]
+	}
+	return ""
+}
+
+func sortEvents(events []*gcal.Event) {
+	sort.Slice(events, func(i, j int) bool {
+		di, dj := startDate(events[i]), startDate(events[j])
+		if di != dj {
+			return di < dj
+		}
+		return events[i].Id < events[j].Id
+	})
+}
+
+// isValidEventID returns whether an ID chosen by the client is accepted by
+// Google Calendar: between 5 and 1024 base32hex characters (a-v and 0-9).
+func isValidEventID(id string) bool {
+	if len(id) < 5 || len(id) > 1024 {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'v') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func apiError(code int, format string, args ...any) *googleapi.Error {
+	return &googleapi.Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,297 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// validColorIDs contains the event color IDs supported by Google Calendar.
+var validColorIDs = map[string]struct{}{
+	"1": {}, "2": {}, "3": {}, "4": {}, "5": {}, "6": {},
+	"7": {}, "8": {}, "9": {}, "10": {}, "11": {},
+}
+
+// LocationType describes a kind of location which can be set as the title
+// of a calendar event.
+type LocationType struct {
+	// Status name assigned to the days matching this location type.
+	Status LocationStatus `json:"status"`
+	// Regex pattern matched against the event title.
+	Pattern string `json:"pattern"`
+	// Google Calendar color ID given to matching events.
+	ColorID string `json:"colorId"`
+	// Category used to group statuses in stats.
+	Category string `json:"category"`
+	// Whether days with this status count as working days.
+	WorkingDay bool `json:"workingDay"`
+	// Example of a title matching the pattern, shown to the user when
+	// explaining which titles are valid (optional).
+	Example string `json:"example,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// Catalog holds the location types known by ZenithPlanner.
+type Catalog struct {
+	Locations []LocationType `json:"locations"`
+	// Color ID given to events whose title doesn't match any location.
+	UnknownColorID string `json:"unknownColorId"`
+	// Rule used to color split day events: "morning" or "afternoon" to
+	// use the color of that half, or a fixed color ID.
+	SplitDayColorRule string `json:"splitDayColorRule"`
+	// Free-form titles (e.g. "home") mapped to the canonical location code
+	// they stand for (e.g. "HOM"). Matching is case-insensitive.
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	aliases map[string]string
+}
+
+// DefaultCatalog returns the catalog used when no catalog file is
+// configured.
+func DefaultCatalog() *Catalog {
+	c := &Catalog{
+		Locations: []LocationType{
+			{Status: "Home", Pattern: `^HOM$`, ColorID: "3", Category: "Remote", WorkingDay: true, Example: "HOM"},                         // Mauve/Grape
+			{Status: "Vacation", Pattern: `^V$`, ColorID: "10", Category: "Time off", WorkingDay: false, Example: "V"},                     // Green/Basil
+			{Status: "Office", Pattern: `^P\d{2}[A-Z]+\d{3}$`, ColorID: "5", Category: "On-site", WorkingDay: true, Example: "P12GRAN303"}, // Yellow/Banana
+			{Status: "Library", Pattern: `^LIB.*`, ColorID: "2", Category: "On-site", WorkingDay: true, Example: "LIB-CENTRAL"},            // Pale Green/Sage
+		},
+		UnknownColorID:    "8", // Gray
+		SplitDayColorRule: SplitDayColorMorning,
+		Aliases: map[string]string{
+			"home":     "HOM",
+			"vac":      "V",
+			"vacation": "V",
+		},
+	}
+	if err := c.compile(); err != nil {
+		panic(fmt.Sprintf("default location catalog is invalid: %v", err))
+	}
+	return c
+}
+
+// LoadCatalog reads and validates the location catalog stored in the JSON
+// file at path. If path is empty, the default catalog is returned.
+func LoadCatalog(path string) (*Catalog, error) {
+	if path == "" {
+		return DefaultCatalog(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read location catalog %s: %w", path, err)
+	}
+
+	c := &Catalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse location catalog %s: %w", path, err)
+	}
+	if c.UnknownColorID == "" {
+		c.UnknownColorID = "8"
+	}
+	if c.SplitDayColorRule == "" {
+		c.SplitDayColorRule = SplitDayColorMorning
+	}
+	if err := c.compile(); err != nil {
+		return nil, fmt.Errorf("invalid location catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// AddReservedCode adds a code configured outside of the catalog (e.g. the
+// holiday code) with the given status, which never counts as a working
+// day. If the catalog already has a location type with the status, its
+// pattern is widened to also match the code. Nothing is added if the code
+// is empty or already matches a non-working location, and it fails if the
+// code matches a working one.
+func (c *Catalog) AddReservedCode(code string, status LocationStatus, category string) error {
+	if code == "" {
+		return nil
+	}
+	if l := c.Lookup(code); l != nil {
+		if !l.WorkingDay {
+			return nil
+		}
+		return fmt.Errorf("code %q matches the pattern %q of status %q, which counts as a working day", code, l.Pattern, l.Status)
+	}
+	codePattern := "^" + regexp.QuoteMeta(code) + "$"
+	if l := c.LocationType(status); l != nil {
+		if l.WorkingDay {
+			return fmt.Errorf("status %q of code %q counts as a working day", status, code)
+		}
+		l.Pattern = "(?:" + l.Pattern + ")|" + codePattern
+		return c.compile()
+	}
+	c.Locations = append(c.Locations, LocationType{
+		Status:     status,
+		Pattern:    codePattern,
+		ColorID:    c.UnknownColorID,
+		Category:   category,
+		WorkingDay: false,
+		Example:    code,
+	})
+	return c.compile()
+}
+
+// compile validates the catalog and compiles the location patterns.
+func (c *Catalog) compile() error {
+	if len(c.Locations) == 0 {
+		return fmt.Errorf("at least one location must be defined")
+	}
+	if _, ok := validColorIDs[c.UnknownColorID]; !ok {
+		return fmt.Errorf("unknown color ID %q for unknown locations", c.UnknownColorID)
+	}
+	if c.SplitDayColorRule != SplitDayColorMorning && c.SplitDayColorRule != SplitDayColorAfternoon {
+		if _, ok := validColorIDs[c.SplitDayColorRule]; !ok {
+			return fmt.Errorf("split day color rule %q must be %q, %q or a known color ID", c.SplitDayColorRule, SplitDayColorMorning, SplitDayColorAfternoon)
+		}
+	}
+
+	statuses := make(map[LocationStatus]struct{})
+	patterns := make(map[string]LocationStatus)
+	for i := range c.Locations {
+		l := &c.Locations[i]
+		if l.Status == "" {
+			return fmt.Errorf("location #%d has an empty status", i+1)
+		}
+		if l.Status == StatusUnknown || (l.Status == StatusNonWorking && l.WorkingDay) {
+			return fmt.Errorf("status %q is reserved", l.Status)
+		}
+		if _, dup := statuses[l.Status]; dup {
+			return fmt.Errorf("status %q is defined more than once", l.Status)
+		}
+		statuses[l.Status] = struct{}{}
+
+		if l.Pattern == "" {
+			return fmt.Errorf("status %q has an empty pattern", l.Status)
+		}
+		if other, dup := patterns[l.Pattern]; dup {
+			return fmt.Errorf("statuses %q and %q share the pattern %q", other, l.Status, l.Pattern)
+		}
+		patterns[l.Pattern] = l.Status
+
+		regex, err := regexp.Compile(l.Pattern)
+		if err != nil {
+			return fmt.Errorf("status %q has an invalid pattern: %w", l.Status, err)
+		}
+		l.regex = regex
+
+		if _, ok := validColorIDs[l.ColorID]; !ok {
+			return fmt.Errorf("status %q has an unknown color ID %q", l.Status, l.ColorID)
+		}
+	}
+
+	c.aliases = make(map[string]string, len(c.Aliases))
+	for alias, code := range c.Aliases {
+		key := normalizeAlias(alias)
+		if key == "" {
+			return fmt.Errorf("alias of %q is empty", code)
+		}
+		if c.Lookup(code) == nil {
+			return fmt.Errorf("alias %q maps to %q, which doesn't match any location", alias, code)
+		}
+		if other, dup := c.aliases[key]; dup && other != code {
+			return fmt.Errorf("alias %q maps to both %q and %q", alias, other, code)
+		}
+		c.aliases[key] = code
+	}
+	return nil
+}
+
+// normalizeAlias returns the form in which aliases are compared: lowercase
+// and with consecutive spaces collapsed.
+func normalizeAlias(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// Lookup returns the location type matching the given location code, or
+// nil if none matches. Location types are checked in catalog order.
+func (c *Catalog) Lookup(locationCode string) *LocationType {
+	for i := range c.Locations {
+		if c.Locations[i].regex.MatchString(locationCode) {
+			return &c.Locations[i]
+		}
+	}
+	return nil
+}
+
+// CanonicalCode returns the location code which the given free-form code
+// stands for, trying an exact match, the alias table and the uppercase
+// form of the code in this order. The uppercase form is only used if it is
+// a known code (the example of a location or the target of an alias),
+// since loose patterns (e.g. "^LIB.*") would accept any title in uppercase.
+// It returns false if none of them matches a location.
+func (c *Catalog) CanonicalCode(code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if c.Lookup(code) != nil {
+		return code, true
+	}
+	if canonical, ok := c.aliases[normalizeAlias(code)]; ok {
+		return canonical, true
+	}
+	if upper := strings.ToUpper(code); c.isKnownCode(upper) {
+		return upper, true
+	}
+	return code, false
+}
+
+// isKnownCode returns whether the code is the example of a location or the
+// target of an alias.
+func (c *Catalog) isKnownCode(code string) bool {
+	for _, l := range c.Locations {
+		if l.Example == code {
+			return true
+		}
+	}
+	for _, target := range c.aliases {
+		if target == code {
+			return true
+		}
+	}
+	return false
+}
+
+// LocationType returns the location type with the given status, or nil if
+// the status isn't part of the catalog.
+func (c *Catalog) LocationType(status LocationStatus) *LocationType {
+	for i := range c.Locations {
+		if c.Locations[i].Status == status {
+			return &c.Locations[i]
+		}
+	}
+	return nil
+}
+
+// DetermineStatus interprets the location code from the event title.
+func (c *Catalog) DetermineStatus(locationCode string) LocationStatus {
+	if l := c.Lookup(locationCode); l != nil {
+		return l.Status
+	}
+	return StatusUnknown
+}
+
+// ColorID returns the color ID which should be given to events with the
+// given status.
+func (c *Catalog) ColorID(status LocationStatus) string {
+	if l := c.LocationType(status); l != nil {
+		return l.ColorID
+	}
+	return c.UnknownColorID
+}
+
+// ValidTitles returns a human-readable description of the titles accepted
+// by each location type (e.g. "HOM (Home)").
+func (c *Catalog) ValidTitles() []string {
+	titles := make([]string, 0, len(c.Locations))
+	for _, l := range c.Locations {
+		if l.Example != "" {
+			titles = append(titles, fmt.Sprintf("%s (%s)", l.Example, l.Status))
+		} else {
+			titles = append(titles, fmt.Sprintf("titles matching %s (%s)", l.Pattern, l.Status))
+		}
+	}
+	return titles
+}
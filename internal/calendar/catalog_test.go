@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+)
+
+// testCatalog returns the default catalog with the given extra location
+// types.
+func testCatalog(t *testing.T, extra ...LocationType) *Catalog {
+	t.Helper()
+	c := DefaultCatalog()
+	c.Locations = append(c.Locations, extra...)
+	if err := c.compile(); err != nil {
+		t.Fatalf("invalid test catalog: %v", err)
+	}
+	return c
+}
+
+func TestAddReservedCode(t *testing.T) {
+	festive := LocationType{Status: StatusHoliday, Pattern: `^FES$`, ColorID: "11", Category: "Time off"}
+	weekend := LocationType{Status: "Weekend", Pattern: `^W$`, ColorID: "8", Category: "Time off"}
+
+	for _, tc := range []struct {
+		name  string
+		extra []LocationType
+		code  string
+		// Status of the codes once the code has been added.
+		wantStatus map[string]LocationStatus
+		wantErr    string
+	}{
+		{
+			name:       "new code",
+			code:       "H",
+			wantStatus: map[string]LocationStatus{"H": StatusHoliday},
+		},
+		{
+			name: "empty code",
+			code: "",
+		},
+		{
+			name:       "status already in the catalog",
+			extra:      []LocationType{festive},
+			code:       "HOL",
+			wantStatus: map[string]LocationStatus{"HOL": StatusHoliday, "FES": StatusHoliday},
+		},
+		{
+			name:       "code of another non-working location",
+			extra:      []LocationType{weekend},
+			code:       "W",
+			wantStatus: map[string]LocationStatus{"W": "Weekend"},
+		},
+		{
+			name:    "code of a working location",
+			code:    "LIB-HOLIDAY",
+			wantErr: `pattern "^LIB.*" of status "Library"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testCatalog(t, tc.extra...)
+			err := c.AddReservedCode(tc.code, StatusHoliday, "Holiday")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("AddReservedCode(%q) = %v, want an error with %q", tc.code, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddReservedCode(%q) failed: %v", tc.code, err)
+			}
+			for code, want := range tc.wantStatus {
+				if got := c.DetermineStatus(code); got != want {
+					t.Errorf("status of %q = %q, want %q", code, got, want)
+				}
+			}
+			if got := c.DetermineStatus("HOM"); got != "Home" {
+				t.Errorf("status of HOM = %q, want Home", got)
+			}
+		})
+	}
+}
+
+func TestCanonicalCode(t *testing.T) {
+	c := testCatalog(t)
+	c.Aliases["library central"] = "LIB-CENTRAL"
+	if err := c.compile(); err != nil {
+		t.Fatalf("invalid test catalog: %v", err)
+	}
+
+	for _, tc := range []struct {
+		code   string
+		want   string
+		wantOk bool
+	}{
+		{"HOM", "HOM", true},
+		{"hom", "HOM", true},
+		{"home", "HOM", true},
+		{"Library Central", "LIB-CENTRAL", true},
+		{"lib-central", "LIB-CENTRAL", true},
+		// Uppercase titles which only match a loose pattern aren't
+		// known codes.
+		{"library north", "library north", false},
+		{"p13abc101", "p13abc101", false},
+		{"LIB-NORTH", "LIB-NORTH", true},
+	} {
+		got, ok := c.CanonicalCode(tc.code)
+		if got != tc.want || ok != tc.wantOk {
+			t.Errorf("CanonicalCode(%q) = (%q, %v), want (%q, %v)", tc.code, got, ok, tc.want, tc.wantOk)
+		}
+	}
+}
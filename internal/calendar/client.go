@@ -3,6 +3,8 @@ package calendar
 import (
 	"context"
 	"fmt"
+	"net/http"
+
 	"gomodules.avm99963.com/zenithplanner/internal/config"
 
 	"golang.org/x/oauth2"
@@ -11,9 +13,10 @@ import (
 	"google.golang.org/api/option"
 )
 
-// NewService creates an authenticated Google Calendar service client.
-// It uses the provided refresh token to obtain access tokens automatically.
-func NewService(ctx context.Context, googleCfg config.GoogleConfig) (*calendar.Service, error) {
+// NewHTTPClient creates an HTTP client authenticated for the Google
+// Calendar API. It uses the provided refresh token to obtain access tokens
+// automatically.
+func NewHTTPClient(ctx context.Context, googleCfg config.GoogleConfig) (*http.Client, error) {
 	if googleCfg.RefreshToken == "" {
 		return nil, fmt.Errorf("google refresh token is required")
 	}
@@ -33,9 +36,13 @@ func NewService(ctx context.Context, googleCfg config.GoogleConfig) (*calendar.S
 	token := &oauth2.Token{
 		RefreshToken: googleCfg.RefreshToken,
 	}
-	tokenSource := oauthConfig.TokenSource(ctx, token)
+	return oauth2.NewClient(ctx, oauthConfig.TokenSource(ctx, token)), nil
+}
 
-	srv, err := calendar.NewService(ctx, option.WithTokenSource(tokenSource))
+// NewService creates a Google Calendar service client which sends the
+// requests with the given HTTP client (see NewHTTPClient).
+func NewService(ctx context.Context, httpClient *http.Client) (*calendar.Service, error) {
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Calendar client: %w", err)
 	}
@@ -0,0 +1,160 @@
+package calendar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DayHalf identifies one of the halves of a day.
+type DayHalf string
+
+const (
+	HalfMorning   DayHalf = "AM"
+	HalfAfternoon DayHalf = "PM"
+)
+
+// Split day color rules. Any other value of Catalog.SplitDayColorRule is
+// interpreted as a fixed color ID.
+const (
+	SplitDayColorMorning   = "morning"
+	SplitDayColorAfternoon = "afternoon"
+)
+
+// amPmRegex matches split titles in the "AM:HOM PM:P12GRAN303" format.
+var amPmRegex = regexp.MustCompile(`^AM:\s*(\S+)\s+PM:\s*(\S+)$`)
+
+// looseAmPmRegex matches split titles in the AM/PM format written
+// carelessly (e.g. "am: home pm: p12gran303").
+var looseAmPmRegex = regexp.MustCompile(`(?i)^AM:\s*(.+?)\s+PM:\s*(.+)$`)
+
+// DaySegment is the location of a half of a day.
+type DaySegment struct {
+	Half         DayHalf
+	LocationCode string
+	Status       LocationStatus
+}
+
+// DayLocation is the location of a day, as interpreted from an event
+// title. Days without a split title have the same location in both
+// halves.
+type DayLocation struct {
+	// Location code of the whole day (the event title).
+	Code      string
+	Morning   DaySegment
+	Afternoon DaySegment
+}
+
+// IsSplit returns whether the day has different locations in each half.
+func (d DayLocation) IsSplit() bool {
+	return d.Morning.LocationCode != d.Afternoon.LocationCode
+}
+
+// IsKnown returns whether all the halves of the day match a location of
+// the catalog.
+func (d DayLocation) IsKnown() bool {
+	return d.Morning.Status != StatusUnknown && d.Afternoon.Status != StatusUnknown
+}
+
+// Segments returns the segments of the day in chronological order.
+func (d DayLocation) Segments() []DaySegment {
+	return []DaySegment{d.Morning, d.Afternoon}
+}
+
+// ParseDayLocation interprets an event title, which can either be a single
+// location code or a split title such as "HOM/LIB-CENTRAL" or
+// "AM:HOM PM:P12GRAN303".
+func (c *Catalog) ParseDayLocation(title string) DayLocation {
+	if m := amPmRegex.FindStringSubmatch(title); m != nil {
+		return c.splitDayLocation(title, m[1], m[2])
+	}
+
+	// Titles with a slash are only considered split if both halves are
+	// known locations, so single codes containing slashes keep working.
+	if parts := strings.Split(title, "/"); len(parts) == 2 {
+		morning, afternoon := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if c.Lookup(morning) != nil && c.Lookup(afternoon) != nil {
+			return c.splitDayLocation(title, morning, afternoon)
+		}
+	}
+
+	status := c.DetermineStatus(title)
+	return DayLocation{
+		Code:      title,
+		Morning:   DaySegment{Half: HalfMorning, LocationCode: title, Status: status},
+		Afternoon: DaySegment{Half: HalfAfternoon, LocationCode: title, Status: status},
+	}
+}
+
+// CanonicalTitle returns the canonical form of a free-form event title
+// (e.g. "HOM" for "home", or "HOM/LIB-CENTRAL" for "hom/library central"),
+// by resolving aliases and case differences of the title or each of its
+// halves. Titles which can't be interpreted are returned trimmed but
+// otherwise unchanged.
+func (c *Catalog) CanonicalTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if c.ParseDayLocation(title).IsKnown() {
+		return title
+	}
+	if code, ok := c.CanonicalCode(title); ok {
+		return code
+	}
+
+	if m := looseAmPmRegex.FindStringSubmatch(title); m != nil {
+		morning, morningOk := c.CanonicalCode(m[1])
+		afternoon, afternoonOk := c.CanonicalCode(m[2])
+		if morningOk && afternoonOk {
+			return fmt.Sprintf("AM:%s PM:%s", morning, afternoon)
+		}
+	}
+	if parts := strings.Split(title, "/"); len(parts) == 2 {
+		morning, morningOk := c.CanonicalCode(parts[0])
+		afternoon, afternoonOk := c.CanonicalCode(parts[1])
+		if morningOk && afternoonOk {
+			return morning + "/" + afternoon
+		}
+	}
+	return title
+}
+
+// NonWorkingDayLocation returns the location of a non-working day which
+// doesn't have any event.
+func NonWorkingDayLocation() DayLocation {
+	return DayLocation{
+		Code:      "",
+		Morning:   DaySegment{Half: HalfMorning, LocationCode: "", Status: StatusNonWorking},
+		Afternoon: DaySegment{Half: HalfAfternoon, LocationCode: "", Status: StatusNonWorking},
+	}
+}
+
+func (c *Catalog) splitDayLocation(title, morningCode, afternoonCode string) DayLocation {
+	return DayLocation{
+		Code:      title,
+		Morning:   DaySegment{Half: HalfMorning, LocationCode: morningCode, Status: c.DetermineStatus(morningCode)},
+		Afternoon: DaySegment{Half: HalfAfternoon, LocationCode: afternoonCode, Status: c.DetermineStatus(afternoonCode)},
+	}
+}
+
+// DayStatus returns the status which represents the whole day. For split
+// days, it is the status of the half selected by the split day color
+// rule (the morning for fixed colors).
+func (c *Catalog) DayStatus(d DayLocation) LocationStatus {
+	if c.SplitDayColorRule == SplitDayColorAfternoon {
+		return d.Afternoon.Status
+	}
+	return d.Morning.Status
+}
+
+// DayColorID returns the color ID which should be given to the event of
+// the given day.
+func (c *Catalog) DayColorID(d DayLocation) string {
+	if !d.IsSplit() {
+		return c.ColorID(d.Morning.Status)
+	}
+	switch c.SplitDayColorRule {
+	case SplitDayColorMorning, SplitDayColorAfternoon:
+		return c.ColorID(c.DayStatus(d))
+	default:
+		return c.SplitDayColorRule
+	}
+}
@@ -0,0 +1,69 @@
+package calendar
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// tagLineRegex matches description lines with a "key: value" tag. Keys
+// can't contain spaces, so that prose (e.g. "Meeting with John: budget")
+// isn't taken as a tag, and the colon must be followed by a space so that
+// URLs aren't either.
+var tagLineRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]{0,39}):\s+(\S.*)$`)
+
+// htmlLineBreakRegex and htmlTagRegex are used to convert the HTML
+// descriptions written with the Google Calendar web UI into plain text.
+var (
+	htmlLineBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlTagRegex       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// descriptionTagKey is the key of the ZenithPlanner tag when parsed as a
+// "key: value" tag.
+const descriptionTagKey = "add-to-zenithplanner"
+
+// DescriptionData is the information written by the user in the
+// description of an event.
+type DescriptionData struct {
+	// Free-form text which isn't part of a tag (e.g. "with team").
+	Note string
+	// Tags written as "key: value" lines (e.g. "desk: 14"). Keys are
+	// lowercase.
+	Tags map[string]string
+}
+
+// ParseDescription splits an event description into a free-form note and
+// "key: value" tags. Tags are only parsed from the block of tag lines at
+// the end of the description, so lines in the middle of the note are
+// kept. The ZenithPlanner tag is ignored.
+func ParseDescription(description string) DescriptionData {
+	data := DescriptionData{Tags: map[string]string{}}
+
+	text := StripDescriptionTag(description)
+	if strings.Contains(text, "<") {
+		text = htmlLineBreakRegex.ReplaceAllString(text, "\n")
+		text = htmlTagRegex.ReplaceAllString(text, "")
+	}
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	tagsStart := len(lines)
+	for tagsStart > 0 && tagLineRegex.MatchString(lines[tagsStart-1]) {
+		tagsStart--
+	}
+	for _, line := range lines[tagsStart:] {
+		m := tagLineRegex.FindStringSubmatch(line)
+		if key := strings.ToLower(m[1]); key != descriptionTagKey {
+			data.Tags[key] = strings.TrimSpace(m[2])
+		}
+	}
+	data.Note = strings.Join(lines[:tagsStart], "\n")
+	return data
+}
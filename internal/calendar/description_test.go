@@ -0,0 +1,53 @@
+package calendar
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseDescription(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		description string
+		wantNote    string
+		wantTags    map[string]string
+	}{
+		{
+			name:        "note and tags",
+			description: "with team\ndesk: 14\nFloor: 3",
+			wantNote:    "with team",
+			wantTags:    map[string]string{"desk": "14", "floor": "3"},
+		},
+		{
+			name:        "prose with a colon",
+			description: "Meeting with John: discuss budget",
+			wantNote:    "Meeting with John: discuss budget",
+			wantTags:    map[string]string{},
+		},
+		{
+			name:        "tag line in the middle of the note",
+			description: "Agenda: budget\nbring the slides\ndesk: 14",
+			wantNote:    "Agenda: budget\nbring the slides",
+			wantTags:    map[string]string{"desk": "14"},
+		},
+		{
+			name:        "URL",
+			description: "https://example.com/room",
+			wantNote:    "https://example.com/room",
+			wantTags:    map[string]string{},
+		},
+		{
+			name:        "ZenithPlanner tag and HTML",
+			description: "Add-To-ZenithPlanner: true<br>with <b>team</b><br>desk: 14",
+			wantNote:    "with team",
+			wantTags:    map[string]string{"desk": "14"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParseDescription(tc.description)
+			if got.Note != tc.wantNote || !maps.Equal(got.Tags, tc.wantTags) {
+				t.Errorf("ParseDescription(%q) = (%q, %v), want (%q, %v)", tc.description, got.Note, got.Tags, tc.wantNote, tc.wantTags)
+			}
+		})
+	}
+}
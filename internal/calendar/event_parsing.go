@@ -2,24 +2,15 @@ package calendar
 
 import (
 	"log"
-	"regexp"
 	"strings"
 	"time"
 
 	gcal "google.golang.org/api/calendar/v3"
 )
 
-// Regex patterns for location codes
-var (
-	homeRegex     = regexp.MustCompile(`^HOM$`)
-	officeRegex   = regexp.MustCompile(`^P\d{2}[A-Z]+\d{3}$`) // e.g. P12GRAN303
-	libraryRegex  = regexp.MustCompile(`^LIB.*`)
-	vacationRegex = regexp.MustCompile(`^V$`)
-)
-
 // ParseEvent determines if an event is managed, and extracts location info.
 // It returns a ManagedEventInfo struct and a boolean indicating if it's managed.
-func ParseEvent(event *gcal.Event, colorMap map[LocationStatus]string) (*ManagedEventInfo, bool) {
+func ParseEvent(event *gcal.Event, catalog *Catalog) (*ManagedEventInfo, bool) {
 	isManagedProp := HasManagedProperty(event)
 	isManagedDesc := HasDescriptionTag(event)
 
@@ -28,43 +19,64 @@ func ParseEvent(event *gcal.Event, colorMap map[LocationStatus]string) (*Managed
 		return nil, false
 	}
 
+	return parseEventInfo(event, catalog, isManagedProp, isManagedDesc)
+}
+
+// ParseKnownEvent is like ParseEvent, but it also accepts events which
+// aren't managed if their title is a known location. It is used with
+// read-only calendars, where events can't be tagged.
+func ParseKnownEvent(event *gcal.Event, catalog *Catalog) (*ManagedEventInfo, bool) {
+	isManagedProp := HasManagedProperty(event)
+	isManagedDesc := HasDescriptionTag(event)
+
+	if !isManagedProp && !isManagedDesc && !catalog.ParseDayLocation(catalog.CanonicalTitle(event.Summary)).IsKnown() {
+		return nil, false
+	}
+
+	return parseEventInfo(event, catalog, isManagedProp, isManagedDesc)
+}
+
+// parseEventInfo extracts the location info of a single-day all-day event.
+func parseEventInfo(event *gcal.Event, catalog *Catalog, isManagedProp, isManagedDesc bool) (*ManagedEventInfo, bool) {
 	if event == nil || event.Start == nil || event.Start.Date == "" {
-		log.Println("Warning: event %s isn't a full-day event. Ignoring it.", event.Id)
+		log.Printf("Warning: event %s isn't a full-day event. Ignoring it.", event.Id)
 		return nil, false
 	}
 
 	date, err := time.Parse("2006-01-02", event.Start.Date)
 	if err != nil {
-		log.Println("Warning: start date cannot be parsed from event with id %s", event.Id)
+		log.Printf("Warning: start date cannot be parsed from event with id %s", event.Id)
 		return nil, false
 	}
 
 	endDate, err := time.Parse("2006-01-02", event.End.Date)
 	if err != nil {
-		log.Println("Warning: end date cannot be parsed from event with id %s", event.Id)
+		log.Printf("Warning: end date cannot be parsed from event with id %s", event.Id)
 		return nil, false
 	}
 
 	if date.AddDate(0, 0, 1) != endDate {
-		log.Println("Warning: event %s is a full-day event spanning multiple days. Ignoring it.", event.Id)
+		log.Printf("Warning: event %s is a full-day event spanning multiple days. It can't be parsed as a single day.", event.Id)
 		return nil, false
 	}
 
 	updatedTs, err := time.Parse(time.RFC3339, event.Updated)
 	if err != nil {
-		log.Println("Warning: updated timestamp cannot be parsed from event with id %s", event.Id)
+		log.Printf("Warning: updated timestamp cannot be parsed from event with id %s", event.Id)
 		return nil, false
 	}
 
 	locationCode := strings.TrimSpace(event.Summary)
-	status := DetermineStatus(locationCode)
-	expectedColor := colorMap[status]
+	dayLocation := catalog.ParseDayLocation(locationCode)
+	status := catalog.DayStatus(dayLocation)
+	expectedColor := catalog.DayColorID(dayLocation)
 
 	info := &ManagedEventInfo{
 		EventID:           event.Id,
 		Date:              date,
 		LocationCode:      locationCode,
 		Status:            status,
+		DayLocation:       dayLocation,
 		Description:       event.Description,
 		UpdatedTs:         updatedTs,
 		IsManagedProperty: isManagedProp,
@@ -78,31 +90,38 @@ func ParseEvent(event *gcal.Event, colorMap map[LocationStatus]string) (*Managed
 	if event.RecurringEventId == "" {
 		info.RecurringEventID = nil
 	}
+	if autoDefaultCode := AutoDefaultCode(event); autoDefaultCode != "" {
+		info.AutoDefaultCode = &autoDefaultCode
+	}
 	if event.OriginalStartTime != nil {
 		ost, err := time.Parse(time.RFC3339, event.OriginalStartTime.DateTime)
 		if err == nil {
 			info.OriginalStartTime = &ost
 		} else {
-			log.Println("Warning: original start time cannot be parsed from event with id %s", event.Id)
+			log.Printf("Warning: original start time cannot be parsed from event with id %s", event.Id)
 		}
 	}
 
 	return info, true
 }
 
-// DetermineStatus interprets the location code from the event title.
-func DetermineStatus(locationCode string) LocationStatus {
-	if homeRegex.MatchString(locationCode) {
-		return StatusHome
+// MultiDayRange returns the first and last dates covered by an all-day
+// event spanning multiple days. ok is false for any other event.
+func MultiDayRange(event *gcal.Event) (first, last time.Time, ok bool) {
+	if event == nil || event.Start == nil || event.End == nil || event.Start.Date == "" || event.End.Date == "" {
+		return time.Time{}, time.Time{}, false
 	}
-	if vacationRegex.MatchString(locationCode) {
-		return StatusVacation
+	start, err := time.Parse("2006-01-02", event.Start.Date)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
 	}
-	if officeRegex.MatchString(locationCode) {
-		return StatusOffice
+	end, err := time.Parse("2006-01-02", event.End.Date)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
 	}
-	if libraryRegex.MatchString(locationCode) {
-		return StatusLibrary
+	last = end.AddDate(0, 0, -1)
+	if !last.After(start) {
+		return time.Time{}, time.Time{}, false
 	}
-	return StatusUnknown
+	return start, last, true
 }
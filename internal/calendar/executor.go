@@ -0,0 +1,344 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// Delay before the first retry of a request. It is doubled after each
+	// retry, up to maxRetryDelay.
+	baseRetryDelay = time.Second
+	maxRetryDelay  = time.Minute
+	// Maximum delay honored from a Retry-After header.
+	maxRetryAfter = 5 * time.Minute
+)
+
+// Executor sends the requests to the calendar. It limits how many are in
+// flight at the same time and their rate (with a token bucket), and
+// retries the ones which fail with a retryable error (see
+// IsRetryableError) with an exponential backoff with jitter, honoring the
+// Retry-After header. It is safe for concurrent use.
+type Executor struct {
+	slots      chan struct{}
+	bucket     *tokenBucket
+	maxRetries int
+	// Function used to wait between retries (replaceable for testing).
+	sleep func(ctx context.Context, d time.Duration) error
+	// Function which returns a random number in [0, 1), used for the
+	// jitter (replaceable for testing).
+	random func() float64
+}
+
+// NewExecutor creates an executor with the given limits.
+func NewExecutor(cfg config.CalendarAPIConfig) *Executor {
+	return &Executor{
+		slots:      make(chan struct{}, max(cfg.MaxConcurrentRequests, 1)),
+		bucket:     newTokenBucket(cfg.RequestsPerSecond, cfg.RequestBurst, time.Now),
+		maxRetries: cfg.MaxRetries,
+		sleep:      sleepContext,
+		random:     rand.Float64,
+	}
+}
+
+// Do executes a request (named name in the logs) with fn, retrying it if
+// it fails with a retryable error.
+func (e *Executor) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return e.do(ctx, name, 1, fn)
+}
+
+// do executes a request which counts as cost requests for the rate limit.
+func (e *Executor) do(ctx context.Context, name string, cost int, fn func(ctx context.Context) error) error {
+	for retries := 0; ; retries++ {
+		err := e.attempt(ctx, cost, fn)
+		if err == nil {
+			if retries > 0 {
+				log.Printf("Calendar API: %s succeeded after %d retries.", name, retries)
+			}
+			return nil
+		}
+		if !IsRetryableError(err) || retries >= e.maxRetries {
+			if retries > 0 {
+				log.Printf("Calendar API: %s failed after %d retries.", name, retries)
+			}
+			return err
+		}
+
+		delay := e.retryDelay(retries, err)
+		log.Printf("Calendar API: %s failed with a retryable error (retry %d of %d in %s): %v", name, retries+1, e.maxRetries, delay.Round(time.Millisecond), err)
+		if err := e.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// attempt sends a request once it gets a concurrency slot and enough
+// tokens from the bucket.
+func (e *Executor) attempt(ctx context.Context, cost int, fn func(ctx context.Context) error) error {
+	select {
+	case e.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-e.slots }()
+
+	if err := e.sleep(ctx, e.bucket.reserve(cost)); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+// retryDelay returns how long to wait before retrying a request which
+// failed with err after the given number of retries: the delay requested
+// by the server with Retry-After, or an exponential backoff with jitter
+// (between half and all of the backoff, so concurrent requests which fail
+// at the same time don't retry in lockstep).
+func (e *Executor) retryDelay(retries int, err error) time.Duration {
+	if delay, ok := retryAfter(err); ok {
+		return min(delay, maxRetryAfter)
+	}
+	backoff := min(baseRetryDelay<<min(retries, 16), maxRetryDelay)
+	return backoff/2 + time.Duration(e.random()*float64(backoff/2))
+}
+
+// IsRetryableError returns whether a request which failed with err can be
+// retried: rate limiting errors (429, or 403 with a rate limit reason) and
+// temporary server errors.
+func IsRetryableError(err error) bool {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) {
+		return false
+	}
+	switch gErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		for _, item := range gErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the
+// response which caused err, if any. The header can be a number of
+// seconds or an HTTP date.
+func retryAfter(err error) (time.Duration, bool) {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Header == nil {
+		return 0, false
+	}
+	value := gErr.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tokenBucket limits the rate of requests: it holds up to burst tokens,
+// refilled at rate tokens per second, and each request takes one.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket. A rate of 0 disables the limit.
+func newTokenBucket(rate float64, burst int, now func() time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		now:    now,
+		tokens: float64(max(burst, 1)),
+		last:   now(),
+	}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait until
+// they are available. Tokens can be reserved in advance, so concurrent
+// callers wait in turns.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// RateLimitedProvider is a CalendarProvider which sends the requests of
+// another one through an Executor.
+type RateLimitedProvider struct {
+	provider CalendarProvider
+	executor *Executor
+}
+
+// rateLimitedBatchProvider is a RateLimitedProvider whose provider
+// supports batches.
+type rateLimitedBatchProvider struct {
+	*RateLimitedProvider
+	batchProvider BatchProvider
+}
+
+// NewRateLimitedProvider wraps provider so its requests are sent through
+// executor. The result implements BatchProvider if provider does.
+func NewRateLimitedProvider(provider CalendarProvider, executor *Executor) CalendarProvider {
+	p := &RateLimitedProvider{provider: provider, executor: executor}
+	if batchProvider, ok := provider.(BatchProvider); ok {
+		return &rateLimitedBatchProvider{RateLimitedProvider: p, batchProvider: batchProvider}
+	}
+	return p
+}
+
+func (p *RateLimitedProvider) ListEvents(ctx context.Context, opts ListOptions) (page *EventPage, err error) {
+	err = p.executor.Do(ctx, "list events", func(ctx context.Context) error {
+		page, err = p.provider.ListEvents(ctx, opts)
+		return err
+	})
+	return page, err
+}
+
+func (p *RateLimitedProvider) GetEvent(ctx context.Context, eventID string) (event *gcal.Event, err error) {
+	err = p.executor.Do(ctx, "get event "+eventID, func(ctx context.Context) error {
+		event, err = p.provider.GetEvent(ctx, eventID)
+		return err
+	})
+	return event, err
+}
+
+func (p *RateLimitedProvider) InsertEvent(ctx context.Context, event *gcal.Event) (created *gcal.Event, err error) {
+	err = p.executor.Do(ctx, "insert event "+event.Id, func(ctx context.Context) error {
+		created, err = p.provider.InsertEvent(ctx, event)
+		return err
+	})
+	return created, err
+}
+
+func (p *RateLimitedProvider) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (updated *gcal.Event, err error) {
+	err = p.executor.Do(ctx, "patch event "+eventID, func(ctx context.Context) error {
+		updated, err = p.provider.PatchEvent(ctx, eventID, patch)
+		return err
+	})
+	return updated, err
+}
+
+func (p *RateLimitedProvider) DeleteEvent(ctx context.Context, eventID string) error {
+	return p.executor.Do(ctx, "delete event "+eventID, func(ctx context.Context) error {
+		return p.provider.DeleteEvent(ctx, eventID)
+	})
+}
+
+func (p *RateLimitedProvider) Watch(ctx context.Context, channel *gcal.Channel) (created *gcal.Channel, err error) {
+	err = p.executor.Do(ctx, "watch calendar", func(ctx context.Context) error {
+		created, err = p.provider.Watch(ctx, channel)
+		return err
+	})
+	return created, err
+}
+
+func (p *RateLimitedProvider) StopChannel(ctx context.Context, channel *gcal.Channel) error {
+	return p.executor.Do(ctx, "stop channel "+channel.Id, func(ctx context.Context) error {
+		return p.provider.StopChannel(ctx, channel)
+	})
+}
+
+// ExecuteBatch implements BatchProvider. Besides retrying the whole batch,
+// the operations which fail with a retryable error are retried in a
+// smaller batch.
+func (p *rateLimitedBatchProvider) ExecuteBatch(ctx context.Context, ops []BatchOperation) ([]error, error) {
+	errs := make([]error, len(ops))
+	pending := make([]int, len(ops))
+	for i := range ops {
+		pending[i] = i
+	}
+
+	name := fmt.Sprintf("batch of %d operations", len(ops))
+	for retries := 0; ; retries++ {
+		batch := make([]BatchOperation, len(pending))
+		for i, index := range pending {
+			batch[i] = ops[index]
+		}
+		var batchErrs []error
+		err := p.executor.do(ctx, name, len(batch), func(ctx context.Context) error {
+			var err error
+			batchErrs, err = p.batchProvider.ExecuteBatch(ctx, batch)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var retryable []int
+		var retryErr error
+		for i, index := range pending {
+			errs[index] = batchErrs[i]
+			if IsRetryableError(batchErrs[i]) {
+				retryable = append(retryable, index)
+				retryErr = batchErrs[i]
+			}
+		}
+		if len(retryable) == 0 {
+			if retries > 0 {
+				log.Printf("Calendar API: %s completed after %d retries.", name, retries)
+			}
+			return errs, nil
+		}
+		if retries >= p.executor.maxRetries {
+			log.Printf("Calendar API: %d operations of the %s failed after %d retries.", len(retryable), name, retries)
+			return errs, nil
+		}
+
+		delay := p.executor.retryDelay(retries, retryErr)
+		log.Printf("Calendar API: %d operations of the %s failed with a retryable error (retry %d of %d in %s): %v", len(retryable), name, retries+1, p.executor.maxRetries, delay.Round(time.Millisecond), retryErr)
+		if err := p.executor.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		pending = retryable
+	}
+}
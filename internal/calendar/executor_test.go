@@ -0,0 +1,232 @@
+package calendar
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// newTestExecutor returns an executor without rate limit which records
+// the delays instead of sleeping.
+func newTestExecutor(maxRetries int) (*Executor, *[]time.Duration) {
+	var delays []time.Duration
+	e := NewExecutor(config.CalendarAPIConfig{MaxConcurrentRequests: 4, RequestBurst: 1, MaxRetries: maxRetries})
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		if d > 0 {
+			delays = append(delays, d)
+		}
+		return nil
+	}
+	e.random = func() float64 { return 0.5 }
+	return e, &delays
+}
+
+// failingFn returns a function which fails with the given errors before
+// succeeding, and counts the calls.
+func failingFn(calls *int, errs ...error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func rateLimitError(reason string) *googleapi.Error {
+	return &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: reason}},
+	}
+}
+
+func TestExecutorRetriesWithBackoff(t *testing.T) {
+	e, delays := newTestExecutor(5)
+	calls := 0
+	err := e.Do(context.Background(), "test", failingFn(&calls,
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+		rateLimitError("rateLimitExceeded"),
+		&googleapi.Error{Code: http.StatusServiceUnavailable},
+	))
+	if err != nil {
+		t.Fatalf("Do() = %v, want success", err)
+	}
+	if calls != 4 {
+		t.Errorf("the request was sent %d times, want 4", calls)
+	}
+	// Half of the backoff plus half of the remaining half as jitter.
+	want := []time.Duration{750 * time.Millisecond, 1500 * time.Millisecond, 3 * time.Second}
+	if len(*delays) != len(want) {
+		t.Fatalf("delays = %v, want %v", *delays, want)
+	}
+	for i := range want {
+		if (*delays)[i] != want[i] {
+			t.Errorf("delays = %v, want %v", *delays, want)
+			break
+		}
+	}
+}
+
+func TestExecutorHonorsRetryAfter(t *testing.T) {
+	e, delays := newTestExecutor(5)
+	calls := 0
+	err := e.Do(context.Background(), "test", failingFn(&calls, &googleapi.Error{
+		Code:   http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": []string{"7"}},
+	}))
+	if err != nil {
+		t.Fatalf("Do() = %v, want success", err)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 7*time.Second {
+		t.Errorf("delays = %v, want [7s]", *delays)
+	}
+}
+
+func TestExecutorDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		rateLimitError("forbidden"),
+		&googleapi.Error{Code: http.StatusNotFound},
+		&googleapi.Error{Code: http.StatusConflict},
+	} {
+		e, _ := newTestExecutor(5)
+		calls := 0
+		if got := e.Do(context.Background(), "test", failingFn(&calls, err)); got != err {
+			t.Errorf("Do() = %v, want %v", got, err)
+		}
+		if calls != 1 {
+			t.Errorf("the request which failed with %v was sent %d times, want 1", err, calls)
+		}
+	}
+}
+
+func TestExecutorGivesUpAfterMaxRetries(t *testing.T) {
+	e, _ := newTestExecutor(2)
+	calls := 0
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	err := e.Do(context.Background(), "test", failingFn(&calls, unavailable, unavailable, unavailable, unavailable))
+	if err != unavailable {
+		t.Errorf("Do() = %v, want %v", err, unavailable)
+	}
+	if calls != 3 {
+		t.Errorf("the request was sent %d times, want 3", calls)
+	}
+}
+
+func TestExecutorLimitsConcurrency(t *testing.T) {
+	e := NewExecutor(config.CalendarAPIConfig{MaxConcurrentRequests: 2, RequestBurst: 1})
+	var inFlight, maxInFlight atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Do(context.Background(), "test", func(ctx context.Context) error {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					previous := maxInFlight.Load()
+					if current <= previous || maxInFlight.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("%d requests were in flight at the same time, want 2", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(2, 2, func() time.Time { return now })
+
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got := b.reserve(1); got != want {
+			t.Errorf("reservation %d waits %s, want %s", i, got, want)
+		}
+	}
+
+	// After 2 seconds the 2 reserved tokens have been refilled, plus 2 more
+	// which fill the bucket.
+	now = now.Add(2 * time.Second)
+	if got := b.reserve(2); got != 0 {
+		t.Errorf("reservation after refilling waits %s, want 0", got)
+	}
+	if got := b.reserve(4); got != 2*time.Second {
+		t.Errorf("reservation of 4 tokens waits %s, want 2s", got)
+	}
+}
+
+// fakeBatchProvider is a BatchProvider whose operations fail with the
+// errors in failures (consumed in order) before succeeding.
+type fakeBatchProvider struct {
+	CalendarProvider
+	failures map[string][]error
+	batches  [][]BatchOperation
+}
+
+func (p *fakeBatchProvider) ExecuteBatch(ctx context.Context, ops []BatchOperation) ([]error, error) {
+	p.batches = append(p.batches, ops)
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		id := op.DeleteEventID
+		if op.Insert != nil {
+			id = op.Insert.Id
+		}
+		if failures := p.failures[id]; len(failures) > 0 {
+			errs[i] = failures[0]
+			p.failures[id] = failures[1:]
+		}
+	}
+	return errs, nil
+}
+
+func TestRateLimitedProviderRetriesBatchOperations(t *testing.T) {
+	e, delays := newTestExecutor(5)
+	notFound := &googleapi.Error{Code: http.StatusNotFound}
+	inner := &fakeBatchProvider{failures: map[string][]error{
+		"b": {&googleapi.Error{Code: http.StatusTooManyRequests}},
+		"c": {notFound},
+	}}
+	provider, ok := NewRateLimitedProvider(inner, e).(BatchProvider)
+	if !ok {
+		t.Fatalf("the rate limited provider doesn't support batches")
+	}
+
+	errs, err := provider.ExecuteBatch(context.Background(), []BatchOperation{
+		{Insert: &gcal.Event{Id: "a"}},
+		{Insert: &gcal.Event{Id: "b"}},
+		{DeleteEventID: "c"},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteBatch() failed: %v", err)
+	}
+	if errs[0] != nil || errs[1] != nil || errs[2] != notFound {
+		t.Errorf("ExecuteBatch() errors = %v, want [nil nil %v]", errs, notFound)
+	}
+	if len(inner.batches) != 2 || len(inner.batches[1]) != 1 || inner.batches[1][0].Insert.Id != "b" {
+		t.Errorf("batches = %v, want the rate limited operation to be retried alone", inner.batches)
+	}
+	if len(*delays) != 1 {
+		t.Errorf("delays = %v, want a single backoff", *delays)
+	}
+}
+
+func TestRateLimitedProviderOnlySupportsBatchesIfWrappedProviderDoes(t *testing.T) {
+	type plainProvider struct{ CalendarProvider }
+	if _, ok := NewRateLimitedProvider(plainProvider{}, NewExecutor(config.CalendarAPIConfig{})).(BatchProvider); ok {
+		t.Errorf("the rate limited provider supports batches, but the wrapped one doesn't")
+	}
+}
@@ -8,7 +8,10 @@ import (
 
 const (
 	ManagedPropertyKey = "zenithplanner_managed"
-	descriptionTag     = "Add-To-ZenithPlanner: true"
+	// AutoDefaultPropertyKey holds the location code of events created
+	// automatically by ZenithPlanner (e.g. by the horizon maintenance).
+	AutoDefaultPropertyKey = "zenithplanner_auto_default"
+	descriptionTag         = "Add-To-ZenithPlanner: true"
 )
 
 // HasManagedProperty checks if the event has the ZenithPlanner private property.
@@ -55,10 +58,8 @@ func RemoveDescriptionTag(event *gcal.Event) *gcal.Event {
 	if !HasDescriptionTag(event) {
 		return nil
 	}
-	newDesc := strings.ReplaceAll(event.Description, descriptionTag+"\n", "")
-	newDesc = strings.ReplaceAll(newDesc, descriptionTag, "") // Remove if it's the only line
 	patch := &gcal.Event{
-		Description: strings.TrimSpace(newDesc),
+		Description: StripDescriptionTag(event.Description),
 		ForceSendFields: []string{"Description"},
 	}
 	return patch
@@ -75,3 +76,56 @@ func SetColor(event *gcal.Event, targetColorId string) *gcal.Event {
 		ForceSendFields: []string{"ColorId"},
 	}
 }
+
+// StripDescriptionTag returns the description without the ZenithPlanner
+// tag.
+func StripDescriptionTag(description string) string {
+	newDesc := strings.ReplaceAll(description, descriptionTag+"\n", "")
+	newDesc = strings.ReplaceAll(newDesc, descriptionTag, "") // Remove if it's the only line
+	return strings.TrimSpace(newDesc)
+}
+
+// AutoDefaultCode returns the location code the event was automatically
+// created with, or "" if it was created by the user.
+func AutoDefaultCode(event *gcal.Event) string {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return ""
+	}
+	return event.ExtendedProperties.Private[AutoDefaultPropertyKey]
+}
+
+// SetTitle prepares an Event object patch to set the title.
+// Returns nil if the title is already correct.
+func SetTitle(event *gcal.Event, title string) *gcal.Event {
+	if event.Summary == title {
+		return nil
+	}
+	return &gcal.Event{
+		Summary:         title,
+		ForceSendFields: []string{"Summary"},
+	}
+}
+
+// SetAutoDefaultTitle prepares an Event object patch which changes the
+// title of an automatically created event, keeping track of the new
+// location code in its private properties.
+func SetAutoDefaultTitle(event *gcal.Event, locationCode string) *gcal.Event {
+	patch := &gcal.Event{
+		Summary: locationCode,
+		ExtendedProperties: &gcal.EventExtendedProperties{
+			Private: map[string]string{
+				ManagedPropertyKey:     "true",
+				AutoDefaultPropertyKey: locationCode,
+			},
+		},
+		ForceSendFields: []string{"Summary"},
+	}
+	if event.ExtendedProperties != nil && event.ExtendedProperties.Private != nil {
+		for k, v := range event.ExtendedProperties.Private {
+			if _, exists := patch.ExtendedProperties.Private[k]; !exists {
+				patch.ExtendedProperties.Private[k] = v
+			}
+		}
+	}
+	return patch
+}
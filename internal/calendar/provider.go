@@ -0,0 +1,192 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// eventListFields are the event fields needed by the sync code.
+const eventListFields = "items(id,summary,description,start,end,updated,colorId,recurringEventId,originalStartTime,extendedProperties,status),nextPageToken,nextSyncToken"
+
+// ListOptions are the options of a CalendarProvider.ListEvents call.
+type ListOptions struct {
+	// Token of the page to retrieve ("" for the first one).
+	PageToken string
+	// If set, only the events which changed since the sync token was
+	// issued are returned, including cancelled (deleted) ones.
+	SyncToken string
+	// If set, only the events which end after TimeMin and start before
+	// TimeMax are returned. They can't be combined with SyncToken, but the
+	// sync token returned by a bounded listing covers the changes of all
+	// the events.
+	TimeMin time.Time
+	TimeMax time.Time
+}
+
+// InTimeRange returns whether an event is in the time range of the
+// options. All-day events are interpreted in the location of TimeMin (or
+// TimeMax). It is used by the providers which filter listings themselves.
+func (o ListOptions) InTimeRange(event *gcal.Event) bool {
+	if o.TimeMin.IsZero() && o.TimeMax.IsZero() {
+		return true
+	}
+	loc := o.TimeMin.Location()
+	if o.TimeMin.IsZero() {
+		loc = o.TimeMax.Location()
+	}
+	start, startOK := eventTime(event.Start, loc)
+	end, endOK := eventTime(event.End, loc)
+	if !startOK {
+		return true
+	}
+	if !endOK {
+		end = start
+	}
+	if !o.TimeMin.IsZero() && !end.After(o.TimeMin) {
+		return false
+	}
+	return o.TimeMax.IsZero() || start.Before(o.TimeMax)
+}
+
+// eventTime returns the instant of an event start or end.
+func eventTime(t *gcal.EventDateTime, loc *time.Location) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	if t.Date != "" {
+		date, err := time.ParseInLocation("2006-01-02", t.Date, loc)
+		return date, err == nil
+	}
+	dateTime, err := time.Parse(time.RFC3339, t.DateTime)
+	return dateTime, err == nil
+}
+
+// EventPage is a page of events returned by CalendarProvider.ListEvents.
+type EventPage struct {
+	Events []*gcal.Event
+	// Token of the next page, or "" if this is the last one.
+	NextPageToken string
+	// Token to retrieve the changes after this listing. Only set in the
+	// last page.
+	NextSyncToken string
+}
+
+// CalendarProvider is the calendar which holds the location events. It
+// follows the semantics of the Google Calendar API: recurring events are
+// expanded into their instances, and invalid sync tokens are reported
+// with a 410 Gone *googleapi.Error.
+type CalendarProvider interface {
+	// ListEvents returns a page of the events of the calendar.
+	ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error)
+	// GetEvent returns an event (or recurring event instance).
+	GetEvent(ctx context.Context, eventID string) (*gcal.Event, error)
+	// InsertEvent creates an event and returns it.
+	InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error)
+	// PatchEvent updates the fields set in patch (or listed in its
+	// ForceSendFields) and returns the updated event.
+	PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error)
+	// DeleteEvent deletes an event.
+	DeleteEvent(ctx context.Context, eventID string) error
+	// Watch creates a push notifications channel for the calendar events.
+	Watch(ctx context.Context, channel *gcal.Channel) (*gcal.Channel, error)
+	// StopChannel stops a push notifications channel.
+	StopChannel(ctx context.Context, channel *gcal.Channel) error
+}
+
+// MaxBatchSize is the maximum number of operations which can be sent to
+// BatchProvider.ExecuteBatch at once.
+const MaxBatchSize = 50
+
+// BatchOperation is an operation executed as part of a batch: the
+// insertion of Insert if it is set, or the deletion of DeleteEventID
+// otherwise.
+type BatchOperation struct {
+	Insert        *gcal.Event
+	DeleteEventID string
+}
+
+// BatchProvider is implemented by the calendar providers which can execute
+// several operations in a single request.
+type BatchProvider interface {
+	CalendarProvider
+	// ExecuteBatch executes up to MaxBatchSize operations, and returns the
+	// error of each one (nil if it succeeded). If the whole request fails,
+	// only the second return value is set.
+	ExecuteBatch(ctx context.Context, ops []BatchOperation) ([]error, error)
+}
+
+// GoogleProvider is a CalendarProvider backed by a Google Calendar.
+type GoogleProvider struct {
+	service    *gcal.Service
+	httpClient *http.Client
+	calendarID string
+}
+
+// NewGoogleProvider creates a provider for the calendar with the given ID.
+// The HTTP client must be the one used by the service, and is used to
+// send batch requests.
+func NewGoogleProvider(service *gcal.Service, httpClient *http.Client, calendarID string) *GoogleProvider {
+	return &GoogleProvider{
+		service:    service,
+		httpClient: httpClient,
+		calendarID: calendarID,
+	}
+}
+
+var _ BatchProvider = (*GoogleProvider)(nil)
+
+func (p *GoogleProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	call := p.service.Events.List(p.calendarID).
+		PageToken(opts.PageToken).
+		SingleEvents(true). // Important for recurrence handling
+		Fields(googleapi.Field(eventListFields)).
+		Context(ctx)
+	if opts.SyncToken != "" {
+		call = call.SyncToken(opts.SyncToken)
+	}
+	if !opts.TimeMin.IsZero() {
+		call = call.TimeMin(opts.TimeMin.Format(time.RFC3339))
+	}
+	if !opts.TimeMax.IsZero() {
+		call = call.TimeMax(opts.TimeMax.Format(time.RFC3339))
+	}
+
+	resp, err := call.Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendar events (page token: %s): %w", opts.PageToken, err)
+	}
+	return &EventPage{
+		Events:        resp.Items,
+		NextPageToken: resp.NextPageToken,
+		NextSyncToken: resp.NextSyncToken,
+	}, nil
+}
+
+func (p *GoogleProvider) GetEvent(ctx context.Context, eventID string) (*gcal.Event, error) {
+	return p.service.Events.Get(p.calendarID, eventID).Context(ctx).Do()
+}
+
+func (p *GoogleProvider) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	return p.service.Events.Insert(p.calendarID, event).Context(ctx).Do()
+}
+
+func (p *GoogleProvider) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error) {
+	return p.service.Events.Patch(p.calendarID, eventID, patch).Context(ctx).Do()
+}
+
+func (p *GoogleProvider) DeleteEvent(ctx context.Context, eventID string) error {
+	return p.service.Events.Delete(p.calendarID, eventID).Context(ctx).Do()
+}
+
+func (p *GoogleProvider) Watch(ctx context.Context, channel *gcal.Channel) (*gcal.Channel, error) {
+	return p.service.Events.Watch(p.calendarID, channel).Context(ctx).Do()
+}
+
+func (p *GoogleProvider) StopChannel(ctx context.Context, channel *gcal.Channel) error {
+	return p.service.Channels.Stop(channel).Context(ctx).Do()
+}
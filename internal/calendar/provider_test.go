@@ -0,0 +1,49 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+func TestListOptionsInTimeRange(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	opts := ListOptions{
+		TimeMin: time.Date(2025, 3, 10, 0, 0, 0, 0, madrid),
+		TimeMax: time.Date(2025, 3, 12, 0, 0, 0, 0, madrid),
+	}
+	allDay := func(start, end string) *gcal.Event {
+		return &gcal.Event{Start: &gcal.EventDateTime{Date: start}, End: &gcal.EventDateTime{Date: end}}
+	}
+	timed := func(start, end string) *gcal.Event {
+		return &gcal.Event{Start: &gcal.EventDateTime{DateTime: start}, End: &gcal.EventDateTime{DateTime: end}}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		event *gcal.Event
+		want  bool
+	}{
+		{"day before", allDay("2025-03-09", "2025-03-10"), false},
+		{"first day", allDay("2025-03-10", "2025-03-11"), true},
+		{"last day", allDay("2025-03-11", "2025-03-12"), true},
+		{"day after", allDay("2025-03-12", "2025-03-13"), false},
+		{"overlapping multi-day", allDay("2025-03-01", "2025-03-11"), true},
+		// 23:30 UTC is already March 10 in Madrid.
+		{"timed in range", timed("2025-03-09T23:30:00Z", "2025-03-09T23:45:00Z"), true},
+		{"timed before", timed("2025-03-09T22:00:00Z", "2025-03-09T22:30:00Z"), false},
+		{"without dates", &gcal.Event{Status: "cancelled"}, true},
+	} {
+		if got := opts.InTimeRange(tc.event); got != tc.want {
+			t.Errorf("InTimeRange(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if !(ListOptions{}).InTimeRange(allDay("2000-01-01", "2000-01-02")) {
+		t.Errorf("unbounded listings must include every event")
+	}
+}
@@ -5,14 +5,18 @@ import (
 )
 
 // LocationStatus represents the interpreted status from an event title.
+// The available statuses are defined by the location Catalog.
 type LocationStatus string
 
 const (
-	StatusHome     LocationStatus = "Home"
-	StatusOffice   LocationStatus = "Office"
-	StatusLibrary  LocationStatus = "Library"
-	StatusVacation LocationStatus = "Vacation"
-	StatusUnknown  LocationStatus = "Unknown"
+	// StatusUnknown is the status given to titles which don't match any
+	// location of the catalog.
+	StatusUnknown LocationStatus = "Unknown"
+	// StatusNonWorking is the status given to non-working days which
+	// don't have an explicit location.
+	StatusNonWorking LocationStatus = "NonWorking"
+	// StatusHoliday is the status given to the holiday code.
+	StatusHoliday LocationStatus = "Holiday"
 )
 
 // ManagedEventInfo holds extracted information about a managed event.
@@ -21,11 +25,13 @@ type ManagedEventInfo struct {
 	Date              time.Time
 	LocationCode      string
 	Status            LocationStatus
+	DayLocation       DayLocation
 	Description       string
 	UpdatedTs         time.Time
 	IsManagedProperty bool // True if identified via private property
 	IsManagedDescTag  bool // True if identified via description tag
 	ColorID           string
+	AutoDefaultCode   *string    // Code the event was auto-created with, if any
 	RecurringEventID  *string    // Pointer to handle null
 	OriginalStartTime *time.Time // Pointer to handle null
 	NeedsProperty     bool       // Flag if property needs to be added
@@ -0,0 +1,45 @@
+// Package calendarbackend creates the calendar provider of the configured
+// backend (Google Calendar, CalDAV or an iCalendar feed).
+package calendarbackend
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gomodules.avm99963.com/zenithplanner/internal/caldav"
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/icsfeed"
+)
+
+// NewProvider creates the provider of the calendar backend set in cfg.
+func NewProvider(ctx context.Context, cfg *config.Config) (calendar.CalendarProvider, error) {
+	switch cfg.CalendarBackend {
+	case config.CalendarBackendCalDAV:
+		provider, err := caldav.NewProvider(cfg.CalDAV)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CalDAV client: %w", err)
+		}
+		log.Println("CalDAV client initialized.")
+		return provider, nil
+	case config.CalendarBackendICS:
+		provider, err := icsfeed.NewProvider(cfg.ICSFeed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create iCalendar feed client: %w", err)
+		}
+		log.Println("iCalendar feed client initialized (read-only mode).")
+		return provider, nil
+	default:
+		httpClient, err := calendar.NewHTTPClient(ctx, cfg.Google)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Calendar client: %w", err)
+		}
+		calendarService, err := calendar.NewService(ctx, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Calendar client: %w", err)
+		}
+		log.Println("Google Calendar client initialized.")
+		return calendar.NewGoogleProvider(calendarService, httpClient, cfg.Google.CalendarID), nil
+	}
+}
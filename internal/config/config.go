@@ -5,15 +5,34 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	// Embed the timezone database so TIMEZONE works in minimal container
+	// images.
+	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
 )
 
+// Calendar backends which can be used.
+const (
+	CalendarBackendGoogle = "google"
+	CalendarBackendCalDAV = "caldav"
+	// Read-only iCalendar feed: the calendar is never modified.
+	CalendarBackendICS = "ics"
+)
+
 type Config struct {
-	Google GoogleConfig
-	App    AppConfig
-	DB     DBConfig
-	SMTP   SMTPConfig
+	// Calendar backend which holds the events: "google", "caldav" or
+	// "ics".
+	CalendarBackend string
+	Google          GoogleConfig
+	CalDAV          CalDAVConfig
+	ICSFeed         ICSFeedConfig
+	CalendarAPI     CalendarAPIConfig
+	App             AppConfig
+	DB              DBConfig
+	SMTP            SMTPConfig
 }
 
 type GoogleConfig struct {
@@ -24,11 +43,49 @@ type GoogleConfig struct {
 	ClientSecret             string
 }
 
+type CalDAVConfig struct {
+	// URL of the calendar collection (e.g.
+	// https://cloud.example.com/remote.php/dav/calendars/user/work/).
+	URL      string
+	Username string
+	Password string
+}
+
+type ICSFeedConfig struct {
+	// URL (http://, https:// or webcal://) or local path of the .ics feed.
+	Source string
+}
+
+// CalendarAPIConfig configures how requests are sent to the calendar.
+type CalendarAPIConfig struct {
+	// Maximum number of requests in flight at the same time.
+	MaxConcurrentRequests int
+	// Maximum sustained number of requests per second (0 means unlimited),
+	// and number of requests which can be sent in a burst.
+	RequestsPerSecond float64
+	RequestBurst      int
+	// Maximum number of times a request which failed with a retryable
+	// error (e.g. rate limiting) is retried.
+	MaxRetries int
+}
+
+// IsReadOnly returns whether the calendar can't be modified, in which case
+// default locations are only stored in the DB.
+func (c *Config) IsReadOnly() bool {
+	return c.CalendarBackend == CalendarBackendICS
+}
+
 type AppConfig struct {
 	// Base URL where the server will be available.
 	BaseURL string
+	// Timezone of the user, which determines the boundaries of each day
+	// (e.g. what "today" is).
+	Timezone *time.Location
 	// Default location code used for new Calendar events.
 	DefaultLocationCode string
+	// Path to the JSON file which defines the location types. If empty,
+	// the built-in location types are used.
+	LocationCatalogFile string
 	// Number of days into the future where we will create new events.
 	FutureHorizonDays int
 	// Number of days into the past where we will reconciliate events
@@ -40,9 +97,111 @@ type AppConfig struct {
 	// Enable subscribing to Calendar event updates in Google Calendar via
 	// the webhook. Even if disabled, the webhook endpoint can be called.
 	EnableCalendarSubscription bool
+	WorkingWeek                WorkingWeekConfig
+	Holidays                   HolidaysConfig
+	StrictValidation           StrictValidationConfig
+	ConflictResolution         ConflictResolutionConfig
+	Freeze                     FreezeConfig
+	FullSync                   FullSyncConfig
 	Scheduler                  SchedulerConfig
 }
 
+// Policies which decide which event is kept when a date has several
+// managed events.
+const (
+	ConflictPolicyLatest          = "latest"
+	ConflictPolicyUserOverDefault = "user-over-default"
+	ConflictPolicyStatusPriority  = "status-priority"
+	ConflictPolicyKeepAll         = "keep-all"
+)
+
+type ConflictResolutionConfig struct {
+	// "latest" keeps the most recently updated event, "user-over-default"
+	// prefers events created by the user over automatic defaults,
+	// "status-priority" prefers the statuses listed first in
+	// StatusPriority, and "keep-all" uses the most recently updated event
+	// without deleting the others. In all cases, the most recently updated
+	// event wins among those with the same preference, and the rest are
+	// deleted (except with "keep-all").
+	Policy string
+	// Statuses in decreasing order of priority for the "status-priority"
+	// policy (e.g. Vacation first). Unlisted statuses come last.
+	StatusPriority []string
+}
+
+// Rules which decide which past dates are frozen.
+const (
+	FreezeRuleNone          = "none"
+	FreezeRuleDays          = "days"
+	FreezeRulePreviousMonth = "previous-month"
+)
+
+type FreezeConfig struct {
+	// "none" doesn't freeze any date, "days" freezes the dates older than
+	// Days days, and "previous-month" freezes the dates before the first
+	// day of the previous month. Changes to the location of frozen dates
+	// are undone by reconciliation, unless they are made with the admin
+	// CLI.
+	Rule string
+	// Age (in days) from which dates are frozen with the "days" rule.
+	Days int
+}
+
+// Modes in which full syncs can fetch the events.
+const (
+	FullSyncModeWindow  = "window"
+	FullSyncModeArchive = "archive"
+)
+
+type FullSyncConfig struct {
+	// "window" fetches only the events around the reconciliation window
+	// (from PastSyncWindowDays ago until FutureHorizonDays ahead), and
+	// "archive" fetches the whole history of the calendar.
+	Mode string
+	// Number of days added on both sides of the reconciliation window to
+	// obtain the window fetched in "window" mode.
+	WindowMarginDays int
+}
+
+// Actions which can be taken when strict validation rejects a title.
+const (
+	StrictValidationRevert = "revert"
+	StrictValidationMark   = "mark"
+)
+
+type StrictValidationConfig struct {
+	// Reject event titles which don't match any location type, instead
+	// of storing them with the Unknown status.
+	Enabled bool
+	// What to do with rejected events: "revert" restores the last valid
+	// location, and "mark" adds ErrorPrefix to the title.
+	Action string
+	// Prefix added to the title of rejected events in "mark" mode.
+	ErrorPrefix string
+}
+
+type HolidaysConfig struct {
+	// Paths to the .ics files with public holidays, which are imported at
+	// startup.
+	ICSFiles []string
+	// Location code used for holidays which don't have an explicit
+	// location.
+	Code string
+}
+
+type WorkingWeekConfig struct {
+	// Whether each weekday (indexed by time.Weekday) is a working day.
+	WorkingDays [7]bool
+	// Location code used for non-working days which don't have an
+	// explicit location. If empty, no event is created on those days.
+	NonWorkingDayCode string
+}
+
+// IsWorkingDay returns whether the given weekday is a working day.
+func (w WorkingWeekConfig) IsWorkingDay(weekday time.Weekday) bool {
+	return w.WorkingDays[weekday]
+}
+
 type SchedulerConfig struct {
 	// Enable running the periodic task to create missing events.
 	EnableHorizonMaintenance bool
@@ -61,6 +220,13 @@ type SchedulerConfig struct {
 	//
 	// Spec: Minute Hour DayOfMonth Month DayOfWeek
 	CalendarSubscriptionMaintenanceCron string
+	// Poll the calendar for changes periodically. This is enabled with the
+	// CalDAV and ICS backends, which don't support push notifications.
+	EnableCalendarPolling bool
+	// Cron string for which to poll the calendar for changes.
+	//
+	// Spec: Minute Hour DayOfMonth Month DayOfWeek
+	CalendarPollCron string
 }
 
 type DBConfig struct {
@@ -121,6 +287,21 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	timezone, err := getLocationEnv("TIMEZONE", "Local")
+	if err != nil {
+		return nil, err
+	}
+
+	enableStrictValidation, err := getBoolEnv("STRICT_LOCATION_VALIDATION", "false")
+	if err != nil {
+		return nil, err
+	}
+
+	workingDays, err := getWeekdaysEnv("WORKING_WEEKDAYS", "MON,TUE,WED,THU,FRI,SAT,SUN")
+	if err != nil {
+		return nil, err
+	}
+
 	smtpPort, err := getIntEnv("SMTP_PORT", "587")
 	if err != nil {
 		return nil, err
@@ -131,17 +312,41 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
-	refreshToken, err := getEnvOrErr("GOOGLE_REFRESH_TOKEN")
+	calendarBackend := strings.ToLower(getEnv("CALENDAR_BACKEND", CalendarBackendGoogle))
+	if calendarBackend != CalendarBackendGoogle && calendarBackend != CalendarBackendCalDAV && calendarBackend != CalendarBackendICS {
+		return nil, fmt.Errorf("invalid CALENDAR_BACKEND %q: must be %q, %q or %q", calendarBackend, CalendarBackendGoogle, CalendarBackendCalDAV, CalendarBackendICS)
+	}
+	calendarPollCron := getEnv("CALDAV_POLL_CRON", "*/5 * * * *")
+	if calendarBackend == CalendarBackendICS {
+		calendarPollCron = getEnv("ICS_FEED_POLL_CRON", "*/15 * * * *")
+	}
+
+	fullSyncMarginDays, err := getIntEnv("FULL_SYNC_WINDOW_MARGIN_DAYS", "30")
 	if err != nil {
 		return nil, err
 	}
 
-	webhookVerificationToken, err := getEnvOrErr("WEBHOOK_VERIFICATION_TOKEN")
+	freezeDays, err := getIntEnv("FREEZE_DAYS", "60")
 	if err != nil {
 		return nil, err
 	}
 
-	appBaseUrl, err := getEnvOrErr("APP_BASE_URL")
+	maxConcurrentRequests, err := getIntEnv("CALENDAR_API_MAX_CONCURRENCY", "4")
+	if err != nil {
+		return nil, err
+	}
+
+	requestsPerSecond, err := getFloatEnv("CALENDAR_API_REQUESTS_PER_SECOND", "5")
+	if err != nil {
+		return nil, err
+	}
+
+	requestBurst, err := getIntEnv("CALENDAR_API_BURST", "10")
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries, err := getIntEnv("CALENDAR_API_MAX_RETRIES", "5")
 	if err != nil {
 		return nil, err
 	}
@@ -152,26 +357,70 @@ func LoadConfig() (*Config, error) {
 	}
 
 	cfg := &Config{
+		CalendarBackend: calendarBackend,
 		Google: GoogleConfig{
 			CalendarID:               getEnv("GOOGLE_CALENDAR_ID", "primary"),
-			RefreshToken:             refreshToken,
-			WebhookVerificationToken: webhookVerificationToken,
+			RefreshToken:             getEnv("GOOGLE_REFRESH_TOKEN", ""),
+			WebhookVerificationToken: getEnv("WEBHOOK_VERIFICATION_TOKEN", ""),
 			ClientID:                 getEnv("GOOGLE_CLIENT_ID", ""),
 			ClientSecret:             getEnv("GOOGLE_CLIENT_SECRET", ""),
 		},
+		CalDAV: CalDAVConfig{
+			URL:      getEnv("CALDAV_URL", ""),
+			Username: getEnv("CALDAV_USERNAME", ""),
+			Password: getEnv("CALDAV_PASSWORD", ""),
+		},
+		ICSFeed: ICSFeedConfig{
+			Source: getEnv("ICS_FEED_URL", ""),
+		},
+		CalendarAPI: CalendarAPIConfig{
+			MaxConcurrentRequests: maxConcurrentRequests,
+			RequestsPerSecond:     requestsPerSecond,
+			RequestBurst:          requestBurst,
+			MaxRetries:            maxRetries,
+		},
 		App: AppConfig{
-			BaseURL:                    appBaseUrl,
+			BaseURL:                    getEnv("APP_BASE_URL", ""),
+			Timezone:                   timezone,
 			DefaultLocationCode:        getEnv("DEFAULT_LOCATION_CODE", "HOM"),
+			LocationCatalogFile:        getEnv("LOCATION_CATALOG_FILE", ""),
 			FutureHorizonDays:          horizonDays,
 			PastSyncWindowDays:         pastSyncDays,
 			EnableEmailConfirmations:   enableEmail,
 			EnableCalendarSubscription: enableCalendarSubscription,
+			WorkingWeek: WorkingWeekConfig{
+				WorkingDays:       workingDays,
+				NonWorkingDayCode: getEnv("NON_WORKING_DAY_CODE", ""),
+			},
+			Holidays: HolidaysConfig{
+				ICSFiles: getListEnv("HOLIDAY_ICS_FILES", ""),
+				Code:     getEnv("HOLIDAY_CODE", "H"),
+			},
+			StrictValidation: StrictValidationConfig{
+				Enabled:     enableStrictValidation,
+				Action:      getEnv("STRICT_VALIDATION_ACTION", StrictValidationRevert),
+				ErrorPrefix: getEnv("STRICT_VALIDATION_ERROR_PREFIX", "⚠️ "),
+			},
+			ConflictResolution: ConflictResolutionConfig{
+				Policy:         strings.ToLower(getEnv("CONFLICT_RESOLUTION_POLICY", ConflictPolicyLatest)),
+				StatusPriority: getListEnv("CONFLICT_STATUS_PRIORITY", "Vacation,Holiday"),
+			},
+			Freeze: FreezeConfig{
+				Rule: strings.ToLower(getEnv("FREEZE_RULE", FreezeRuleNone)),
+				Days: freezeDays,
+			},
+			FullSync: FullSyncConfig{
+				Mode:             strings.ToLower(getEnv("FULL_SYNC_MODE", FullSyncModeWindow)),
+				WindowMarginDays: fullSyncMarginDays,
+			},
 			Scheduler: SchedulerConfig{
 				EnableHorizonMaintenance:            enableHorizonMaintenance,
 				HorizonMaintenanceCron:              getEnv("HORIZON_MAINTENANCE_CRON", "0 2 * * *"),
 				EnablePeriodicFullSync:              enablePeriodicFullSync,
 				PeriodicFullSyncCron:                getEnv("PERIODIC_FULL_SYNC_CRON", "0 3 * * SUN"),
 				CalendarSubscriptionMaintenanceCron: getEnv("CALENDAR_SUBSCRIPTION_MAINTENANCE_CRON", "0 1 * * *"),
+				EnableCalendarPolling:               calendarBackend != CalendarBackendGoogle,
+				CalendarPollCron:                    calendarPollCron,
 			},
 		},
 		DB: DBConfig{
@@ -189,18 +438,72 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Basic validation for required fields
-	if cfg.Google.RefreshToken == "" {
-		return nil, fmt.Errorf("missing required environment variable: GOOGLE_REFRESH_TOKEN")
+	switch cfg.CalendarBackend {
+	case CalendarBackendGoogle:
+		if cfg.Google.RefreshToken == "" {
+			return nil, fmt.Errorf("missing required environment variable: GOOGLE_REFRESH_TOKEN")
+		}
+		if cfg.Google.WebhookVerificationToken == "" {
+			return nil, fmt.Errorf("missing required environment variable: WEBHOOK_VERIFICATION_TOKEN")
+		}
+		if cfg.App.BaseURL == "" {
+			return nil, fmt.Errorf("missing required environment variable: APP_BASE_URL")
+		}
+	case CalendarBackendCalDAV:
+		if cfg.CalDAV.URL == "" {
+			return nil, fmt.Errorf("missing required environment variable: CALDAV_URL")
+		}
+		if cfg.App.EnableCalendarSubscription {
+			return nil, fmt.Errorf("ENABLE_CALENDAR_SUBSCRIPTION isn't supported with the CalDAV backend, which is polled instead (see CALDAV_POLL_CRON)")
+		}
+	case CalendarBackendICS:
+		if cfg.ICSFeed.Source == "" {
+			return nil, fmt.Errorf("missing required environment variable: ICS_FEED_URL")
+		}
+		if cfg.App.EnableCalendarSubscription {
+			return nil, fmt.Errorf("ENABLE_CALENDAR_SUBSCRIPTION isn't supported with the ICS backend, which is polled instead (see ICS_FEED_POLL_CRON)")
+		}
+	}
+	switch cfg.App.ConflictResolution.Policy {
+	case ConflictPolicyLatest, ConflictPolicyUserOverDefault, ConflictPolicyKeepAll:
+	case ConflictPolicyStatusPriority:
+		if len(cfg.App.ConflictResolution.StatusPriority) == 0 {
+			return nil, fmt.Errorf("CONFLICT_STATUS_PRIORITY can't be empty when CONFLICT_RESOLUTION_POLICY is %q", ConflictPolicyStatusPriority)
+		}
+	default:
+		return nil, fmt.Errorf("invalid CONFLICT_RESOLUTION_POLICY %q: must be %q, %q, %q or %q", cfg.App.ConflictResolution.Policy,
+			ConflictPolicyLatest, ConflictPolicyUserOverDefault, ConflictPolicyStatusPriority, ConflictPolicyKeepAll)
+	}
+	switch cfg.App.Freeze.Rule {
+	case FreezeRuleNone, FreezeRulePreviousMonth:
+	case FreezeRuleDays:
+		if cfg.App.Freeze.Days < 0 {
+			return nil, fmt.Errorf("FREEZE_DAYS can't be negative")
+		}
+	default:
+		return nil, fmt.Errorf("invalid FREEZE_RULE %q: must be %q, %q or %q", cfg.App.Freeze.Rule, FreezeRuleNone, FreezeRuleDays, FreezeRulePreviousMonth)
+	}
+	if cfg.App.FullSync.Mode != FullSyncModeWindow && cfg.App.FullSync.Mode != FullSyncModeArchive {
+		return nil, fmt.Errorf("invalid FULL_SYNC_MODE %q: must be %q or %q", cfg.App.FullSync.Mode, FullSyncModeWindow, FullSyncModeArchive)
 	}
-	if cfg.Google.WebhookVerificationToken == "" {
-		return nil, fmt.Errorf("missing required environment variable: WEBHOOK_VERIFICATION_TOKEN")
+	if cfg.App.FullSync.WindowMarginDays < 0 {
+		return nil, fmt.Errorf("FULL_SYNC_WINDOW_MARGIN_DAYS can't be negative")
 	}
-	if cfg.App.BaseURL == "" {
-		return nil, fmt.Errorf("missing required environment variable: APP_BASE_URL")
+	if cfg.CalendarAPI.MaxConcurrentRequests < 1 {
+		return nil, fmt.Errorf("CALENDAR_API_MAX_CONCURRENCY must be at least 1")
+	}
+	if cfg.CalendarAPI.RequestsPerSecond < 0 || cfg.CalendarAPI.RequestBurst < 1 || cfg.CalendarAPI.MaxRetries < 0 {
+		return nil, fmt.Errorf("CALENDAR_API_REQUESTS_PER_SECOND and CALENDAR_API_MAX_RETRIES can't be negative, and CALENDAR_API_BURST must be at least 1")
 	}
 	if cfg.DB.ConnectionString == "" {
 		return nil, fmt.Errorf("missing required environment variable: DB_CONNECTION_STRING")
 	}
+	if cfg.App.StrictValidation.Action != StrictValidationRevert && cfg.App.StrictValidation.Action != StrictValidationMark {
+		return nil, fmt.Errorf("invalid STRICT_VALIDATION_ACTION %q: must be %q or %q", cfg.App.StrictValidation.Action, StrictValidationRevert, StrictValidationMark)
+	}
+	if cfg.App.StrictValidation.Action == StrictValidationMark && strings.TrimSpace(cfg.App.StrictValidation.ErrorPrefix) == "" {
+		return nil, fmt.Errorf("STRICT_VALIDATION_ERROR_PREFIX can't be empty when STRICT_VALIDATION_ACTION is %q", StrictValidationMark)
+	}
 	if cfg.App.EnableEmailConfirmations {
 		if cfg.SMTP.Host == "" || cfg.SMTP.SenderAddress == "" || cfg.SMTP.RecipientAddress == "" {
 			return nil, fmt.Errorf("missing required SMTP environment variables when ENABLE_EMAIL_CONFIRMATIONS is true")
@@ -238,6 +541,16 @@ func getIntEnv(key, fallback string) (int, error) {
 	return value, nil
 }
 
+// getFloatEnv parses an env as a floating point value.
+func getFloatEnv(key, fallback string) (float64, error) {
+	rawValue := getEnv(key, fallback)
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number environment variable %s: %w", key, err)
+	}
+	return value, nil
+}
+
 // getBoolEnv parses an env as a boolean value.
 func getBoolEnv(key, fallback string) (bool, error) {
 	rawValue := getEnv(key, fallback)
@@ -247,3 +560,59 @@ func getBoolEnv(key, fallback string) (bool, error) {
 	}
 	return value, nil
 }
+
+// getLocationEnv parses an env as an IANA timezone name (e.g.
+// "Europe/Madrid").
+func getLocationEnv(key, fallback string) (*time.Location, error) {
+	rawValue := getEnv(key, fallback)
+	if rawValue == "" {
+		rawValue = fallback
+	}
+	location, err := time.LoadLocation(rawValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone environment variable %s: %w", key, err)
+	}
+	return location, nil
+}
+
+// getListEnv parses an env as a comma-separated list of strings.
+func getListEnv(key, fallback string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, fallback), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// weekdayNames maps the abbreviations accepted in weekday lists to their
+// weekday.
+var weekdayNames = map[string]time.Weekday{
+	"SUN": time.Sunday,
+	"MON": time.Monday,
+	"TUE": time.Tuesday,
+	"WED": time.Wednesday,
+	"THU": time.Thursday,
+	"FRI": time.Friday,
+	"SAT": time.Saturday,
+}
+
+// getWeekdaysEnv parses an env as a comma-separated list of weekday
+// abbreviations (e.g. "MON,TUE"), returning which weekdays are included.
+func getWeekdaysEnv(key, fallback string) ([7]bool, error) {
+	var weekdays [7]bool
+	rawValue := getEnv(key, fallback)
+	for _, name := range strings.Split(rawValue, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weekday, ok := weekdayNames[name]
+		if !ok {
+			return weekdays, fmt.Errorf("invalid weekday %q in environment variable %s", name, key)
+		}
+		weekdays[weekday] = true
+	}
+	return weekdays, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Keys of the PostgreSQL advisory locks which coordinate the instances of
+// ZenithPlanner sharing the database. They are arbitrary, but shouldn't
+// clash with the ones of other applications using the same database.
+const (
+	// Held while changing the calendar or the schedule (syncs, tasks,
+	// outbox processing and admin CLI corrections), so only one instance
+	// does it at a time.
+	LockKeySync int64 = 0x5a50_0001
+	// Held by the leader, the only instance which runs the scheduled
+	// tasks.
+	LockKeyLeader int64 = 0x5a50_0002
+)
+
+// AdvisoryLock is a session-level PostgreSQL advisory lock. It is held on a
+// dedicated connection of the pool until it is released, or until the
+// connection is lost (e.g. because the instance holding it died), so other
+// instances can take it over.
+type AdvisoryLock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+// AcquireAdvisoryLock waits until the advisory lock with the given key is
+// acquired, or ctx is done.
+func (r *Repository) AcquireAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire a connection for advisory lock %d: %w", key, err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		closeConn(conn)
+		return nil, fmt.Errorf("failed to take advisory lock %d: %w", key, err)
+	}
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// TryAdvisoryLock acquires the advisory lock with the given key if it is
+// free. It returns nil (and no error) if another session holds it.
+func (r *Repository) TryAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire a connection for advisory lock %d: %w", key, err)
+	}
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		closeConn(conn)
+		return nil, fmt.Errorf("failed to try advisory lock %d: %w", key, err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, nil
+	}
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// Check returns an error if the connection which holds the lock has been
+// lost, in which case the lock isn't held anymore.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	return l.conn.Ping(ctx)
+}
+
+// Release releases the lock and returns its connection to the pool. If the
+// lock can't be released, the connection is closed instead, which also
+// releases it.
+func (l *AdvisoryLock) Release(ctx context.Context) {
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		log.Printf("Error releasing advisory lock %d: %v. Closing its connection.", l.key, err)
+		closeConn(l.conn)
+		return
+	}
+	l.conn.Release()
+}
+
+// closeConn closes a connection taken from the pool instead of returning
+// it, so the locks of its session are released.
+func closeConn(conn *pgxpool.Conn) {
+	if err := conn.Hijack().Close(context.Background()); err != nil {
+		log.Printf("Error closing database connection: %v", err)
+	}
+}
@@ -21,6 +21,7 @@ type CachedEvent struct {
 	ColorID              *string    `db:"color_id"`            // Use pointer for nullable text
 	RecurringEventID     *string    `db:"recurring_event_id"`  // Use pointer for nullable text
 	OriginalStartTime    *time.Time `db:"original_start_time"` // Use pointer for nullable timestamp
+	AutoDefaultCode      *string    `db:"auto_default_code"`   // Use pointer for nullable text
 }
 
 // UpsertCachedEvent inserts or updates an event in the cache.
@@ -28,8 +29,9 @@ func (r *Repository) UpsertCachedEvent(ctx context.Context, event CachedEvent) e
 	query := `
         INSERT INTO calendar_event_cache (
             event_id, date, title, description, updated_ts, is_managed_property,
-            is_managed_description, color_id, recurring_event_id, original_start_time
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            is_managed_description, color_id, recurring_event_id, original_start_time,
+            auto_default_code
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         ON CONFLICT (event_id) DO UPDATE SET
             date = EXCLUDED.date,
             title = EXCLUDED.title,
@@ -39,13 +41,15 @@ func (r *Repository) UpsertCachedEvent(ctx context.Context, event CachedEvent) e
             is_managed_description = EXCLUDED.is_managed_description,
             color_id = EXCLUDED.color_id,
             recurring_event_id = EXCLUDED.recurring_event_id,
-            original_start_time = EXCLUDED.original_start_time;
+            original_start_time = EXCLUDED.original_start_time,
+            auto_default_code = EXCLUDED.auto_default_code;
     `
 	normalizedDate := normalizeDate(event.Date)
 
-	_, err := r.pool.Exec(ctx, query,
+	_, err := r.db(ctx).Exec(ctx, query,
 		event.EventID, normalizedDate, event.Title, event.Description, event.UpdatedTs, event.IsManagedProperty,
 		event.IsManagedDescription, event.ColorID, event.RecurringEventID, event.OriginalStartTime,
+		event.AutoDefaultCode,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to upsert cached event %s: %w", event.EventID, err)
@@ -56,7 +60,7 @@ func (r *Repository) UpsertCachedEvent(ctx context.Context, event CachedEvent) e
 // DeleteCachedEvent removes an event from the cache by its ID.
 func (r *Repository) DeleteCachedEvent(ctx context.Context, eventID string) error {
 	query := "DELETE FROM calendar_event_cache WHERE event_id = $1"
-	cmdTag, err := r.pool.Exec(ctx, query, eventID)
+	cmdTag, err := r.db(ctx).Exec(ctx, query, eventID)
 	if err != nil {
 		return fmt.Errorf("failed to delete cached event %s: %w", eventID, err)
 	}
@@ -66,14 +70,78 @@ func (r *Repository) DeleteCachedEvent(ctx context.Context, eventID string) erro
 	return nil
 }
 
-// ClearCachedEvents removes all events from the cache (used before full sync rebuild).
-func (r *Repository) ClearCachedEvents(ctx context.Context) error {
-	query := "DELETE FROM calendar_event_cache"
-	_, err := r.pool.Exec(ctx, query)
+// GetAllCachedEvents retrieves all the events in the cache.
+func (r *Repository) GetAllCachedEvents(ctx context.Context) ([]CachedEvent, error) {
+	events := []CachedEvent{}
+	query := `
+        SELECT event_id, date, title, description, updated_ts, is_managed_property,
+               is_managed_description, color_id, recurring_event_id, original_start_time,
+               auto_default_code
+        FROM calendar_event_cache
+        ORDER BY date, event_id
+    `
+	rows, err := r.db(ctx).Query(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to clear calendar event cache: %w", err)
+		return nil, fmt.Errorf("failed to query cached events: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	for rows.Next() {
+		var event CachedEvent
+		err := rows.Scan(
+			&event.EventID, &event.Date, &event.Title, &event.Description, &event.UpdatedTs, &event.IsManagedProperty,
+			&event.IsManagedDescription, &event.ColorID, &event.RecurringEventID, &event.OriginalStartTime,
+			&event.AutoDefaultCode,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cached event row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cached event rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetCachedEventsInRange retrieves the cached events whose date is between
+// from and to (inclusive).
+func (r *Repository) GetCachedEventsInRange(ctx context.Context, from, to time.Time) ([]CachedEvent, error) {
+	events := []CachedEvent{}
+	query := `
+        SELECT event_id, date, title, description, updated_ts, is_managed_property,
+               is_managed_description, color_id, recurring_event_id, original_start_time,
+               auto_default_code
+        FROM calendar_event_cache
+        WHERE date BETWEEN $1 AND $2
+        ORDER BY date, event_id
+    `
+	rows, err := r.db(ctx).Query(ctx, query, normalizeDate(from), normalizeDate(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cached events from %s to %s: %w", from.Format("2006-01-02"), to.Format("2006-01-02"), err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event CachedEvent
+		err := rows.Scan(
+			&event.EventID, &event.Date, &event.Title, &event.Description, &event.UpdatedTs, &event.IsManagedProperty,
+			&event.IsManagedDescription, &event.ColorID, &event.RecurringEventID, &event.OriginalStartTime,
+			&event.AutoDefaultCode,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cached event row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cached event rows: %w", err)
+	}
+
+	return events, nil
 }
 
 // GetCachedEventsByDate retrieves all cached events for a specific date.
@@ -81,13 +149,14 @@ func (r *Repository) GetCachedEventsByDate(ctx context.Context, date time.Time)
 	events := []CachedEvent{}
 	query := `
         SELECT event_id, date, title, description, updated_ts, is_managed_property,
-               is_managed_description, color_id, recurring_event_id, original_start_time
+               is_managed_description, color_id, recurring_event_id, original_start_time,
+               auto_default_code
         FROM calendar_event_cache
         WHERE date = $1
         ORDER BY updated_ts DESC -- Order by updated time might be useful
     `
 	normalizedDate := normalizeDate(date)
-	rows, err := r.pool.Query(ctx, query, normalizedDate)
+	rows, err := r.db(ctx).Query(ctx, query, normalizedDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query cached events for date %s: %w", date.Format("2006-01-02"), err)
 	}
@@ -98,6 +167,7 @@ func (r *Repository) GetCachedEventsByDate(ctx context.Context, date time.Time)
 		err := rows.Scan(
 			&event.EventID, &event.Date, &event.Title, &event.Description, &event.UpdatedTs, &event.IsManagedProperty,
 			&event.IsManagedDescription, &event.ColorID, &event.RecurringEventID, &event.OriginalStartTime,
+			&event.AutoDefaultCode,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan cached event row: %w", err)
@@ -118,13 +188,15 @@ func (r *Repository) GetCachedEventByID(ctx context.Context, eventID string) (*C
 	event := &CachedEvent{}
 	query := `
         SELECT event_id, date, title, description, updated_ts, is_managed_property,
-               is_managed_description, color_id, recurring_event_id, original_start_time
+               is_managed_description, color_id, recurring_event_id, original_start_time,
+               auto_default_code
         FROM calendar_event_cache
         WHERE event_id = $1
     `
-	err := r.pool.QueryRow(ctx, query, eventID).Scan(
+	err := r.db(ctx).QueryRow(ctx, query, eventID).Scan(
 		&event.EventID, &event.Date, &event.Title, &event.Description, &event.UpdatedTs, &event.IsManagedProperty,
 		&event.IsManagedDescription, &event.ColorID, &event.RecurringEventID, &event.OriginalStartTime,
+		&event.AutoDefaultCode,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Operations which can be recorded in the calendar outbox.
+const (
+	OutboxInsert = "insert"
+	OutboxPatch  = "patch"
+	OutboxDelete = "delete"
+)
+
+// OutboxItem represents a row in the calendar_outbox table: a calendar
+// mutation which has to be executed.
+type OutboxItem struct {
+	ID             int64      `db:"id"`
+	IdempotencyKey string     `db:"idempotency_key"`
+	Operation      string     `db:"operation"`
+	EventID        string     `db:"event_id"`
+	Payload        []byte     `db:"payload"` // JSON
+	Date           time.Time  `db:"date"`
+	Attempts       int        `db:"attempts"`
+	LastError      *string    `db:"last_error"` // Use pointer for nullable text
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	DoneAt         *time.Time `db:"done_at"`
+	DeadAt         *time.Time `db:"dead_at"`
+}
+
+// Statuses of outbox items, which can be used to filter ListOutboxItems.
+const (
+	OutboxPending = "pending"
+	OutboxDone    = "done"
+	// The mutation failed too many times or can't succeed, and won't be
+	// retried unless it is requeued.
+	OutboxDead = "dead"
+)
+
+// Status returns the status of the item.
+func (i OutboxItem) Status() string {
+	switch {
+	case i.DoneAt != nil:
+		return OutboxDone
+	case i.DeadAt != nil:
+		return OutboxDead
+	default:
+		return OutboxPending
+	}
+}
+
+const outboxItemColumns = "id, idempotency_key, operation, event_id, payload, date, attempts, last_error, next_attempt_at, created_at, done_at, dead_at"
+
+func scanOutboxItem(row pgx.Row) (*OutboxItem, error) {
+	var item OutboxItem
+	err := row.Scan(&item.ID, &item.IdempotencyKey, &item.Operation, &item.EventID, &item.Payload, &item.Date, &item.Attempts, &item.LastError, &item.NextAttemptAt, &item.CreatedAt, &item.DoneAt, &item.DeadAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// EnqueueOutboxItem records a calendar mutation. It is a noop if a pending
+// mutation with the same idempotency key already exists (dead ones don't
+// count).
+func (r *Repository) EnqueueOutboxItem(ctx context.Context, item OutboxItem) error {
+	payload := item.Payload
+	if payload == nil {
+		payload = []byte("{}")
+	}
+	query := `
+        INSERT INTO calendar_outbox (idempotency_key, operation, event_id, payload, date)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (idempotency_key) WHERE done_at IS NULL AND dead_at IS NULL DO NOTHING;
+    `
+	_, err := r.db(ctx).Exec(ctx, query, item.IdempotencyKey, item.Operation, item.EventID, payload, normalizeDate(item.Date))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s of event %s: %w", item.Operation, item.EventID, err)
+	}
+	return nil
+}
+
+// GetDueOutboxItems retrieves the pending mutations whose next attempt is
+// due, in the order they were recorded.
+func (r *Repository) GetDueOutboxItems(ctx context.Context, now time.Time, limit int) ([]OutboxItem, error) {
+	query := `
+        SELECT ` + outboxItemColumns + `
+        FROM calendar_outbox
+        WHERE done_at IS NULL AND dead_at IS NULL AND next_attempt_at <= $1
+        ORDER BY id
+        LIMIT $2
+    `
+	rows, err := r.db(ctx).Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due outbox items: %w", err)
+	}
+	return collectOutboxItems(rows)
+}
+
+// ListOutboxItems retrieves the most recent mutations with the given
+// status (or all of them, if it is empty), newest first.
+func (r *Repository) ListOutboxItems(ctx context.Context, status string, limit int) ([]OutboxItem, error) {
+	query := `
+        SELECT ` + outboxItemColumns + `
+        FROM calendar_outbox
+        WHERE $1 = ''
+            OR ($1 = 'pending' AND done_at IS NULL AND dead_at IS NULL)
+            OR ($1 = 'done' AND done_at IS NOT NULL)
+            OR ($1 = 'dead' AND dead_at IS NOT NULL)
+        ORDER BY id DESC
+        LIMIT $2
+    `
+	rows, err := r.db(ctx).Query(ctx, query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox items: %w", err)
+	}
+	return collectOutboxItems(rows)
+}
+
+func collectOutboxItems(rows pgx.Rows) ([]OutboxItem, error) {
+	defer rows.Close()
+
+	items := []OutboxItem{}
+	for rows.Next() {
+		item, err := scanOutboxItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox item row: %w", err)
+		}
+		items = append(items, *item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox item rows: %w", err)
+	}
+
+	return items, nil
+}
+
+// MarkOutboxItemDone marks a mutation as executed.
+func (r *Repository) MarkOutboxItemDone(ctx context.Context, id int64) error {
+	_, err := r.db(ctx).Exec(ctx, "UPDATE calendar_outbox SET done_at = now() WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox item %d as done: %w", id, err)
+	}
+	return nil
+}
+
+// MarkOutboxItemFailed records a failed attempt to execute a mutation, and
+// when it should be retried.
+func (r *Repository) MarkOutboxItemFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	query := `
+        UPDATE calendar_outbox
+        SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+        WHERE id = $1
+    `
+	_, err := r.db(ctx).Exec(ctx, query, id, lastError, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to record failed attempt of outbox item %d: %w", id, err)
+	}
+	return nil
+}
+
+// MarkOutboxItemDead records the last failed attempt to execute a
+// mutation, which won't be retried.
+func (r *Repository) MarkOutboxItemDead(ctx context.Context, id int64, lastError string) error {
+	query := `
+        UPDATE calendar_outbox
+        SET attempts = attempts + 1, last_error = $2, dead_at = now()
+        WHERE id = $1
+    `
+	_, err := r.db(ctx).Exec(ctx, query, id, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox item %d as dead: %w", id, err)
+	}
+	return nil
+}
+
+// RequeueOutboxItem queues a dead mutation again to be executed right
+// away, with a new set of attempts.
+func (r *Repository) RequeueOutboxItem(ctx context.Context, id int64) error {
+	query := `
+        UPDATE calendar_outbox
+        SET attempts = 0, dead_at = NULL, next_attempt_at = now()
+        WHERE id = $1 AND dead_at IS NOT NULL
+    `
+	tag, err := r.db(ctx).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue outbox item %d (an identical mutation may already be queued): %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("there isn't a dead outbox item with ID %d", id)
+	}
+	return nil
+}
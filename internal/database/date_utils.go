@@ -4,6 +4,9 @@ import (
 	"time"
 )
 
+// normalizeDate returns the calendar date of the given time (in its own
+// location) as midnight UTC, which is how dates are stored in the DB.
+// Callers are responsible for passing a time in the user's timezone.
 func normalizeDate(date time.Time) time.Time {
 	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
 }
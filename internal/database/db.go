@@ -6,6 +6,8 @@ import (
 	"log"
 	"gomodules.avm99963.com/zenithplanner/internal/config"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +16,50 @@ type Repository struct {
 	pool *pgxpool.Pool
 }
 
+// dbtx is implemented by both *pgxpool.Pool and pgx.Tx, so the repository
+// methods can run inside or outside a transaction. Calling Begin on a
+// pgx.Tx creates a savepoint.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// txKey is the context key which holds the transaction started by
+// InTransaction.
+type txKey struct{}
+
+// db returns the transaction of the context, or the pool if there is none.
+func (r *Repository) db(ctx context.Context) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return r.pool
+}
+
+// InTransaction runs fn in a transaction: the repository methods called
+// with the context passed to fn are part of it. The transaction is
+// committed if fn succeeds and rolled back otherwise. Nested calls run in a
+// savepoint of the outer transaction, so if they fail only their changes
+// are rolled back, and the outer transaction can go on (in PostgreSQL, a
+// failed statement aborts the transaction it is part of).
+func (r *Repository) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := r.db(ctx).Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 // NewDBPool creates a new PostgreSQL connection pool.
 func NewDBPool(ctx context.Context, dbCfg config.DBConfig) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(dbCfg.ConnectionString)
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeletedEvent represents a row in the deleted_events table: a snapshot of
+// an event deleted by ZenithPlanner, which can be restored.
+type DeletedEvent struct {
+	ID              int64      `db:"id"`
+	EventID         string     `db:"event_id"`
+	Date            time.Time  `db:"date"`
+	Event           []byte     `db:"event"` // JSON
+	Reason          string     `db:"reason"`
+	SyncRunID       string     `db:"sync_run_id"`
+	DeletedAt       time.Time  `db:"deleted_at"`
+	RestoredAt      *time.Time `db:"restored_at"`       // Use pointer for nullable timestamp
+	RestoredEventID *string    `db:"restored_event_id"` // Use pointer for nullable text
+}
+
+// InsertDeletedEvent records the snapshot of an event before deleting it.
+// If the event was already recorded in the same sync run (e.g. because the
+// deletion is being retried), the snapshot is replaced.
+func (r *Repository) InsertDeletedEvent(ctx context.Context, deleted DeletedEvent) error {
+	query := `
+        INSERT INTO deleted_events (event_id, date, event, reason, sync_run_id)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (sync_run_id, event_id) DO UPDATE
+        SET date = EXCLUDED.date, event = EXCLUDED.event, reason = EXCLUDED.reason, deleted_at = now();
+    `
+	_, err := r.db(ctx).Exec(ctx, query, deleted.EventID, normalizeDate(deleted.Date), deleted.Event, deleted.Reason, deleted.SyncRunID)
+	if err != nil {
+		return fmt.Errorf("failed to record snapshot of deleted event %s: %w", deleted.EventID, err)
+	}
+	return nil
+}
+
+// GetDeletedEvent retrieves a snapshot by its ID. Returns nil if it doesn't
+// exist.
+func (r *Repository) GetDeletedEvent(ctx context.Context, id int64) (*DeletedEvent, error) {
+	query := `
+        SELECT id, event_id, date, event, reason, sync_run_id, deleted_at, restored_at, restored_event_id
+        FROM deleted_events
+        WHERE id = $1
+    `
+	var deleted DeletedEvent
+	err := r.db(ctx).QueryRow(ctx, query, id).Scan(&deleted.ID, &deleted.EventID, &deleted.Date, &deleted.Event, &deleted.Reason, &deleted.SyncRunID, &deleted.DeletedAt, &deleted.RestoredAt, &deleted.RestoredEventID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query deleted event %d: %w", id, err)
+	}
+	return &deleted, nil
+}
+
+// ListDeletedEvents retrieves the most recent snapshots of deleted events.
+func (r *Repository) ListDeletedEvents(ctx context.Context, limit int) ([]DeletedEvent, error) {
+	deletedEvents := []DeletedEvent{}
+	query := `
+        SELECT id, event_id, date, event, reason, sync_run_id, deleted_at, restored_at, restored_event_id
+        FROM deleted_events
+        ORDER BY deleted_at DESC, id DESC
+        LIMIT $1
+    `
+	rows, err := r.db(ctx).Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deleted DeletedEvent
+		err := rows.Scan(&deleted.ID, &deleted.EventID, &deleted.Date, &deleted.Event, &deleted.Reason, &deleted.SyncRunID, &deleted.DeletedAt, &deleted.RestoredAt, &deleted.RestoredEventID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deleted event row: %w", err)
+		}
+		deletedEvents = append(deletedEvents, deleted)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deleted event rows: %w", err)
+	}
+
+	return deletedEvents, nil
+}
+
+// MarkDeletedEventRestored records that a snapshot was restored as the
+// event with the given ID.
+func (r *Repository) MarkDeletedEventRestored(ctx context.Context, id int64, restoredEventID string) error {
+	query := `
+        UPDATE deleted_events
+        SET restored_at = now(), restored_event_id = $2
+        WHERE id = $1
+    `
+	_, err := r.db(ctx).Exec(ctx, query, id, restoredEventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark deleted event %d as restored: %w", id, err)
+	}
+	return nil
+}
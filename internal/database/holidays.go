@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Holiday represents a row in the holidays table.
+type Holiday struct {
+	Date   time.Time `db:"date"`
+	Name   string    `db:"name"`
+	Source string    `db:"source"` // File the holiday was imported from
+}
+
+// ReplaceHolidays replaces all the holidays with the given ones in a
+// single transaction.
+func (r *Repository) ReplaceHolidays(ctx context.Context, holidays []Holiday) error {
+	tx, err := r.db(ctx).Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for holidays: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM holidays"); err != nil {
+		return fmt.Errorf("failed to delete holidays: %w", err)
+	}
+
+	query := "INSERT INTO holidays (date, name, source) VALUES ($1, $2, $3)"
+	for _, holiday := range holidays {
+		_, err := tx.Exec(ctx, query, normalizeDate(holiday.Date), holiday.Name, holiday.Source)
+		if err != nil {
+			return fmt.Errorf("failed to insert holiday for date %s: %w", holiday.Date.Format("2006-01-02"), err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit holidays: %w", err)
+	}
+	return nil
+}
+
+// ListHolidays retrieves all the holidays ordered by date.
+func (r *Repository) ListHolidays(ctx context.Context) ([]Holiday, error) {
+	holidays := []Holiday{}
+	rows, err := r.db(ctx).Query(ctx, "SELECT date, name, source FROM holidays ORDER BY date")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holidays: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var holiday Holiday
+		if err := rows.Scan(&holiday.Date, &holiday.Name, &holiday.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan holiday row: %w", err)
+		}
+		holidays = append(holidays, holiday)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating holiday rows: %w", err)
+	}
+
+	return holidays, nil
+}
+
+// GetHoliday retrieves the holiday on a specific date.
+// Returns nil, nil if the date isn't a holiday.
+func (r *Repository) GetHoliday(ctx context.Context, date time.Time) (*Holiday, error) {
+	holiday := &Holiday{}
+	query := "SELECT date, name, source FROM holidays WHERE date = $1"
+	err := r.db(ctx).QueryRow(ctx, query, normalizeDate(date)).Scan(&holiday.Date, &holiday.Name, &holiday.Source)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Not found is not an error in this context
+		}
+		return nil, fmt.Errorf("failed to get holiday for date %s: %w", date.Format("2006-01-02"), err)
+	}
+	return holiday, nil
+}
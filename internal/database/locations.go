@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Location represents a row in the locations table.
+type Location struct {
+	Code        string    `db:"code"`
+	DisplayName *string   `db:"display_name"` // Use pointer for nullable text
+	Category    *string   `db:"category"`     // Use pointer for nullable text
+	Address     *string   `db:"address"`      // Use pointer for nullable text
+	Latitude    *float64  `db:"latitude"`     // Use pointer for nullable number
+	Longitude   *float64  `db:"longitude"`    // Use pointer for nullable number
+	Active      bool      `db:"active"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// RegisterLocation inserts a location with the given code if it doesn't
+// exist yet. Existing locations are left untouched. Returns true if the
+// location was created.
+func (r *Repository) RegisterLocation(ctx context.Context, code string, category *string) (bool, error) {
+	query := `
+        INSERT INTO locations (code, category)
+        VALUES ($1, $2)
+        ON CONFLICT (code) DO NOTHING;
+    `
+	cmdTag, err := r.db(ctx).Exec(ctx, query, code, category)
+	if err != nil {
+		return false, fmt.Errorf("failed to register location %s: %w", code, err)
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
+// UpdateLocation updates the metadata of an existing location.
+func (r *Repository) UpdateLocation(ctx context.Context, location Location) error {
+	query := `
+        UPDATE locations SET
+            display_name = $2,
+            category = $3,
+            address = $4,
+            latitude = $5,
+            longitude = $6,
+            active = $7
+        WHERE code = $1;
+    `
+	cmdTag, err := r.db(ctx).Exec(ctx, query,
+		location.Code, location.DisplayName, location.Category, location.Address,
+		location.Latitude, location.Longitude, location.Active,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update location %s: %w", location.Code, err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("location %s not found", location.Code)
+	}
+	return nil
+}
+
+// GetLocation retrieves a location by its code.
+// Returns nil, nil if the location is not found.
+func (r *Repository) GetLocation(ctx context.Context, code string) (*Location, error) {
+	location := &Location{}
+	query := `
+        SELECT code, display_name, category, address, latitude, longitude, active, created_at
+        FROM locations
+        WHERE code = $1
+    `
+	err := r.db(ctx).QueryRow(ctx, query, code).Scan(
+		&location.Code, &location.DisplayName, &location.Category, &location.Address,
+		&location.Latitude, &location.Longitude, &location.Active, &location.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Not found is not an error in this context
+		}
+		return nil, fmt.Errorf("failed to get location %s: %w", code, err)
+	}
+	return location, nil
+}
+
+// ListLocations retrieves all locations ordered by code.
+func (r *Repository) ListLocations(ctx context.Context) ([]Location, error) {
+	locations := []Location{}
+	query := `
+        SELECT code, display_name, category, address, latitude, longitude, active, created_at
+        FROM locations
+        ORDER BY code
+    `
+	rows, err := r.db(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query locations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var location Location
+		err := rows.Scan(
+			&location.Code, &location.DisplayName, &location.Category, &location.Address,
+			&location.Latitude, &location.Longitude, &location.Active, &location.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location row: %w", err)
+		}
+		locations = append(locations, location)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating location rows: %w", err)
+	}
+
+	return locations, nil
+}
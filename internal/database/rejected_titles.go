@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RejectedTitle represents a row in the rejected_titles table: an event
+// title which was rejected by strict validation.
+type RejectedTitle struct {
+	ID                   int64     `db:"id"`
+	Date                 time.Time `db:"date"`
+	EventID              string    `db:"event_id"`
+	Title                string    `db:"title"`
+	Action               string    `db:"action"`
+	RestoredLocationCode *string   `db:"restored_location_code"` // Use pointer for nullable text
+	RejectedAt           time.Time `db:"rejected_at"`
+}
+
+// InsertRejectedTitle records a title rejected by strict validation.
+func (r *Repository) InsertRejectedTitle(ctx context.Context, rejected RejectedTitle) error {
+	query := `
+        INSERT INTO rejected_titles (date, event_id, title, action, restored_location_code)
+        VALUES ($1, $2, $3, $4, $5);
+    `
+	_, err := r.db(ctx).Exec(ctx, query, normalizeDate(rejected.Date), rejected.EventID, rejected.Title, rejected.Action, rejected.RestoredLocationCode)
+	if err != nil {
+		return fmt.Errorf("failed to record rejected title for event %s: %w", rejected.EventID, err)
+	}
+	return nil
+}
+
+// HasRejectedTitle returns whether the title of the event was already
+// rejected for the given date.
+func (r *Repository) HasRejectedTitle(ctx context.Context, date time.Time, eventID, title string) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM rejected_titles
+            WHERE date = $1 AND event_id = $2 AND title = $3
+        )
+    `
+	var exists bool
+	err := r.db(ctx).QueryRow(ctx, query, normalizeDate(date), eventID, title).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to query rejected titles for event %s: %w", eventID, err)
+	}
+	return exists, nil
+}
+
+// ListRejectedTitles retrieves the most recent rejected titles.
+func (r *Repository) ListRejectedTitles(ctx context.Context, limit int) ([]RejectedTitle, error) {
+	rejectedTitles := []RejectedTitle{}
+	query := `
+        SELECT id, date, event_id, title, action, restored_location_code, rejected_at
+        FROM rejected_titles
+        ORDER BY rejected_at DESC
+        LIMIT $1
+    `
+	rows, err := r.db(ctx).Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rejected titles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rejected RejectedTitle
+		err := rows.Scan(&rejected.ID, &rejected.Date, &rejected.EventID, &rejected.Title, &rejected.Action, &rejected.RestoredLocationCode, &rejected.RejectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rejected title row: %w", err)
+		}
+		rejectedTitles = append(rejectedTitles, rejected)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rejected title rows: %w", err)
+	}
+
+	return rejectedTitles, nil
+}
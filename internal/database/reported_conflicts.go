@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetReportedConflict returns the IDs of the conflicting events last
+// reported for a date (see SetReportedConflict), or "" if no conflict was
+// reported.
+func (r *Repository) GetReportedConflict(ctx context.Context, date time.Time) (string, error) {
+	var eventIDs string
+	query := "SELECT event_ids FROM reported_conflicts WHERE date = $1"
+	err := r.db(ctx).QueryRow(ctx, query, normalizeDate(date)).Scan(&eventIDs)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get reported conflict for date %s: %w", date.Format("2006-01-02"), err)
+	}
+	return eventIDs, nil
+}
+
+// SetReportedConflict records that the conflict between the given events
+// (their sorted IDs, separated by commas) has been reported for a date.
+func (r *Repository) SetReportedConflict(ctx context.Context, date time.Time, eventIDs string) error {
+	query := `
+        INSERT INTO reported_conflicts (date, event_ids, reported_at)
+        VALUES ($1, $2, now())
+        ON CONFLICT (date) DO UPDATE SET event_ids = EXCLUDED.event_ids, reported_at = EXCLUDED.reported_at;
+    `
+	_, err := r.db(ctx).Exec(ctx, query, normalizeDate(date), eventIDs)
+	if err != nil {
+		return fmt.Errorf("failed to record reported conflict for date %s: %w", date.Format("2006-01-02"), err)
+	}
+	return nil
+}
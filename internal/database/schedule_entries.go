@@ -10,22 +10,34 @@ import (
 
 // ScheduleEntry represents a row in the schedule_entries table.
 type ScheduleEntry struct {
-	Date         time.Time `db:"date"`
-	LocationCode string    `db:"location_code"`
-	Status       string    `db:"status"`
+	Date         time.Time         `db:"date"`
+	LocationCode string            `db:"location_code"`
+	Status       string            `db:"status"`
+	Category     *string           `db:"category"` // Use pointer for nullable text
+	IsWorkingDay bool              `db:"is_working_day"`
+	Note         *string           `db:"note"` // Use pointer for nullable text
+	Tags         map[string]string `db:"tags"`
 }
 
 // UpsertScheduleEntry inserts or updates a schedule entry.
 func (r *Repository) UpsertScheduleEntry(ctx context.Context, entry ScheduleEntry) error {
 	query := `
-        INSERT INTO schedule_entries (date, location_code, status)
-        VALUES ($1, $2, $3)
+        INSERT INTO schedule_entries (date, location_code, status, category, is_working_day, note, tags)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
         ON CONFLICT (date) DO UPDATE SET
             location_code = EXCLUDED.location_code,
-            status = EXCLUDED.status;
+            status = EXCLUDED.status,
+            category = EXCLUDED.category,
+            is_working_day = EXCLUDED.is_working_day,
+            note = EXCLUDED.note,
+            tags = EXCLUDED.tags;
     `
 	normalizedDate := normalizeDate(entry.Date)
-	_, err := r.pool.Exec(ctx, query, normalizedDate, entry.LocationCode, entry.Status)
+	tags := entry.Tags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	_, err := r.db(ctx).Exec(ctx, query, normalizedDate, entry.LocationCode, entry.Status, entry.Category, entry.IsWorkingDay, entry.Note, tags)
 	if err != nil {
 		return fmt.Errorf("failed to upsert schedule entry for date %s: %w", entry.Date.Format("2006-01-02"), err)
 	}
@@ -35,9 +47,9 @@ func (r *Repository) UpsertScheduleEntry(ctx context.Context, entry ScheduleEntr
 // GetScheduleEntry retrieves a schedule entry for a specific date.
 func (r *Repository) GetScheduleEntry(ctx context.Context, date time.Time) (*ScheduleEntry, error) {
 	entry := &ScheduleEntry{}
-	query := "SELECT date, location_code, status FROM schedule_entries WHERE date = $1"
+	query := "SELECT date, location_code, status, category, is_working_day, note, tags FROM schedule_entries WHERE date = $1"
 	normalizedDate := normalizeDate(date)
-	err := r.pool.QueryRow(ctx, query, normalizedDate).Scan(&entry.Date, &entry.LocationCode, &entry.Status)
+	err := r.db(ctx).QueryRow(ctx, query, normalizedDate).Scan(&entry.Date, &entry.LocationCode, &entry.Status, &entry.Category, &entry.IsWorkingDay, &entry.Note, &entry.Tags)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil // Return nil, nil if not found is expected behavior
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Triggers of the changes recorded in the schedule_entry_history table.
+const (
+	// Incremental syncs, started by webhook notifications (or polling).
+	TriggerIncrementalSync = "incremental_sync"
+	// Full syncs, at startup, periodically or when the sync token expires.
+	TriggerFullSync = "full_sync"
+	// The daily horizon maintenance task.
+	TriggerHorizonMaintenance = "horizon_maintenance"
+	// Reconciliations run outside of the tasks above.
+	TriggerReconciliation = "reconciliation"
+	// Restorations of deleted events with the admin CLI.
+	TriggerRestore = "restore"
+	// Reverts of dates to an earlier value with the admin CLI.
+	TriggerRevert = "revert"
+	// Corrections of dates with the admin CLI, which can change frozen
+	// dates.
+	TriggerCorrection = "correction"
+)
+
+// ScheduleEntryChange represents a row in the schedule_entry_history table:
+// a change of the schedule entry of a date.
+type ScheduleEntryChange struct {
+	ID              int64     `db:"id"`
+	Date            time.Time `db:"date"`
+	OldLocationCode *string   `db:"old_location_code"` // Use pointer for nullable text
+	OldStatus       *string   `db:"old_status"`        // Use pointer for nullable text
+	NewLocationCode string    `db:"new_location_code"`
+	NewStatus       string    `db:"new_status"`
+	Trigger         string    `db:"trigger"`
+	EventID         *string   `db:"event_id"` // Use pointer for nullable text
+	SyncRunID       string    `db:"sync_run_id"`
+	ChangedAt       time.Time `db:"changed_at"`
+}
+
+// InsertScheduleEntryChange appends a change to the schedule history.
+func (r *Repository) InsertScheduleEntryChange(ctx context.Context, change ScheduleEntryChange) error {
+	query := `
+        INSERT INTO schedule_entry_history (date, old_location_code, old_status, new_location_code, new_status, trigger, event_id, sync_run_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+    `
+	_, err := r.db(ctx).Exec(ctx, query, normalizeDate(change.Date), change.OldLocationCode, change.OldStatus, change.NewLocationCode, change.NewStatus, change.Trigger, change.EventID, change.SyncRunID)
+	if err != nil {
+		return fmt.Errorf("failed to record schedule change for date %s: %w", change.Date.Format("2006-01-02"), err)
+	}
+	return nil
+}
+
+// GetScheduleEntryHistory retrieves the changes of the dates between from
+// and to (inclusive), sorted by date and in the order they were made.
+func (r *Repository) GetScheduleEntryHistory(ctx context.Context, from, to time.Time) ([]ScheduleEntryChange, error) {
+	changes := []ScheduleEntryChange{}
+	query := `
+        SELECT id, date, old_location_code, old_status, new_location_code, new_status, trigger, event_id, sync_run_id, changed_at
+        FROM schedule_entry_history
+        WHERE date BETWEEN $1 AND $2
+        ORDER BY date, changed_at, id
+    `
+	rows, err := r.db(ctx).Query(ctx, query, normalizeDate(from), normalizeDate(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedule history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change ScheduleEntryChange
+		err := rows.Scan(&change.ID, &change.Date, &change.OldLocationCode, &change.OldStatus, &change.NewLocationCode, &change.NewStatus, &change.Trigger, &change.EventID, &change.SyncRunID, &change.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule history row: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedule history rows: %w", err)
+	}
+
+	return changes, nil
+}
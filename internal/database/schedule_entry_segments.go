@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ScheduleEntrySegment represents a row in the schedule_entry_segments
+// table: the location of one half of a day.
+type ScheduleEntrySegment struct {
+	Date         time.Time `db:"date"`
+	Half         string    `db:"half"`
+	LocationCode string    `db:"location_code"`
+	Status       string    `db:"status"`
+	Category     *string   `db:"category"` // Use pointer for nullable text
+	IsWorkingDay bool      `db:"is_working_day"`
+}
+
+// ReplaceScheduleEntrySegments replaces all the segments of a date with
+// the given ones in a single transaction.
+func (r *Repository) ReplaceScheduleEntrySegments(ctx context.Context, date time.Time, segments []ScheduleEntrySegment) error {
+	normalizedDate := normalizeDate(date)
+	dateStr := date.Format("2006-01-02")
+
+	tx, err := r.db(ctx).Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for segments of %s: %w", dateStr, err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM schedule_entry_segments WHERE date = $1", normalizedDate)
+	if err != nil {
+		return fmt.Errorf("failed to delete segments of %s: %w", dateStr, err)
+	}
+
+	query := `
+        INSERT INTO schedule_entry_segments (date, half, location_code, status, category, is_working_day)
+        VALUES ($1, $2, $3, $4, $5, $6);
+    `
+	for _, segment := range segments {
+		_, err = tx.Exec(ctx, query, normalizedDate, segment.Half, segment.LocationCode, segment.Status, segment.Category, segment.IsWorkingDay)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s segment of %s: %w", segment.Half, dateStr, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit segments of %s: %w", dateStr, err)
+	}
+	return nil
+}
+
+// GetScheduleEntrySegments retrieves the segments of a date ordered by
+// half (morning first).
+func (r *Repository) GetScheduleEntrySegments(ctx context.Context, date time.Time) ([]ScheduleEntrySegment, error) {
+	segments := []ScheduleEntrySegment{}
+	query := `
+        SELECT date, half, location_code, status, category, is_working_day
+        FROM schedule_entry_segments
+        WHERE date = $1
+        ORDER BY half
+    `
+	rows, err := r.db(ctx).Query(ctx, query, normalizeDate(date))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments for date %s: %w", date.Format("2006-01-02"), err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var segment ScheduleEntrySegment
+		err := rows.Scan(&segment.Date, &segment.Half, &segment.LocationCode, &segment.Status, &segment.Category, &segment.IsWorkingDay)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan segment row: %w", err)
+		}
+		segments = append(segments, segment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segment rows: %w", err)
+	}
+
+	return segments, nil
+}
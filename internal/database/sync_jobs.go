@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Kinds of sync jobs.
+const (
+	// Incremental sync, which falls back to a full sync if needed.
+	SyncJobIncremental = "incremental"
+	// Full sync in the configured mode.
+	SyncJobFull = "full"
+	// Reconciliation of a range of dates.
+	SyncJobReconcileRange = "reconcile_range"
+)
+
+// Statuses of sync jobs.
+const (
+	SyncJobPending = "pending"
+	SyncJobRunning = "running"
+	SyncJobDone    = "done"
+	// The job failed too many times, and won't be retried unless it is
+	// requeued.
+	SyncJobDead = "dead"
+)
+
+// SyncJob represents a row in the sync_jobs table: a sync which has to be
+// run.
+type SyncJob struct {
+	ID         int64      `db:"id"`
+	Kind       string     `db:"kind"`
+	RangeStart *time.Time `db:"range_start"` // Only for reconcile_range jobs
+	RangeEnd   *time.Time `db:"range_end"`   // Only for reconcile_range jobs
+	Status     string     `db:"status"`
+	Attempts   int        `db:"attempts"`
+	LastError  *string    `db:"last_error"` // Use pointer for nullable text
+	NextRunAt  time.Time  `db:"next_run_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+}
+
+// DedupKey identifies the work done by the job, so the same job isn't
+// queued twice while it is waiting for its first attempt.
+func (j SyncJob) DedupKey() string {
+	if j.Kind == SyncJobReconcileRange && j.RangeStart != nil && j.RangeEnd != nil {
+		return fmt.Sprintf("%s:%s:%s", j.Kind, j.RangeStart.Format("2006-01-02"), j.RangeEnd.Format("2006-01-02"))
+	}
+	return j.Kind
+}
+
+const syncJobColumns = "id, kind, range_start, range_end, status, attempts, last_error, next_run_at, created_at, updated_at"
+
+func scanSyncJob(row pgx.Row) (*SyncJob, error) {
+	var job SyncJob
+	err := row.Scan(&job.ID, &job.Kind, &job.RangeStart, &job.RangeEnd, &job.Status, &job.Attempts, &job.LastError, &job.NextRunAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// EnqueueSyncJob queues a sync job to be run right away. It is a noop if
+// the same job is already queued and hasn't been attempted yet.
+func (r *Repository) EnqueueSyncJob(ctx context.Context, job SyncJob) error {
+	var rangeStart, rangeEnd *time.Time
+	if job.RangeStart != nil && job.RangeEnd != nil {
+		start, end := normalizeDate(*job.RangeStart), normalizeDate(*job.RangeEnd)
+		rangeStart, rangeEnd = &start, &end
+	}
+	query := `
+        INSERT INTO sync_jobs (kind, range_start, range_end, dedup_key)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (dedup_key) WHERE status = 'pending' AND attempts = 0 DO NOTHING;
+    `
+	_, err := r.db(ctx).Exec(ctx, query, job.Kind, rangeStart, rangeEnd, job.DedupKey())
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s sync job: %w", job.Kind, err)
+	}
+	return nil
+}
+
+// ClaimDueSyncJob marks the oldest pending job which is due as running and
+// returns it, or returns nil if there isn't any.
+func (r *Repository) ClaimDueSyncJob(ctx context.Context, now time.Time) (*SyncJob, error) {
+	query := `
+        UPDATE sync_jobs SET status = 'running', updated_at = now()
+        WHERE id = (
+            SELECT id FROM sync_jobs
+            WHERE status = 'pending' AND next_run_at <= $1
+            ORDER BY id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING ` + syncJobColumns
+	job, err := scanSyncJob(r.db(ctx).QueryRow(ctx, query, now))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim a due sync job: %w", err)
+	}
+	return job, nil
+}
+
+// RequeueInterruptedSyncJobs queues again the jobs which were left running
+// (e.g. because the instance running them crashed), counting it as a failed
+// attempt. It must only be called while holding the sync lock, so no job is
+// actually running.
+func (r *Repository) RequeueInterruptedSyncJobs(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+        UPDATE sync_jobs
+        SET status = 'pending', attempts = attempts + 1, last_error = 'interrupted before finishing', next_run_at = $1, updated_at = now()
+        WHERE status = 'running'
+    `
+	tag, err := r.db(ctx).Exec(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue interrupted sync jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkSyncJobDone marks a job as finished successfully.
+func (r *Repository) MarkSyncJobDone(ctx context.Context, id int64) error {
+	_, err := r.db(ctx).Exec(ctx, "UPDATE sync_jobs SET status = 'done', updated_at = now() WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to mark sync job %d as done: %w", id, err)
+	}
+	return nil
+}
+
+// MarkSyncJobFailed records a failed attempt to run a job, and when it
+// should be retried.
+func (r *Repository) MarkSyncJobFailed(ctx context.Context, id int64, lastError string, nextRunAt time.Time) error {
+	query := `
+        UPDATE sync_jobs
+        SET status = 'pending', attempts = attempts + 1, last_error = $2, next_run_at = $3, updated_at = now()
+        WHERE id = $1
+    `
+	_, err := r.db(ctx).Exec(ctx, query, id, lastError, nextRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to record failed attempt of sync job %d: %w", id, err)
+	}
+	return nil
+}
+
+// MarkSyncJobDead records the last failed attempt to run a job, which
+// won't be retried.
+func (r *Repository) MarkSyncJobDead(ctx context.Context, id int64, lastError string) error {
+	query := `
+        UPDATE sync_jobs
+        SET status = 'dead', attempts = attempts + 1, last_error = $2, updated_at = now()
+        WHERE id = $1
+    `
+	_, err := r.db(ctx).Exec(ctx, query, id, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to mark sync job %d as dead: %w", id, err)
+	}
+	return nil
+}
+
+// ListSyncJobs retrieves the most recent jobs with the given status (or all
+// of them, if it is empty), newest first.
+func (r *Repository) ListSyncJobs(ctx context.Context, status string, limit int) ([]SyncJob, error) {
+	jobs := []SyncJob{}
+	query := `
+        SELECT ` + syncJobColumns + `
+        FROM sync_jobs
+        WHERE $1 = '' OR status = $1
+        ORDER BY id DESC
+        LIMIT $2
+    `
+	rows, err := r.db(ctx).Query(ctx, query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync jobs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanSyncJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sync job row: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sync job rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// RequeueSyncJob queues a dead or finished job again to be run right
+// away, with a new set of attempts.
+func (r *Repository) RequeueSyncJob(ctx context.Context, id int64) error {
+	query := `
+        UPDATE sync_jobs
+        SET status = 'pending', attempts = 0, next_run_at = now(), updated_at = now()
+        WHERE id = $1 AND status IN ('dead', 'done')
+    `
+	tag, err := r.db(ctx).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue sync job %d (an identical job may already be queued): %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("there isn't a dead or finished sync job with ID %d", id)
+	}
+	return nil
+}
@@ -11,7 +11,7 @@ import (
 func (r *Repository) GetSyncState(ctx context.Context, key string) (string, error) {
 	var value string
 	query := "SELECT value FROM sync_state WHERE key = $1"
-	err := r.pool.QueryRow(ctx, query, key).Scan(&value)
+	err := r.db(ctx).QueryRow(ctx, query, key).Scan(&value)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return "", fmt.Errorf("sync state key '%s' not found", key)
@@ -28,7 +28,7 @@ func (r *Repository) SetSyncState(ctx context.Context, key, value string) error
         VALUES ($1, $2)
         ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
     `
-	_, err := r.pool.Exec(ctx, query, key, value)
+	_, err := r.db(ctx).Exec(ctx, query, key, value)
 	if err != nil {
 		return fmt.Errorf("failed to set sync state for key '%s': %w", key, err)
 	}
@@ -33,8 +33,10 @@ func NewClient(cfg config.SMTPConfig) *Client {
 	}
 }
 
-// SendConfirmation sends the appropriate confirmation email based on the type and changes.
-func (c *Client) SendConfirmation(changes map[string]string) error {
+// SendConfirmation sends the appropriate confirmation email based on the
+// type and changes. notes contains additional explanations about actions
+// performed during the sync (e.g. expanded events).
+func (c *Client) SendConfirmation(changes map[string]string, notes []string) error {
 	if c.dialer == nil || c.cfg.SenderAddress == "" || c.cfg.RecipientAddress == "" {
 		log.Println("SMTP configuration incomplete or client not initialized, skipping email.")
 		return nil
@@ -43,7 +45,7 @@ func (c *Client) SendConfirmation(changes map[string]string) error {
 	var subject, htmlBody string
 	var err error
 
-	subject, htmlBody, err = c.formatGenericSyncEmail(changes)
+	subject, htmlBody, err = c.formatGenericSyncEmail(changes, notes)
 
 	if err != nil {
 		return fmt.Errorf("failed to format email: %w", err)
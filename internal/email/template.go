@@ -14,7 +14,7 @@ const signatureHTML = `
 `
 
 // formatGenericSyncEmail formats the email summary for full sync changes using HTML.
-func (c *Client) formatGenericSyncEmail(changes map[string]string) (string, string, error) {
+func (c *Client) formatGenericSyncEmail(changes map[string]string, notes []string) (string, string, error) {
 	subject := "[ZenithPlanner] 💺 Location changed successfully"
 
 	// Sort dates for consistent output
@@ -31,13 +31,21 @@ func (c *Client) formatGenericSyncEmail(changes map[string]string) (string, stri
 
 	bodyData := map[string]interface{}{
 		"ChangeList": template.HTML("<ul>" + strings.Join(changeLines, "") + "</ul>"), // Mark as HTML
-		"Signature":  template.HTML(signatureHTML),                                    // Mark as HTML
+		"HasChanges": len(changes) > 0,
+		"Notes":      notes,
+		"Signature":  template.HTML(signatureHTML), // Mark as HTML
 	}
 
 	bodyTmpl := `
 	<p>Hi,</p>
+	{{if .HasChanges}}
 	<p>You have successfully changed your location for the following dates:</p>
 	{{.ChangeList}}
+	{{end}}
+	{{if .Notes}}
+	<p>Additionally, please note that:</p>
+	<ul>{{range .Notes}}<li>{{.}}</li>{{end}}</ul>
+	{{end}}
 	{{.Signature}}
 	`
 	t, err := template.New("fullsync").Parse(bodyTmpl)
@@ -62,7 +62,13 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Println("Webhook notification acknowledged, requesting sync...")
-	h.syncer.RequestSync()
+	if err := h.syncer.RequestSync(r.Context()); err != nil {
+		// Google Calendar retries the notifications which fail with a 5xx
+		// status.
+		log.Printf("Error queueing the sync: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
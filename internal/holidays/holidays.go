@@ -0,0 +1,155 @@
+// Package holidays imports public holidays from iCalendar files.
+package holidays
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+	"gomodules.avm99963.com/zenithplanner/internal/ics"
+)
+
+// Rename is a holiday whose name changed between imports.
+type Rename struct {
+	Date    string
+	OldName string
+	NewName string
+}
+
+// Diff describes the changes made to the holidays table by an import.
+type Diff struct {
+	Added   []database.Holiday
+	Removed []database.Holiday
+	Renamed []Rename
+}
+
+// IsEmpty returns whether the import didn't change anything.
+func (d *Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Renamed) == 0
+}
+
+// Lines returns a human-readable description of each change, ordered by
+// date.
+func (d *Diff) Lines() []string {
+	type line struct {
+		date string
+		text string
+	}
+	var lines []line
+	for _, h := range d.Added {
+		dateStr := h.Date.Format("2006-01-02")
+		lines = append(lines, line{dateStr, fmt.Sprintf("+ %s %s", dateStr, h.Name)})
+	}
+	for _, h := range d.Removed {
+		dateStr := h.Date.Format("2006-01-02")
+		lines = append(lines, line{dateStr, fmt.Sprintf("- %s %s", dateStr, h.Name)})
+	}
+	for _, r := range d.Renamed {
+		lines = append(lines, line{r.Date, fmt.Sprintf("~ %s %s → %s", r.Date, r.OldName, r.NewName)})
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].date < lines[j].date
+	})
+
+	result := make([]string, 0, len(lines))
+	for _, l := range lines {
+		result = append(result, l.text)
+	}
+	return result
+}
+
+// LoadFiles parses the all-day events of the given .ics files as holidays.
+// If several files define a holiday on the same date, the first one wins.
+func LoadFiles(paths []string) ([]database.Holiday, error) {
+	byDate := make(map[string]database.Holiday)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open holidays file %s: %w", path, err)
+		}
+		components, err := ics.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse holidays file %s: %w", path, err)
+		}
+
+		for _, event := range ics.AllDayEvents(components) {
+			if event.Recurring {
+				log.Printf("Warning: holiday %q in %s is recurring. Only its first occurrence will be imported.", event.Summary, path)
+			}
+			for date := event.First; !date.After(event.Last); date = date.AddDate(0, 0, 1) {
+				dateStr := date.Format("2006-01-02")
+				if existing, ok := byDate[dateStr]; ok {
+					log.Printf("Warning: %s has several holidays (%q from %s and %q from %s). Keeping the first one.",
+						dateStr, existing.Name, existing.Source, event.Summary, path)
+					continue
+				}
+				byDate[dateStr] = database.Holiday{Date: date, Name: event.Summary, Source: path}
+			}
+		}
+	}
+
+	holidays := make([]database.Holiday, 0, len(byDate))
+	for _, holiday := range byDate {
+		holidays = append(holidays, holiday)
+	}
+	sort.Slice(holidays, func(i, j int) bool {
+		return holidays[i].Date.Before(holidays[j].Date)
+	})
+	return holidays, nil
+}
+
+// Import loads the holidays from the given .ics files, replaces the
+// holidays table with them and returns what changed.
+func Import(ctx context.Context, dbRepo *database.Repository, paths []string) (*Diff, error) {
+	newHolidays, err := LoadFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	oldHolidays, err := dbRepo.ListHolidays(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := ComputeDiff(oldHolidays, newHolidays)
+	if diff.IsEmpty() {
+		return diff, nil
+	}
+
+	if err := dbRepo.ReplaceHolidays(ctx, newHolidays); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// ComputeDiff returns the changes needed to go from the old holidays to the
+// new ones.
+func ComputeDiff(oldHolidays, newHolidays []database.Holiday) *Diff {
+	diff := &Diff{}
+	oldByDate := make(map[string]database.Holiday, len(oldHolidays))
+	for _, holiday := range oldHolidays {
+		oldByDate[holiday.Date.Format("2006-01-02")] = holiday
+	}
+
+	for _, holiday := range newHolidays {
+		dateStr := holiday.Date.Format("2006-01-02")
+		old, existed := oldByDate[dateStr]
+		if !existed {
+			diff.Added = append(diff.Added, holiday)
+		} else if old.Name != holiday.Name {
+			diff.Renamed = append(diff.Renamed, Rename{Date: dateStr, OldName: old.Name, NewName: holiday.Name})
+		}
+		delete(oldByDate, dateStr)
+	}
+
+	for _, holiday := range oldHolidays {
+		if _, removed := oldByDate[holiday.Date.Format("2006-01-02")]; removed {
+			diff.Removed = append(diff.Removed, holiday)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,121 @@
+package ics
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxLineOctets is the maximum length of a content line before folding.
+const maxLineOctets = 75
+
+// SetProperty replaces the properties with the given name with a single
+// one with the given value and parameters, or adds it if the component
+// doesn't have it.
+func (c *Component) SetProperty(name, value string, params map[string]string) {
+	prop := Property{Name: name, Params: params, Value: value}
+	if prop.Params == nil {
+		prop.Params = map[string]string{}
+	}
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			c.Properties[i] = prop
+			c.RemoveProperty(name, i+1)
+			return
+		}
+	}
+	c.Properties = append(c.Properties, prop)
+}
+
+// AddProperty adds a property, keeping the existing ones with the same
+// name (e.g. for EXDATE).
+func (c *Component) AddProperty(name, value string, params map[string]string) {
+	if params == nil {
+		params = map[string]string{}
+	}
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Value: value})
+}
+
+// RemoveProperty removes the properties with the given name, starting at
+// the given index (0 to remove all of them).
+func (c *Component) RemoveProperty(name string, from int) {
+	properties := c.Properties[:from]
+	for _, p := range c.Properties[from:] {
+		if p.Name != name {
+			properties = append(properties, p)
+		}
+	}
+	c.Properties = properties
+}
+
+// PropertyValues returns the values of all the properties with the given
+// name.
+func (c *Component) PropertyValues(name string) []string {
+	var values []string
+	for _, p := range c.Properties {
+		if p.Name == name {
+			values = append(values, p.Value)
+		}
+	}
+	return values
+}
+
+// Encode writes the components in the iCalendar format.
+func Encode(w io.Writer, components ...*Component) error {
+	var b strings.Builder
+	for _, c := range components {
+		c.encode(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c *Component) encode(b *strings.Builder) {
+	writeLine(b, "BEGIN:"+c.Name)
+	for _, p := range c.Properties {
+		writeLine(b, p.contentLine())
+	}
+	for _, child := range c.Children {
+		child.encode(b)
+	}
+	writeLine(b, "END:"+c.Name)
+}
+
+func (p Property) contentLine() string {
+	var b strings.Builder
+	b.WriteString(p.Name)
+	keys := make([]string, 0, len(p.Params))
+	for key := range p.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := p.Params[key]
+		if strings.ContainsAny(value, ":;,") {
+			value = `"` + value + `"`
+		}
+		b.WriteString(";" + key + "=" + value)
+	}
+	b.WriteString(":" + p.Value)
+	return b.String()
+}
+
+// writeLine writes a content line, folding it so that no line is longer
+// than 75 octets (without splitting UTF-8 characters).
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // The leading space counts.
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,74 @@
+package ics
+
+import (
+	"time"
+)
+
+// AllDayEvent is a VEVENT whose start and end are dates.
+type AllDayEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	// First and last dates covered by the event (both inclusive).
+	First time.Time
+	Last  time.Time
+	// Whether the event has a recurrence rule. Recurrences aren't
+	// expanded, so only the first occurrence is represented.
+	Recurring bool
+	Component *Component
+}
+
+// AllDayEvents returns the all-day events found in the given components
+// (and their children). Events with a time of day are skipped.
+func AllDayEvents(components []*Component) []AllDayEvent {
+	var events []AllDayEvent
+	for _, c := range components {
+		if c.Name == "VEVENT" {
+			if event, ok := parseAllDayEvent(c); ok {
+				events = append(events, event)
+			}
+		}
+		events = append(events, AllDayEvents(c.Children)...)
+	}
+	return events
+}
+
+func parseAllDayEvent(c *Component) (AllDayEvent, bool) {
+	first, isDate, err := ParseDate(c.Property("DTSTART"))
+	if err != nil || !isDate {
+		return AllDayEvent{}, false
+	}
+
+	// DTEND is exclusive and optional (defaulting to a single day).
+	last := first
+	if end := c.Property("DTEND"); end != nil {
+		endDate, isDate, err := ParseDate(end)
+		if err != nil || !isDate {
+			return AllDayEvent{}, false
+		}
+		if endDate.After(first) {
+			last = endDate.AddDate(0, 0, -1)
+		}
+	}
+
+	return AllDayEvent{
+		UID:         c.PropertyValue("UID"),
+		Summary:     UnescapeText(c.PropertyValue("SUMMARY")),
+		Description: UnescapeText(c.PropertyValue("DESCRIPTION")),
+		First:       first,
+		Last:        last,
+		Recurring:   c.Property("RRULE") != nil,
+		Component:   c,
+	}, true
+}
+
+// UpdatedTimestamp returns the LAST-MODIFIED (or DTSTAMP) of a VEVENT in
+// the RFC 3339 format.
+func UpdatedTimestamp(vevent *Component) string {
+	for _, name := range []string{"LAST-MODIFIED", "DTSTAMP"} {
+		if t, err := time.Parse("20060102T150405Z", vevent.PropertyValue(name)); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return time.Unix(0, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,181 @@
+// Package ics implements a minimal iCalendar (RFC 5545) parser, which
+// supports the subset needed to read all-day events.
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Property is a content line of an iCalendar component.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is an iCalendar component (e.g. VCALENDAR or VEVENT).
+type Component struct {
+	Name       string
+	Properties []Property
+	Children   []*Component
+}
+
+// Property returns the first property with the given name, or nil if the
+// component doesn't have it.
+func (c *Component) Property(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// PropertyValue returns the value of the first property with the given
+// name, or "" if the component doesn't have it.
+func (c *Component) PropertyValue(name string) string {
+	if p := c.Property(name); p != nil {
+		return p.Value
+	}
+	return ""
+}
+
+// Parse reads an iCalendar stream and returns its top-level components
+// (usually a single VCALENDAR).
+func Parse(r io.Reader) ([]*Component, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*Component
+	var stack []*Component
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseContentLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			stack = append(stack, &Component{Name: strings.ToUpper(prop.Value)})
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, prop.Value)
+			}
+			component := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				roots = append(roots, component)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, component)
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of a component", i+1, prop.Name)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("component %s is not closed", stack[len(stack)-1].Name)
+	}
+	return roots, nil
+}
+
+// unfoldLines splits the stream into content lines, joining the folded
+// ones (continuation lines start with a space or a tab).
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read iCalendar data: %w", err)
+	}
+	return lines, nil
+}
+
+// parseContentLine parses a line in the "NAME;PARAM=VALUE:VALUE" format.
+func parseContentLine(line string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+
+	// Find the colon which separates the value, skipping quoted parameter
+	// values.
+	inQuotes := false
+	valueStart := -1
+	for i, ch := range line {
+		if ch == '"' {
+			inQuotes = !inQuotes
+		} else if ch == ':' && !inQuotes {
+			valueStart = i
+			break
+		}
+	}
+	if valueStart == -1 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+
+	nameAndParams := strings.Split(line[:valueStart], ";")
+	prop.Name = strings.ToUpper(nameAndParams[0])
+	prop.Value = line[valueStart+1:]
+	for _, param := range nameAndParams[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// UnescapeText decodes a TEXT property value.
+func UnescapeText(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
+
+// EscapeText encodes a string as a TEXT property value.
+func EscapeText(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+	return replacer.Replace(value)
+}
+
+// ParseDate parses the value of a DATE or DATE-TIME property, returning
+// the date (in UTC, at midnight) and whether the value was a DATE.
+func ParseDate(p *Property) (date time.Time, isDate bool, err error) {
+	if p == nil {
+		return time.Time{}, false, fmt.Errorf("missing date property")
+	}
+	value := p.Value
+	if p.Params["VALUE"] == "DATE" || len(value) == 8 {
+		date, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid date %q in %s: %w", value, p.Name, err)
+		}
+		return date, true, nil
+	}
+
+	if len(value) < 8 {
+		return time.Time{}, false, fmt.Errorf("invalid date-time %q in %s", value, p.Name)
+	}
+	date, err = time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date-time %q in %s: %w", value, p.Name, err)
+	}
+	return date, false, nil
+}
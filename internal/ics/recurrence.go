@@ -0,0 +1,162 @@
+package ics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpansionHorizon limits how far into the future recurring events
+// without an end are expanded.
+const ExpansionHorizon = 2 * 365 * 24 * time.Hour
+
+// byDayNames maps the BYDAY values to their weekday.
+var byDayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ExpandDates returns the dates of the occurrences of an RRULE value (e.g.
+// "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4") starting at start, up to until
+// (inclusive). Only the DAILY, WEEKLY, MONTHLY and YEARLY frequencies with
+// the INTERVAL, COUNT, UNTIL, WKST and (weekly) BYDAY parts are supported.
+func ExpandDates(rrule string, start, until time.Time) ([]time.Time, error) {
+	freq := ""
+	interval, count := 1, 0
+	var ruleUntil time.Time
+	var byDay []time.Weekday
+
+	for _, part := range strings.Split(strings.TrimPrefix(rrule, "RRULE:"), ";") {
+		key, value, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			freq = strings.ToUpper(value)
+		case "INTERVAL":
+			interval, err = strconv.Atoi(value)
+		case "COUNT":
+			count, err = strconv.Atoi(value)
+		case "UNTIL":
+			ruleUntil, err = time.Parse("20060102", value[:min(8, len(value))])
+		case "BYDAY":
+			for _, name := range strings.Split(value, ",") {
+				weekday, ok := byDayNames[strings.ToUpper(name)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY value %q", name)
+				}
+				byDay = append(byDay, weekday)
+			}
+		case "WKST":
+			// Only relevant for BYWEEKNO and intervals with BYDAY, which
+			// aren't affected in practice.
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %q", part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE part %q: %w", part, err)
+		}
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid RRULE interval %d", interval)
+	}
+	if len(byDay) > 0 && freq != "WEEKLY" {
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if !ruleUntil.IsZero() && ruleUntil.Before(until) {
+		until = ruleUntil
+	}
+
+	var dates []time.Time
+	add := func(date time.Time) bool {
+		if date.After(until) || (count > 0 && len(dates) >= count) {
+			return false
+		}
+		dates = append(dates, date)
+		return true
+	}
+
+	switch freq {
+	case "DAILY":
+		for date := start; add(date); date = date.AddDate(0, 0, interval) {
+		}
+	case "WEEKLY":
+		if len(byDay) == 0 {
+			for date := start; add(date); date = date.AddDate(0, 0, 7*interval) {
+			}
+			break
+		}
+		weekStart := start.AddDate(0, 0, -int(start.Weekday()))
+		for week := weekStart; !week.After(until) && (count == 0 || len(dates) < count); week = week.AddDate(0, 0, 7*interval) {
+			for offset := 0; offset < 7; offset++ {
+				date := week.AddDate(0, 0, offset)
+				if date.Before(start) || !containsWeekday(byDay, date.Weekday()) {
+					continue
+				}
+				if !add(date) {
+					break
+				}
+			}
+		}
+	case "MONTHLY":
+		for i := 0; ; i++ {
+			date := start.AddDate(0, i*interval, 0)
+			if date.Day() != start.Day() {
+				continue // The month doesn't have that day.
+			}
+			if !add(date) {
+				break
+			}
+		}
+	case "YEARLY":
+		for i := 0; ; i++ {
+			date := start.AddDate(i*interval, 0, 0)
+			if date.Day() != start.Day() {
+				continue // February 29th in a non-leap year.
+			}
+			if !add(date) {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", freq)
+	}
+	return dates, nil
+}
+
+// ExpandEvent returns the dates of the occurrences of a recurring VEVENT
+// which starts at start, up to ExpansionHorizon after now, without the
+// ones excluded with EXDATE.
+func ExpandEvent(vevent *Component, start, now time.Time) ([]time.Time, error) {
+	dates, err := ExpandDates(vevent.PropertyValue("RRULE"), start, now.Add(ExpansionHorizon))
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]bool)
+	for _, value := range vevent.PropertyValues("EXDATE") {
+		for _, exdate := range strings.Split(value, ",") {
+			excluded[exdate[:min(8, len(exdate))]] = true
+		}
+	}
+	occurrences := dates[:0]
+	for _, date := range dates {
+		if !excluded[date.Format("20060102")] {
+			occurrences = append(occurrences, date)
+		}
+	}
+	return occurrences, nil
+}
+
+func containsWeekday(weekdays []time.Weekday, weekday time.Weekday) bool {
+	for _, w := range weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+	return false
+}
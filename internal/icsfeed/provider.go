@@ -0,0 +1,299 @@
+// Package icsfeed implements a read-only calendar.CalendarProvider backed
+// by a published iCalendar feed (e.g. the secret address of a Google or
+// Outlook calendar) or a local .ics file.
+package icsfeed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/ics"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrReadOnly is returned by the methods which would modify the calendar.
+var ErrReadOnly = errors.New("the iCalendar feed is read-only")
+
+// Provider is a read-only calendar.CalendarProvider which fetches an
+// iCalendar feed each time events are listed.
+//
+// Feeds don't have sync tokens, so the provider keeps the events of the
+// last listing in memory and returns the differences with them when
+// listing with its sync token. Other sync tokens (e.g. the one persisted
+// before a restart) are rejected with 410 Gone, which makes the sync code
+// fall back to a full sync.
+//
+// Each day covered by a multi-day or recurring event is returned as a
+// separate single-day event, with the ID of the event followed by "_" and
+// the date (e.g. "abc@google.com_20250310").
+type Provider struct {
+	source     string
+	httpClient *http.Client
+	// Function which returns the current time (replaceable for testing).
+	now func() time.Time
+
+	mu sync.Mutex
+	// Events returned by the last listing, indexed by ID.
+	snapshot map[string]*gcal.Event
+	// Sync token which corresponds to snapshot.
+	snapshotToken string
+}
+
+var _ calendar.CalendarProvider = (*Provider)(nil)
+
+// NewProvider creates a provider for the feed configured in cfg.
+func NewProvider(cfg config.ICSFeedConfig) (*Provider, error) {
+	if cfg.Source == "" {
+		return nil, fmt.Errorf("the iCalendar feed source is empty")
+	}
+	source := cfg.Source
+	if rest, ok := strings.CutPrefix(source, "webcal://"); ok {
+		source = "https://" + rest
+	}
+	return &Provider{
+		source:     source,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+// ListEvents implements calendar.CalendarProvider. All events are
+// returned in a single page.
+func (p *Provider) ListEvents(ctx context.Context, opts calendar.ListOptions) (*calendar.EventPage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if opts.SyncToken != "" && (p.snapshot == nil || opts.SyncToken != p.snapshotToken) {
+		return nil, &googleapi.Error{
+			Code:    http.StatusGone,
+			Message: "the feed snapshot of the sync token isn't available, a full sync is required",
+		}
+	}
+
+	data, err := p.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	components, err := ics.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse iCalendar feed: %w", err)
+	}
+	current := p.feedEvents(components)
+
+	var events []*gcal.Event
+	if opts.SyncToken == "" {
+		for _, event := range current {
+			if opts.InTimeRange(event) {
+				events = append(events, event)
+			}
+		}
+	} else {
+		events = diff(p.snapshot, current)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Id < events[j].Id
+	})
+
+	p.snapshot = current
+	p.snapshotToken = snapshotToken(current)
+	return &calendar.EventPage{Events: events, NextSyncToken: p.snapshotToken}, nil
+}
+
+// GetEvent implements calendar.CalendarProvider. The feed is fetched to
+// look up the event.
+func (p *Provider) GetEvent(ctx context.Context, eventID string) (*gcal.Event, error) {
+	data, err := p.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	components, err := ics.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse iCalendar feed: %w", err)
+	}
+	event, ok := p.feedEvents(components)[eventID]
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("event %s not found in the feed", eventID)}
+	}
+	return event, nil
+}
+
+// InsertEvent implements calendar.CalendarProvider. It always fails with
+// ErrReadOnly.
+func (p *Provider) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	return nil, ErrReadOnly
+}
+
+// PatchEvent implements calendar.CalendarProvider. It always fails with
+// ErrReadOnly.
+func (p *Provider) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error) {
+	return nil, ErrReadOnly
+}
+
+// DeleteEvent implements calendar.CalendarProvider. It always fails with
+// ErrReadOnly.
+func (p *Provider) DeleteEvent(ctx context.Context, eventID string) error {
+	return ErrReadOnly
+}
+
+// Watch implements calendar.CalendarProvider. It always fails with
+// ErrReadOnly, since feeds don't have push notifications.
+func (p *Provider) Watch(ctx context.Context, channel *gcal.Channel) (*gcal.Channel, error) {
+	return nil, ErrReadOnly
+}
+
+// StopChannel implements calendar.CalendarProvider. It always fails with
+// ErrReadOnly.
+func (p *Provider) StopChannel(ctx context.Context, channel *gcal.Channel) error {
+	return ErrReadOnly
+}
+
+// fetch returns the contents of the feed.
+func (p *Provider) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(p.source, "http://") && !strings.HasPrefix(p.source, "https://") {
+		data, err := os.ReadFile(p.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read iCalendar feed: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iCalendar feed request: %w", err)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		// The URL is omitted since it usually contains a secret.
+		return nil, fmt.Errorf("failed to fetch iCalendar feed: %w", errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch iCalendar feed: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read iCalendar feed: %w", err)
+	}
+	return data, nil
+}
+
+// feedEvents converts the all-day events of the feed into single-day
+// events, indexed by ID.
+func (p *Provider) feedEvents(components []*ics.Component) map[string]*gcal.Event {
+	allDayEvents := ics.AllDayEvents(components)
+
+	// Modified instances of recurring events, by UID and instance date.
+	overrides := make(map[string]map[string]ics.AllDayEvent)
+	for _, e := range allDayEvents {
+		if recurrenceID := e.Component.PropertyValue("RECURRENCE-ID"); recurrenceID != "" {
+			if overrides[e.UID] == nil {
+				overrides[e.UID] = make(map[string]ics.AllDayEvent)
+			}
+			overrides[e.UID][recurrenceID[:min(8, len(recurrenceID))]] = e
+		}
+	}
+
+	events := make(map[string]*gcal.Event)
+	for _, e := range allDayEvents {
+		if e.UID == "" || e.Component.Property("RECURRENCE-ID") != nil {
+			continue
+		}
+		if !e.Recurring {
+			addDays(events, e, e.First, e.Last, e.First == e.Last)
+			continue
+		}
+
+		dates, err := ics.ExpandEvent(e.Component, e.First, p.now())
+		if err != nil {
+			log.Printf("iCalendar feed: can't expand recurring event %s: %v", e.UID, err)
+			continue
+		}
+		span := e.Last.Sub(e.First)
+		for _, date := range dates {
+			dateKey := date.Format("20060102")
+			if override, ok := overrides[e.UID][dateKey]; ok {
+				addDays(events, override, override.First, override.Last, false)
+				continue
+			}
+			addDays(events, e, date, date.Add(span), false)
+		}
+	}
+	return events
+}
+
+// addDays adds an event for each date from first to last (inclusive).
+// Unless singleID is set, the date is appended to the ID of each event.
+func addDays(events map[string]*gcal.Event, e ics.AllDayEvent, first, last time.Time, singleID bool) {
+	if strings.EqualFold(e.Component.PropertyValue("STATUS"), "CANCELLED") {
+		return
+	}
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		id := e.UID
+		if !singleID {
+			id += "_" + date.Format("20060102")
+		}
+		events[id] = &gcal.Event{
+			Id:          id,
+			Summary:     e.Summary,
+			Description: e.Description,
+			Start:       &gcal.EventDateTime{Date: date.Format("2006-01-02")},
+			End:         &gcal.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+			Status:      "confirmed",
+			Updated:     ics.UpdatedTimestamp(e.Component),
+		}
+	}
+}
+
+// diff returns the events which were added or changed in current, and
+// the ones which were removed from previous as cancelled events.
+func diff(previous, current map[string]*gcal.Event) []*gcal.Event {
+	var events []*gcal.Event
+	for id, event := range current {
+		if old, ok := previous[id]; !ok || fingerprint(old) != fingerprint(event) {
+			events = append(events, event)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			events = append(events, &gcal.Event{Id: id, Status: "cancelled"})
+		}
+	}
+	return events
+}
+
+// fingerprint returns the fields of an event which matter to the sync
+// code. The update timestamp is left out since some servers (like Google
+// Calendar) set DTSTAMP to the time of each request.
+func fingerprint(event *gcal.Event) string {
+	return strings.Join([]string{event.Summary, event.Description, event.Start.Date, event.End.Date}, "\x00")
+}
+
+// snapshotToken returns a sync token which identifies a set of events.
+func snapshotToken(events map[string]*gcal.Event) string {
+	ids := make([]string, 0, len(events))
+	for id := range events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		io.WriteString(h, id+"\x00"+fingerprint(events[id])+"\x00")
+	}
+	return "icsfeed-" + hex.EncodeToString(h.Sum(nil))[:32]
+}
@@ -0,0 +1,195 @@
+package icsfeed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const feedHeader = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//EN\r\n"
+const feedFooter = "END:VCALENDAR\r\n"
+
+func vevent(lines ...string) string {
+	return "BEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nDTSTAMP:20250310T080000Z\r\nEND:VEVENT\r\n"
+}
+
+func writeFeed(t *testing.T, path string, events ...string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(feedHeader+strings.Join(events, "")+feedFooter), 0o600); err != nil {
+		t.Fatalf("failed to write feed: %v", err)
+	}
+}
+
+func newFileProvider(t *testing.T) (*Provider, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "feed.ics")
+	p, err := NewProvider(config.ICSFeedConfig{Source: path})
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	p.now = func() time.Time { return time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC) }
+	return p, path
+}
+
+func list(t *testing.T, p *Provider, syncToken string) ([]*gcal.Event, string) {
+	t.Helper()
+	page, err := p.ListEvents(context.Background(), calendar.ListOptions{SyncToken: syncToken})
+	if err != nil {
+		t.Fatalf("ListEvents() failed: %v", err)
+	}
+	return page.Events, page.NextSyncToken
+}
+
+func summariesByID(events []*gcal.Event) map[string]string {
+	summaries := make(map[string]string, len(events))
+	for _, event := range events {
+		if event.Status == "cancelled" {
+			summaries[event.Id] = "<cancelled>"
+		} else {
+			summaries[event.Id] = event.Start.Date + " " + event.Summary
+		}
+	}
+	return summaries
+}
+
+func assertSummaries(t *testing.T, events []*gcal.Event, want map[string]string) {
+	t.Helper()
+	got := summariesByID(events)
+	if len(got) != len(want) {
+		t.Errorf("got events %v, want %v", got, want)
+		return
+	}
+	for id, summary := range want {
+		if got[id] != summary {
+			t.Errorf("event %s = %q, want %q (all events: %v)", id, got[id], summary, got)
+		}
+	}
+}
+
+func TestListEventsSplitsAndExpandsEvents(t *testing.T) {
+	p, path := newFileProvider(t)
+	writeFeed(t, path,
+		vevent("UID:single", "DTSTART;VALUE=DATE:20250310", "DTEND;VALUE=DATE:20250311", "SUMMARY:HOM"),
+		vevent("UID:trip", "DTSTART;VALUE=DATE:20250311", "DTEND;VALUE=DATE:20250313", "SUMMARY:V"),
+		vevent("UID:weekly", "DTSTART;VALUE=DATE:20250314", "SUMMARY:LIB", "RRULE:FREQ=WEEKLY;COUNT=3", "EXDATE;VALUE=DATE:20250321"),
+		vevent("UID:weekly", "RECURRENCE-ID;VALUE=DATE:20250328", "DTSTART;VALUE=DATE:20250328", "SUMMARY:HOM"),
+		vevent("UID:meeting", "DTSTART:20250310T090000Z", "DTEND:20250310T100000Z", "SUMMARY:Meeting"),
+	)
+
+	events, _ := list(t, p, "")
+	assertSummaries(t, events, map[string]string{
+		"single":          "2025-03-10 HOM",
+		"trip_20250311":   "2025-03-11 V",
+		"trip_20250312":   "2025-03-12 V",
+		"weekly_20250314": "2025-03-14 LIB",
+		"weekly_20250328": "2025-03-28 HOM",
+	})
+}
+
+func TestListEventsReturnsChangesSinceSyncToken(t *testing.T) {
+	p, path := newFileProvider(t)
+	writeFeed(t, path,
+		vevent("UID:a", "DTSTART;VALUE=DATE:20250310", "SUMMARY:HOM"),
+		vevent("UID:b", "DTSTART;VALUE=DATE:20250311", "SUMMARY:HOM"),
+		vevent("UID:c", "DTSTART;VALUE=DATE:20250312", "SUMMARY:HOM"),
+	)
+	_, syncToken := list(t, p, "")
+
+	// Refetching an unchanged feed returns nothing.
+	events, sameToken := list(t, p, syncToken)
+	if len(events) != 0 || sameToken != syncToken {
+		t.Errorf("unchanged feed returned %v and token %q, want no events and %q", summariesByID(events), sameToken, syncToken)
+	}
+
+	writeFeed(t, path,
+		vevent("UID:a", "DTSTART;VALUE=DATE:20250310", "SUMMARY:HOM"),
+		vevent("UID:b", "DTSTART;VALUE=DATE:20250311", "SUMMARY:V"),
+		vevent("UID:d", "DTSTART;VALUE=DATE:20250313", "SUMMARY:LIB"),
+	)
+	events, _ = list(t, p, syncToken)
+	assertSummaries(t, events, map[string]string{
+		"b": "2025-03-11 V",
+		"c": "<cancelled>",
+		"d": "2025-03-13 LIB",
+	})
+}
+
+func TestListEventsFiltersTimeRange(t *testing.T) {
+	p, path := newFileProvider(t)
+	writeFeed(t, path,
+		vevent("UID:before", "DTSTART;VALUE=DATE:20250301", "SUMMARY:HOM"),
+		vevent("UID:trip", "DTSTART;VALUE=DATE:20250309", "DTEND;VALUE=DATE:20250312", "SUMMARY:V"),
+		vevent("UID:after", "DTSTART;VALUE=DATE:20250401", "SUMMARY:HOM"),
+	)
+
+	page, err := p.ListEvents(context.Background(), calendar.ListOptions{
+		TimeMin: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+		TimeMax: time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("ListEvents() failed: %v", err)
+	}
+	assertSummaries(t, page.Events, map[string]string{
+		"trip_20250310": "2025-03-10 V",
+		"trip_20250311": "2025-03-11 V",
+	})
+
+	// The sync token covers the events outside the range too.
+	writeFeed(t, path,
+		vevent("UID:trip", "DTSTART;VALUE=DATE:20250309", "DTEND;VALUE=DATE:20250312", "SUMMARY:V"),
+		vevent("UID:after", "DTSTART;VALUE=DATE:20250401", "SUMMARY:HOM"),
+	)
+	events, _ := list(t, p, page.NextSyncToken)
+	assertSummaries(t, events, map[string]string{"before": "<cancelled>"})
+}
+
+func TestListEventsRejectsUnknownSyncTokens(t *testing.T) {
+	p, path := newFileProvider(t)
+	writeFeed(t, path)
+
+	_, err := p.ListEvents(context.Background(), calendar.ListOptions{SyncToken: "icsfeed-from-before-a-restart"})
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Code != http.StatusGone {
+		t.Errorf("ListEvents() = %v, want a 410 error", err)
+	}
+}
+
+func TestListEventsFetchesURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feedHeader + vevent("UID:a", "DTSTART;VALUE=DATE:20250310", "SUMMARY:HOM") + feedFooter))
+	}))
+	defer server.Close()
+
+	p, err := NewProvider(config.ICSFeedConfig{Source: server.URL + "/basic.ics"})
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	events, _ := list(t, p, "")
+	assertSummaries(t, events, map[string]string{"a": "2025-03-10 HOM"})
+}
+
+func TestWritesAreRejected(t *testing.T) {
+	p, _ := newFileProvider(t)
+	ctx := context.Background()
+	if _, err := p.InsertEvent(ctx, &gcal.Event{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("InsertEvent() = %v, want ErrReadOnly", err)
+	}
+	if _, err := p.PatchEvent(ctx, "a", &gcal.Event{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("PatchEvent() = %v, want ErrReadOnly", err)
+	}
+	if err := p.DeleteEvent(ctx, "a"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DeleteEvent() = %v, want ErrReadOnly", err)
+	}
+}
@@ -3,28 +3,80 @@ package scheduler
 import (
 	"context"
 	"log"
+	"time"
 	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
 	"gomodules.avm99963.com/zenithplanner/internal/sync"
 
 	"github.com/robfig/cron/v3"
 )
 
-// Scheduler manages background tasks.
+// leaderElectionInterval is how often standby instances try to become the
+// leader, and how often the leader checks that it still is.
+const leaderElectionInterval = 15 * time.Second
+
+// advisoryLocker takes advisory locks. It is implemented by
+// *database.Repository.
+type advisoryLocker interface {
+	TryAdvisoryLock(ctx context.Context, key int64) (*database.AdvisoryLock, error)
+}
+
+// leaderLock is the leader lock, while it is held by this instance. It is
+// implemented by *database.AdvisoryLock.
+type leaderLock interface {
+	// Check returns an error if the lock has been lost.
+	Check(ctx context.Context) error
+	Release(ctx context.Context)
+}
+
+// leaderLocker takes the leader lock. tryLeaderLock returns nil (and no
+// error) if another instance holds it.
+type leaderLocker interface {
+	tryLeaderLock(ctx context.Context) (leaderLock, error)
+}
+
+// advisoryLeaderLocker takes the leader advisory lock.
+type advisoryLeaderLocker struct {
+	locker advisoryLocker
+}
+
+func (l advisoryLeaderLocker) tryLeaderLock(ctx context.Context) (leaderLock, error) {
+	lock, err := l.locker.TryAdvisoryLock(ctx, database.LockKeyLeader)
+	if lock == nil {
+		// Avoid returning a non-nil interface holding a nil pointer.
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Scheduler manages background tasks. When several instances share the
+// database, only the leader (the instance which holds the leader advisory
+// lock) runs them, and a standby takes over if the leader dies.
 type Scheduler struct {
 	cron   *cron.Cron
 	syncer *sync.Syncer
 	cfg    *config.AppConfig
+	locker leaderLocker
+	// How often the leader election runs (leaderElectionInterval, but
+	// shorter in tests).
+	electionInterval time.Duration
+	// Stops the leader election, and is closed once it has stopped.
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // NewScheduler creates and configures a new task scheduler.
-func NewScheduler(syncer *sync.Syncer, appCfg *config.AppConfig) *Scheduler {
+func NewScheduler(syncer *sync.Syncer, appCfg *config.AppConfig, locker advisoryLocker) *Scheduler {
 	cronLogger := cron.PrintfLogger(log.New(log.Writer(), "CRON: ", log.LstdFlags))
-	c := cron.New(cron.WithLogger(cronLogger))
+	// Cron specs are interpreted in the user's timezone.
+	c := cron.New(cron.WithLogger(cronLogger), cron.WithLocation(appCfg.Timezone))
 
 	s := &Scheduler{
-		cron:   c,
-		syncer: syncer,
-		cfg:    appCfg,
+		cron:             c,
+		syncer:           syncer,
+		cfg:              appCfg,
+		locker:           advisoryLeaderLocker{locker: locker},
+		electionInterval: leaderElectionInterval,
 	}
 
 	s.registerTasks()
@@ -60,6 +112,15 @@ func (s *Scheduler) registerTasks() {
 			log.Println("Scheduled channel renewal task (daily at 1 AM).")
 		}
 	}
+
+	if s.cfg.Scheduler.EnableCalendarPolling {
+		_, err := s.cron.AddFunc(s.cfg.Scheduler.CalendarPollCron, s.runCalendarPoll)
+		if err != nil {
+			log.Printf("Error scheduling calendar polling: %v", err)
+		} else {
+			log.Printf("Scheduled calendar polling task (%s).", s.cfg.Scheduler.CalendarPollCron)
+		}
+	}
 }
 
 // runHorizonMaintenance is a wrapper function called by the cron scheduler.
@@ -74,15 +135,13 @@ func (s *Scheduler) runHorizonMaintenance() {
 	}
 }
 
-// runWeeklyFullSync is a wrapper function called by the cron scheduler.
+// runWeeklyFullSync is a wrapper function called by the cron scheduler. It
+// queues a full sync, which is run (and retried if it fails) by the sync
+// worker.
 func (s *Scheduler) runWeeklyFullSync() {
-	log.Println("Scheduler: Running weekly full sync task...")
-	ctx := context.Background()
-	err := s.syncer.RunFullSync(ctx)
-	if err != nil {
-		log.Printf("Error during scheduled weekly full sync: %v", err)
-	} else {
-		log.Println("Scheduler: Weekly full sync task finished.")
+	log.Println("Scheduler: Queueing weekly full sync task...")
+	if err := s.syncer.RequestFullSync(context.Background()); err != nil {
+		log.Printf("Error queueing scheduled weekly full sync: %v", err)
 	}
 }
 
@@ -98,14 +157,87 @@ func (s *Scheduler) runChannelRenewal() {
 	}
 }
 
-// Start begins the cron scheduler in a non-blocking way.
+// runCalendarPoll is a wrapper function called by the cron scheduler. It
+// requests a sync like the webhook does when Google Calendar notifies a
+// change.
+func (s *Scheduler) runCalendarPoll() {
+	if err := s.syncer.RequestSync(context.Background()); err != nil {
+		log.Printf("Error queueing the calendar poll: %v", err)
+	}
+}
+
+// Start begins the leader election in a non-blocking way. The cron
+// scheduler runs while this instance is the leader.
 func (s *Scheduler) Start() {
 	log.Println("Starting background task scheduler...")
-	s.cron.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.runLeaderElection(ctx)
 }
 
-// Stop gracefully stops the cron scheduler, waiting for running jobs to finish.
+// Stop gracefully stops the cron scheduler, waiting for running jobs to
+// finish, and gives up the leadership.
 func (s *Scheduler) Stop() context.Context {
 	log.Println("Stopping background task scheduler (waiting for jobs to complete)...")
+	s.cancel()
+	<-s.done
 	return s.cron.Stop()
 }
+
+// runLeaderElection tries to take the leader lock periodically until ctx
+// is done. While it is held, the cron scheduler runs, and the lock is
+// checked periodically: if its connection is lost (so another instance
+// can take it), the scheduler is stopped until the lock is taken again.
+func (s *Scheduler) runLeaderElection(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.electionInterval)
+	defer ticker.Stop()
+
+	var lock leaderLock
+	for {
+		if lock == nil {
+			lock = s.tryBecomeLeader(ctx)
+		} else if err := lock.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Scheduler: Lost the leadership (%v). Stopping scheduled tasks...", err)
+			<-s.cron.Stop().Done()
+			lock.Release(context.Background())
+			lock = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if lock != nil {
+				<-s.cron.Stop().Done()
+				lock.Release(context.Background())
+				log.Println("Scheduler: Gave up the leadership.")
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryBecomeLeader takes the leader lock if it is free and, if so, starts
+// the cron scheduler and returns the lock.
+func (s *Scheduler) tryBecomeLeader(ctx context.Context) leaderLock {
+	lock, err := s.locker.tryLeaderLock(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Scheduler: Error trying to become the leader: %v", err)
+		}
+		return nil
+	}
+	if lock == nil {
+		return nil
+	}
+
+	log.Println("Scheduler: This instance is the leader. Starting scheduled tasks...")
+	if s.cfg.EnableCalendarSubscription {
+		// The leader owns the webhook channel.
+		if err := s.syncer.EnsureWebhookChannelExists(ctx); err != nil {
+			log.Printf("Scheduler: Error ensuring the webhook channel exists: %v. It will be retried by the channel renewal task.", err)
+		}
+	}
+	s.cron.Start()
+	return lock
+}
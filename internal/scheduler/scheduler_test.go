@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+
+	"github.com/robfig/cron/v3"
+)
+
+// fakeLockServer holds the leader lock shared by several instances, like
+// the database does.
+type fakeLockServer struct {
+	mu     sync.Mutex
+	holder *fakeLock
+}
+
+// fakeLocker is the leaderLocker of an instance.
+type fakeLocker struct {
+	server *fakeLockServer
+}
+
+func (l *fakeLocker) tryLeaderLock(ctx context.Context) (leaderLock, error) {
+	l.server.mu.Lock()
+	defer l.server.mu.Unlock()
+	if l.server.holder != nil {
+		return nil, nil
+	}
+	l.server.holder = &fakeLock{server: l.server}
+	return l.server.holder, nil
+}
+
+type fakeLock struct {
+	server *fakeLockServer
+	// Whether the connection which holds the lock has been lost.
+	lost bool
+}
+
+func (l *fakeLock) Check(ctx context.Context) error {
+	l.server.mu.Lock()
+	defer l.server.mu.Unlock()
+	if l.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (l *fakeLock) Release(ctx context.Context) {
+	l.server.mu.Lock()
+	defer l.server.mu.Unlock()
+	if l.server.holder == l {
+		l.server.holder = nil
+	}
+}
+
+// lose simulates that the connection of the current holder was lost, and
+// that another session took the lock right away. The lock stays taken
+// until release is called.
+func (s *fakeLockServer) lose() (release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holder.lost = true
+	other := &fakeLock{server: s}
+	s.holder = other
+	return func() { other.Release(context.Background()) }
+}
+
+func (s *fakeLockServer) isHeld() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holder != nil
+}
+
+// everySchedule runs a cron job with a fixed delay, shorter than the
+// second supported by cron specs.
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// testInstance is a scheduler with a single task, which counts its runs.
+type testInstance struct {
+	scheduler *Scheduler
+	runs      atomic.Int64
+}
+
+func newTestInstance(server *fakeLockServer) *testInstance {
+	i := &testInstance{}
+	i.scheduler = &Scheduler{
+		cron:             cron.New(),
+		cfg:              &config.AppConfig{Timezone: time.UTC},
+		locker:           &fakeLocker{server: server},
+		electionInterval: 5 * time.Millisecond,
+	}
+	i.scheduler.cron.Schedule(everySchedule(time.Millisecond), cron.FuncJob(func() {
+		i.runs.Add(1)
+	}))
+	return i
+}
+
+// isRunning returns whether the task of the instance runs in the next
+// 100ms.
+func (i *testInstance) isRunning() bool {
+	before := i.runs.Load()
+	time.Sleep(100 * time.Millisecond)
+	return i.runs.Load() > before
+}
+
+// waitFor waits for cond to become true, and fails the test if it doesn't
+// within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting until %s", what)
+}
+
+func TestSchedulerStepsDownWhenTheLeadershipIsLost(t *testing.T) {
+	server := &fakeLockServer{}
+	instance := newTestInstance(server)
+	instance.scheduler.Start()
+	defer instance.scheduler.Stop()
+	waitFor(t, "the instance runs the scheduled tasks", instance.isRunning)
+
+	release := server.lose()
+	waitFor(t, "the instance stops the scheduled tasks", func() bool { return !instance.isRunning() })
+
+	// The cron scheduler is started again once the lock is taken again.
+	release()
+	waitFor(t, "the instance runs the scheduled tasks again", instance.isRunning)
+}
+
+func TestSchedulerStandbyTakesOver(t *testing.T) {
+	server := &fakeLockServer{}
+	leader := newTestInstance(server)
+	leader.scheduler.Start()
+	waitFor(t, "the leader runs the scheduled tasks", leader.isRunning)
+
+	standby := newTestInstance(server)
+	standby.scheduler.Start()
+	defer standby.scheduler.Stop()
+	if standby.isRunning() {
+		t.Errorf("the standby runs the scheduled tasks while the other instance is the leader")
+	}
+
+	<-leader.scheduler.Stop().Done()
+	waitFor(t, "the standby runs the scheduled tasks", standby.isRunning)
+	if leader.isRunning() {
+		t.Errorf("the stopped leader runs the scheduled tasks")
+	}
+
+	// The old leader becomes a standby if it is started again.
+	leader.scheduler.Start()
+	defer leader.scheduler.Stop()
+	if leader.isRunning() {
+		t.Errorf("the restarted instance runs the scheduled tasks while the other instance is the leader")
+	}
+	<-standby.scheduler.Stop().Done()
+	waitFor(t, "the restarted instance runs the scheduled tasks", leader.isRunning)
+	if !server.isHeld() {
+		t.Errorf("the leader lock isn't held while an instance runs the scheduled tasks")
+	}
+}
@@ -0,0 +1,251 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// Maximum number of events listed in the drift report.
+const maxDriftReportLines = 100
+
+// cacheDrift is the difference between the event cache and the calendar,
+// found during a full sync.
+type cacheDrift struct {
+	// Events which were missing from the cache.
+	Inserted []database.CachedEvent
+	// Events whose cached version was outdated.
+	Updated []cachedEventChange
+	// Cached events which no longer exist in the calendar.
+	Deleted []database.CachedEvent
+}
+
+type cachedEventChange struct {
+	Old database.CachedEvent
+	New database.CachedEvent
+}
+
+// cacheDiffer computes the difference between the event cache and the
+// calendar events, which are received in pages. Only the cached events and
+// the differences are kept in memory, and the cache isn't modified until
+// the differences are applied.
+type cacheDiffer struct {
+	s *Syncer
+	// Cached events which haven't been listed yet, by ID.
+	unlisted map[string]database.CachedEvent
+	drift    *cacheDrift
+}
+
+// newCacheDiffer creates a differ for a listing with opts: the cached events
+// outside its time range aren't deleted if they aren't listed.
+func (s *Syncer) newCacheDiffer(ctx context.Context, opts calendar.ListOptions) (*cacheDiffer, error) {
+	var cachedEvents []database.CachedEvent
+	var err error
+	if opts.TimeMin.IsZero() || opts.TimeMax.IsZero() {
+		cachedEvents, err = s.dbRepo.GetAllCachedEvents(ctx)
+	} else {
+		first := dateIn(opts.TimeMin, s.cfg.App.Timezone)
+		last := dateIn(opts.TimeMax.Add(-time.Nanosecond), s.cfg.App.Timezone)
+		cachedEvents, err = s.dbRepo.GetCachedEventsInRange(ctx, first, last)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := &cacheDiffer{
+		s:        s,
+		unlisted: make(map[string]database.CachedEvent, len(cachedEvents)),
+		drift:    &cacheDrift{},
+	}
+	for _, event := range cachedEvents {
+		d.unlisted[event.EventID] = event
+	}
+	return d, nil
+}
+
+// applyPage records the cache rows which differ from a page of events.
+func (d *cacheDiffer) applyPage(ctx context.Context, events []*gcal.Event) error {
+	for _, event := range events {
+		if event.Status == "cancelled" {
+			continue
+		}
+		calendarEvent := d.s.cachedEventFromCalendar(event)
+		if calendarEvent == nil {
+			continue
+		}
+
+		cached, ok := d.unlisted[event.Id]
+		if ok {
+			delete(d.unlisted, event.Id)
+		} else {
+			// The event might be cached with a date outside the range
+			// (e.g. a multi-day event which starts before it).
+			existing, err := d.s.dbRepo.GetCachedEventByID(ctx, event.Id)
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				d.drift.Inserted = append(d.drift.Inserted, *calendarEvent)
+				continue
+			}
+			cached = *existing
+		}
+
+		if len(changedCacheFields(cached, *calendarEvent)) > 0 {
+			d.drift.Updated = append(d.drift.Updated, cachedEventChange{Old: cached, New: *calendarEvent})
+		}
+	}
+	return nil
+}
+
+// finish records the deletion of the cached events which weren't listed,
+// and returns the differences found, sorted by date and event ID.
+func (d *cacheDiffer) finish() *cacheDrift {
+	for _, event := range d.unlisted {
+		d.drift.Deleted = append(d.drift.Deleted, event)
+	}
+
+	sortCachedEvents(d.drift.Inserted)
+	sortCachedEvents(d.drift.Deleted)
+	sort.Slice(d.drift.Updated, func(i, j int) bool {
+		return cachedEventLess(d.drift.Updated[i].New, d.drift.Updated[j].New)
+	})
+	return d.drift
+}
+
+// apply writes the differences to the cache, so it contains the listed
+// events.
+func (d *cacheDrift) apply(ctx context.Context, store Store) error {
+	for _, event := range d.Inserted {
+		if err := store.UpsertCachedEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+	for _, change := range d.Updated {
+		if err := store.UpsertCachedEvent(ctx, change.New); err != nil {
+			return err
+		}
+	}
+	for _, event := range d.Deleted {
+		if err := store.DeleteCachedEvent(ctx, event.EventID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedCacheFields returns the names of the fields which differ between
+// two versions of a cached event.
+func changedCacheFields(old, new database.CachedEvent) []string {
+	var fields []string
+	if !sameTime(old.Date, new.Date) {
+		fields = append(fields, "date")
+	}
+	if !sameString(old.Title, new.Title) {
+		fields = append(fields, "title")
+	}
+	if !sameString(old.Description, new.Description) {
+		fields = append(fields, "description")
+	}
+	if !sameTime(old.UpdatedTs, new.UpdatedTs) {
+		fields = append(fields, "updated")
+	}
+	if old.IsManagedProperty != new.IsManagedProperty || old.IsManagedDescription != new.IsManagedDescription {
+		fields = append(fields, "managed")
+	}
+	if !sameString(old.ColorID, new.ColorID) {
+		fields = append(fields, "color")
+	}
+	if !sameString(old.RecurringEventID, new.RecurringEventID) || !sameTimePtr(old.OriginalStartTime, new.OriginalStartTime) {
+		fields = append(fields, "recurrence")
+	}
+	if !sameString(old.AutoDefaultCode, new.AutoDefaultCode) {
+		fields = append(fields, "default")
+	}
+	return fields
+}
+
+// sameTime compares times with the precision stored in the database.
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+func sameTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return sameTime(*a, *b)
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sortCachedEvents(events []database.CachedEvent) {
+	sort.Slice(events, func(i, j int) bool { return cachedEventLess(events[i], events[j]) })
+}
+
+func cachedEventLess(a, b database.CachedEvent) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.Before(b.Date)
+	}
+	return a.EventID < b.EventID
+}
+
+// isEmpty returns whether the cache was in sync with the calendar.
+func (d *cacheDrift) isEmpty() bool {
+	return len(d.Inserted) == 0 && len(d.Updated) == 0 && len(d.Deleted) == 0
+}
+
+// report returns a human-readable description of the drift, with a line
+// per event: "+" for missing events, "~" for outdated ones and "-" for
+// deleted ones.
+func (d *cacheDrift) report() string {
+	var lines []string
+	for _, event := range d.Inserted {
+		lines = append(lines, fmt.Sprintf("  + %s %s %s", dateKey(event.Date), event.EventID, titleOrNone(event.Title)))
+	}
+	for _, change := range d.Updated {
+		lines = append(lines, fmt.Sprintf("  ~ %s %s %s -> %s (changed: %s)", dateKey(change.New.Date), change.New.EventID, titleOrNone(change.Old.Title), titleOrNone(change.New.Title), strings.Join(changedCacheFields(change.Old, change.New), ", ")))
+	}
+	for _, event := range d.Deleted {
+		lines = append(lines, fmt.Sprintf("  - %s %s %s", dateKey(event.Date), event.EventID, titleOrNone(event.Title)))
+	}
+	if len(lines) > maxDriftReportLines {
+		omitted := len(lines) - maxDriftReportLines
+		lines = append(lines[:maxDriftReportLines], fmt.Sprintf("  ... and %d more", omitted))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// log logs the drift report, if the cache was out of sync.
+func (d *cacheDrift) log() {
+	if d.isEmpty() {
+		log.Println("Event cache was in sync with the calendar.")
+		return
+	}
+	log.Printf("Drift report: the event cache was out of sync with the calendar (%d missing, %d outdated and %d deleted events were fixed):\n%s",
+		len(d.Inserted), len(d.Updated), len(d.Deleted), d.report())
+}
+
+func titleOrNone(title *string) string {
+	if title == nil {
+		return "(no title)"
+	}
+	return *title
+}
+
+func dateKey(date time.Time) string {
+	return date.Format("2006-01-02")
+}
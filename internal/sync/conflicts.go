@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// conflictPolicy decides which event holds the location of a date when
+// there are several schedule events on it.
+type conflictPolicy interface {
+	// preference returns how much the policy prefers an event. The event
+	// with the highest preference wins, and ties are won by the most
+	// recently updated event.
+	preference(event database.CachedEvent) int
+	// reason explains why winner was preferred over loser, when its
+	// preference is higher.
+	reason(winner, loser database.CachedEvent) string
+}
+
+// latestWins prefers all events equally, so the most recently updated one
+// wins.
+type latestWins struct{}
+
+func (latestWins) preference(event database.CachedEvent) int {
+	return 0
+}
+
+func (latestWins) reason(winner, loser database.CachedEvent) string {
+	return reasonLatest
+}
+
+// userOverDefault prefers the events created (or modified) by the user
+// over the unmodified events created automatically with the default
+// location.
+type userOverDefault struct{}
+
+func (userOverDefault) preference(event database.CachedEvent) int {
+	if isUnmodifiedAutoDefault(&event) {
+		return 0
+	}
+	return 1
+}
+
+func (userOverDefault) reason(winner, loser database.CachedEvent) string {
+	return "it was created by you, while the others were automatic defaults"
+}
+
+// statusPriority prefers the events whose status comes first in a list
+// (e.g. Vacation beats everything). Split days get the priority of their
+// best half.
+type statusPriority struct {
+	catalog  *calendar.Catalog
+	statuses []string
+}
+
+func (p statusPriority) preference(event database.CachedEvent) int {
+	best := 0
+	for _, segment := range p.catalog.ParseDayLocation(p.catalog.CanonicalTitle(derefString(event.Title))).Segments() {
+		if i := slices.Index(p.statuses, string(segment.Status)); i >= 0 {
+			best = max(best, len(p.statuses)-i)
+		}
+	}
+	return best
+}
+
+func (p statusPriority) reason(winner, loser database.CachedEvent) string {
+	return fmt.Sprintf("its status (%s) has a higher priority than %s", p.status(winner), p.status(loser))
+}
+
+func (p statusPriority) status(event database.CachedEvent) calendar.LocationStatus {
+	return p.catalog.DayStatus(p.catalog.ParseDayLocation(p.catalog.CanonicalTitle(derefString(event.Title))))
+}
+
+// reasonLatest is the reason given when the most recently updated event
+// wins.
+const reasonLatest = "it was the most recently updated one"
+
+// newConflictPolicy returns the policy configured in cfg, and whether the
+// events which lose should be kept in the calendar.
+func newConflictPolicy(cfg config.ConflictResolutionConfig, catalog *calendar.Catalog) (policy conflictPolicy, keepLosers bool) {
+	switch cfg.Policy {
+	case config.ConflictPolicyUserOverDefault:
+		return userOverDefault{}, false
+	case config.ConflictPolicyStatusPriority:
+		for _, status := range cfg.StatusPriority {
+			if catalog.LocationType(calendar.LocationStatus(status)) == nil {
+				log.Printf("Warning: the status %q of CONFLICT_STATUS_PRIORITY isn't defined in the location catalog.", status)
+			}
+		}
+		return statusPriority{catalog: catalog, statuses: cfg.StatusPriority}, false
+	case config.ConflictPolicyKeepAll:
+		return latestWins{}, true
+	default:
+		return latestWins{}, false
+	}
+}
+
+// conflictResolution is the outcome of resolving the conflicts between the
+// schedule events of a date.
+type conflictResolution struct {
+	// Event which holds the location of the date, or nil if there are no
+	// schedule events.
+	winner *database.CachedEvent
+	// The other schedule events, most preferred first.
+	losers []database.CachedEvent
+	// Why the winner was chosen over the first loser.
+	reason string
+}
+
+// resolveConflicts chooses the authoritative event among the cached events
+// for which isScheduleEvent is true, according to policy.
+func resolveConflicts(cachedEvents []database.CachedEvent, isScheduleEvent func(database.CachedEvent) bool, policy conflictPolicy) conflictResolution {
+	candidates := make([]database.CachedEvent, 0, len(cachedEvents))
+	for _, event := range cachedEvents {
+		if isScheduleEvent(event) {
+			candidates = append(candidates, event)
+		}
+	}
+	if len(candidates) == 0 {
+		return conflictResolution{}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := policy.preference(candidates[i]), policy.preference(candidates[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return candidates[j].UpdatedTs.Before(candidates[i].UpdatedTs)
+	})
+
+	resolution := conflictResolution{winner: &candidates[0], losers: candidates[1:]}
+	if len(resolution.losers) > 0 {
+		resolution.reason = reasonLatest
+		if policy.preference(candidates[0]) > policy.preference(candidates[1]) {
+			resolution.reason = policy.reason(candidates[0], candidates[1])
+		}
+	}
+	return resolution
+}
+
+// conflictEventIDs returns the sorted IDs of the events of a conflict,
+// separated by commas.
+func conflictEventIDs(resolution conflictResolution) string {
+	ids := []string{resolution.winner.EventID}
+	for _, loser := range resolution.losers {
+		ids = append(ids, loser.EventID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// conflictNote explains the resolution of a conflict in the confirmation
+// email.
+func conflictNote(dateStr string, resolution conflictResolution, keepLosers bool) string {
+	titles := make([]string, len(resolution.losers))
+	for i, loser := range resolution.losers {
+		titles[i] = "“" + derefString(loser.Title) + "”"
+	}
+	winner := derefString(resolution.winner.Title)
+	verb := "has"
+	if len(titles) > 1 {
+		verb = "have"
+	}
+	if keepLosers {
+		return fmt.Sprintf("%s: there are several events for this day. “%s” is used because %s, and %s %s been left as is. Please delete the events you don't want.",
+			dateStr, winner, resolution.reason, strings.Join(titles, ", "), verb)
+	}
+	return fmt.Sprintf("%s: there were several events for this day. “%s” was kept because %s, and %s %s been deleted.",
+		dateStr, winner, resolution.reason, strings.Join(titles, ", "), verb)
+}
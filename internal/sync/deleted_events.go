@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	"github.com/google/uuid"
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// deleteEvent records a snapshot of an event in deleted_events and deletes
+// it from the calendar. The event isn't deleted if the snapshot can't be
+// recorded.
+func (s *Syncer) deleteEvent(ctx context.Context, eventID string, date time.Time, reason string) error {
+	if err := s.snapshotEvent(ctx, eventID, date, reason, syncRunID(ctx)); err != nil {
+		return err
+	}
+	return s.calendarService.DeleteEvent(ctx, eventID)
+}
+
+// snapshotEvent fetches the current version of an event and records it in
+// deleted_events, so it can be restored after deleting it. Events which no
+// longer exist are skipped.
+func (s *Syncer) snapshotEvent(ctx context.Context, eventID string, date time.Time, reason, runID string) error {
+	event, err := s.calendarService.GetEvent(ctx, eventID)
+	if isNotFoundError(err) || (err == nil && event.Status == "cancelled") {
+		log.Printf("Event %s was already deleted, so there's no snapshot to record.", eventID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch event %s to record its snapshot: %w", eventID, err)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot of event %s: %w", eventID, err)
+	}
+	if runID == "" {
+		runID = uuid.New().String()
+	}
+	return s.dbRepo.InsertDeletedEvent(ctx, database.DeletedEvent{
+		EventID:   eventID,
+		Date:      date,
+		Event:     data,
+		Reason:    reason,
+		SyncRunID: runID,
+	})
+}
+
+// RestoreDeletedEvent creates the event of a snapshot recorded in
+// deleted_events again, and reconciles its date. The event is created with
+// a new ID, since Google Calendar doesn't allow reusing the IDs of deleted
+// events. It returns the created event.
+func (s *Syncer) RestoreDeletedEvent(ctx context.Context, id int64) (*gcal.Event, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	ctx = withSyncRun(ctx, database.TriggerRestore)
+
+	if s.readOnly {
+		return nil, fmt.Errorf("events can't be restored in a read-only calendar")
+	}
+	deleted, err := s.dbRepo.GetDeletedEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		return nil, fmt.Errorf("there isn't a deleted event with ID %d", id)
+	}
+	if deleted.RestoredAt != nil {
+		return nil, fmt.Errorf("deleted event %d was already restored as event %s", id, derefString(deleted.RestoredEventID))
+	}
+
+	event, err := restorableEvent(deleted.Event)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot of deleted event %d: %w", id, err)
+	}
+	event.Id = newEventID()
+	created, err := s.calendarService.InsertEvent(ctx, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore event %s: %w", deleted.EventID, err)
+	}
+	log.Printf("Restored event %s (deleted because of: %s) as event %s.", deleted.EventID, deleted.Reason, created.Id)
+	if err := s.dbRepo.MarkDeletedEventRestored(ctx, id, created.Id); err != nil {
+		return created, err
+	}
+
+	// The restored event is cached right away, so reconciliation takes it
+	// into account without waiting for the next sync.
+	if err := s.updateDBCache(ctx, []*gcal.Event{created}); err != nil {
+		return created, fmt.Errorf("failed to cache the restored event: %w", err)
+	}
+	dateStr := deleted.Date.Format("2006-01-02")
+	note := fmt.Sprintf("%s: the deleted event “%s” has been restored.", dateStr, created.Summary)
+	if err := s.RunReconciliation(ctx, []time.Time{deleted.Date}, false, []string{note}); err != nil {
+		return created, fmt.Errorf("failed to reconcile %s after restoring the event: %w", dateStr, err)
+	}
+	return created, nil
+}
+
+// restorableEvent returns the event to insert in order to restore a
+// snapshot. Only the fields set by the user are kept: the ones assigned by
+// the calendar (e.g. the ID or the creation time) are dropped, and
+// recurring event instances become standalone events.
+func restorableEvent(snapshot []byte) (*gcal.Event, error) {
+	var event gcal.Event
+	if err := json.Unmarshal(snapshot, &event); err != nil {
+		return nil, err
+	}
+	restored := &gcal.Event{
+		Summary:            event.Summary,
+		Description:        event.Description,
+		Location:           event.Location,
+		Start:              event.Start,
+		End:                event.End,
+		ColorId:            event.ColorId,
+		ExtendedProperties: event.ExtendedProperties,
+		Transparency:       event.Transparency,
+		Visibility:         event.Visibility,
+		Reminders:          event.Reminders,
+	}
+	if event.RecurringEventId == "" {
+		restored.Recurrence = event.Recurrence
+	}
+	if restored.Start == nil || restored.End == nil {
+		return nil, fmt.Errorf("the event doesn't have a start and an end")
+	}
+	return restored, nil
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// freezeCutoff returns the first date which isn't frozen by the configured
+// rule, or the zero time if no dates are frozen.
+func (s *Syncer) freezeCutoff() time.Time {
+	today := s.today()
+	switch s.cfg.App.Freeze.Rule {
+	case config.FreezeRuleDays:
+		return today.AddDate(0, 0, -s.cfg.App.Freeze.Days)
+	case config.FreezeRulePreviousMonth:
+		return time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, today.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// isFrozen returns whether changes to the location of a date should be
+// undone. Corrections made by an admin (restores, reverts and corrections
+// with the admin CLI) override the freeze.
+func (s *Syncer) isFrozen(ctx context.Context, date time.Time) bool {
+	switch syncTrigger(ctx) {
+	case database.TriggerRestore, database.TriggerRevert, database.TriggerCorrection:
+		return false
+	}
+	cutoff := s.freezeCutoff()
+	return !cutoff.IsZero() && date.Before(cutoff)
+}
+
+// frozenNote explains in the confirmation email why the change of a frozen
+// date has been undone, and how.
+func (s *Syncer) frozenNote(dateStr, change, undo string) string {
+	return fmt.Sprintf("%s: %s, but dates before %s are frozen, so %s. Ask an admin to correct the date if the change is needed.",
+		dateStr, change, s.freezeCutoff().Format("2006-01-02"), undo)
+}
+
+// CorrectSchedule sets the dates from first to last (inclusive) to the
+// given location, even if they are frozen. The location is written to the
+// event of each date (which is created if there isn't one), and the dates
+// are reconciled. Dates which already have that location are left as they
+// are. It returns a description of each corrected date.
+func (s *Syncer) CorrectSchedule(ctx context.Context, first, last time.Time, locationCode string) ([]string, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	ctx = withSyncRun(ctx, database.TriggerCorrection)
+
+	if s.readOnly {
+		return nil, fmt.Errorf("dates can't be corrected in a read-only calendar")
+	}
+	if !s.catalog.ParseDayLocation(locationCode).IsKnown() {
+		return nil, fmt.Errorf("%q isn't a valid location", locationCode)
+	}
+
+	var corrected []time.Time
+	var notes []string
+	for _, date := range generateDateRange(first, last) {
+		dateStr := date.Format("2006-01-02")
+		current, err := s.dbRepo.GetScheduleEntry(ctx, date)
+		if err != nil {
+			return notes, err
+		}
+		if current != nil && current.LocationCode == locationCode {
+			continue
+		}
+
+		log.Printf("Correcting %s to %s.", dateStr, locationCode)
+		if err := s.setDayLocation(ctx, date, locationCode); err != nil {
+			return notes, fmt.Errorf("failed to correct %s: %w", dateStr, err)
+		}
+		previous := "<none>"
+		if current != nil {
+			previous = current.LocationCode
+		}
+		notes = append(notes, fmt.Sprintf("%s: corrected from %s to %s by an admin.", dateStr, previous, locationCode))
+		corrected = append(corrected, date)
+	}
+
+	if len(corrected) > 0 {
+		if err := s.RunReconciliation(ctx, corrected, false, notes); err != nil {
+			return notes, fmt.Errorf("failed to reconcile the corrected dates: %w", err)
+		}
+	}
+	return notes, nil
+}
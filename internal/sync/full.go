@@ -6,112 +6,189 @@ import (
 	"log"
 	"time"
 
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
 	gcal "google.golang.org/api/calendar/v3"
-	"google.golang.org/api/googleapi"
 )
 
-// RunFullSync performs a full synchronization: fetches all events, rebuilds cache,
-// stores new sync token, and triggers reconciliation.
+// RunFullSync performs a full synchronization: fetches the events of the
+// full sync window (or all of them in archive mode), brings the cache in
+// line with them and stores the new sync token (atomically), and triggers
+// reconciliation.
 func (s *Syncer) RunFullSync(ctx context.Context) error {
-	log.Println("Starting full sync...")
-
-	log.Println("Fetching all events from Google Calendar...")
-	allEvents, nextSyncToken, err := s.fetchAllEvents(ctx)
+	log.Println("Full sync: Waiting for lock...")
+	unlock, err := s.lock(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to fetch all calendar events: %w", err)
+		return err
 	}
-	log.Printf("Fetched %d total events/instances from calendar.", len(allEvents))
+	defer unlock()
+	return s.fullSync(ctx)
+}
+
+// fullSync performs a full synchronization in the configured mode. The
+// lock must be held.
+func (s *Syncer) fullSync(ctx context.Context) error {
+	return s.runFullSync(ctx, s.cfg.App.FullSync.Mode == config.FullSyncModeArchive)
+}
 
-	log.Println("Rebuilding local event cache...")
-	err = s.rebuildEventCache(ctx, allEvents)
+// RunArchiveSync performs a full synchronization which fetches the whole
+// history of the calendar, regardless of the configured mode.
+func (s *Syncer) RunArchiveSync(ctx context.Context) error {
+	log.Println("Archive sync: Waiting for lock...")
+	unlock, err := s.lock(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to rebuild event cache: %w", err)
+		return err
 	}
-	log.Println("Event cache rebuilt successfully.")
+	defer unlock()
+	return s.runFullSync(ctx, true)
+}
+
+func (s *Syncer) runFullSync(ctx context.Context, archive bool) error {
+	log.Println("Starting full sync...")
+	ctx = withSyncRun(ctx, database.TriggerFullSync)
 
-	if nextSyncToken == "" {
-		log.Println("Warning: No sync token received from full sync fetch.")
+	var opts calendar.ListOptions
+	if archive {
+		log.Println("Fetching the whole history of the calendar (archive mode)...")
+	} else {
+		opts.TimeMin, opts.TimeMax = s.fullSyncTimeRange()
+		log.Printf("Fetching the events from %s to %s...", opts.TimeMin.Format(time.RFC3339), opts.TimeMax.Format(time.RFC3339))
 	}
-	log.Println("Persisting new sync token...")
-	err = s.dbRepo.SetSyncState(ctx, "syncToken", nextSyncToken)
+
+	var notes []string
+	datesMap := make(map[string]struct{})
+	for _, d := range s.syncWindowDates() {
+		datesMap[d.Format("2006-01-02")] = struct{}{}
+	}
+	drift, err := s.syncEventCache(ctx, opts, func(ctx context.Context, events []*gcal.Event, pageNotes []string) {
+		notes = append(notes, pageNotes...)
+		for _, d := range s.getDatesToConciliate(ctx, events) {
+			datesMap[d.Format("2006-01-02")] = struct{}{}
+		}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to persist sync token: %w", err)
+		return fmt.Errorf("failed to update event cache: %w", err)
 	}
-	log.Println("Sync token persisted.")
+	drift.log()
 
 	log.Println("Triggering reconciliation process for full sync window and ...")
-	datesToReconcile := s.getDatesToConciliateWithDefaultWindow(ctx, allEvents)
+	datesToReconcile := dateStrMapToTimeSlice(datesMap)
 
-	err = s.RunReconciliation(ctx, datesToReconcile, false) // Pass false for userTriggeredChange
+	err = s.RunReconciliation(ctx, datesToReconcile, false, notes) // Pass false for userTriggeredChange
 	if err != nil {
-		// Log reconciliation error but don't necessarily fail the whole sync?
-		log.Printf("Error during post-full-sync reconciliation: %v", err)
-	} else {
-		log.Println("Reconciliation process completed.")
+		return fmt.Errorf("error during post-full-sync reconciliation: %w", err)
 	}
+	log.Println("Reconciliation process completed.")
 
 	log.Println("Full sync completed successfully.")
 	return nil
 }
 
-// fetchAllEvents retrieves all events from the configured calendar.
-func (s *Syncer) fetchAllEvents(ctx context.Context) ([]*gcal.Event, string, error) {
-	var allEvents []*gcal.Event
-	var pageToken string
-	var nextSyncToken string
+// fullSyncTimeRange returns the time range fetched by full syncs in window
+// mode: the reconciliation window, extended by the configured margin on
+// both sides.
+func (s *Syncer) fullSyncTimeRange() (time.Time, time.Time) {
+	today := s.today()
+	margin := s.cfg.App.FullSync.WindowMarginDays
+	first := today.AddDate(0, 0, -s.cfg.App.PastSyncWindowDays-margin)
+	last := today.AddDate(0, 0, s.cfg.App.FutureHorizonDays+margin)
+	tz := s.cfg.App.Timezone
+	return time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, tz),
+		time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, tz)
+}
 
-	for {
-		call := s.calendarService.Events.List(s.cfg.Google.CalendarID).
-			PageToken(pageToken).
-			SingleEvents(true).
-			Fields(googleapi.Field("items(id,summary,description,start,end,updated,colorId,recurringEventId,originalStartTime,extendedProperties,status),nextPageToken,nextSyncToken"))
+// syncEventCache lists the events with opts and updates the cache so it
+// contains exactly them (only touching the cached events in the time range
+// of opts), and stores the new sync token. Pages are processed as they
+// arrive: multi-day events are expanded, and handlePage (if set) is called
+// with the result and the notes for the email (and once more at the end
+// with the events which replace the materialized recurring events). The
+// differences with the cache are computed while the pages are received,
+// and only the rows which differ are written once all of them have been
+// processed, in a single transaction, so the cache is never seen empty or
+// half-filled. The calendar is only modified outside of the transaction,
+// by the expansions and materializations, which can be retried without
+// creating duplicates if the sync fails afterwards. It returns the
+// differences found.
+func (s *Syncer) syncEventCache(ctx context.Context, opts calendar.ListOptions, handlePage func(ctx context.Context, events []*gcal.Event, notes []string)) (*cacheDrift, error) {
+	differ, err := s.newCacheDiffer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		resp, err := call.Do()
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to list calendar events (page token: %s): %w", pageToken, err)
+	numEvents := 0
+	var seriesIDs []string
+	var seriesTitles map[string]string
+	seriesInstances := make(map[string][]*gcal.Event)
+	syncToken, err := s.forEachEventPage(ctx, opts, func(events []*gcal.Event) error {
+		numEvents += len(events)
+		events, notes := s.expandMultiDayEvents(ctx, events)
+		if !s.readOnly {
+			seriesIDs, seriesTitles = s.materializableSeries(events, seriesIDs, seriesTitles)
+			s.collectMaterializableInstances(events, seriesInstances)
 		}
-
-		allEvents = append(allEvents, resp.Items...)
-		nextSyncToken = resp.NextSyncToken
-
-		if resp.NextPageToken == "" {
-			break
+		if handlePage != nil {
+			handlePage(ctx, events, notes)
+		}
+		return differ.applyPage(ctx, events)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch calendar events: %w", err)
+	}
+	log.Printf("Fetched %d total events/instances from calendar.", numEvents)
+
+	// The instances of recurring events can be spread over several pages,
+	// so they are materialized once all of them have been received.
+	var materialized []*gcal.Event
+	if len(seriesIDs) > 0 {
+		var notes []string
+		materialized, notes = s.materializeListedSeries(ctx, seriesIDs, seriesTitles, seriesInstances)
+		if handlePage != nil {
+			handlePage(ctx, materialized, notes)
 		}
-		pageToken = resp.NextPageToken
-		log.Printf("Fetched page, continuing pagination...")
 	}
 
-	return allEvents, nextSyncToken, nil
-}
+	drift := differ.finish()
+	err = s.dbRepo.InTransaction(ctx, func(ctx context.Context) error {
+		if err := drift.apply(ctx, s.dbRepo); err != nil {
+			return err
+		}
+		if err := s.updateDBCache(ctx, materialized); err != nil {
+			return fmt.Errorf("failed to cache materialized recurring events: %w", err)
+		}
 
-// rebuildEventCache clears the existing cache and populates it with the fetched events.
-func (s *Syncer) rebuildEventCache(ctx context.Context, events []*gcal.Event) error {
-	log.Println("Clearing existing calendar event cache...")
-	if err := s.dbRepo.ClearCachedEvents(ctx); err != nil {
-		return fmt.Errorf("failed to clear cache before rebuild: %w", err)
+		if syncToken == "" {
+			log.Println("Warning: No sync token received from full sync fetch.")
+		}
+		if err := s.dbRepo.SetSyncState(ctx, "syncToken", syncToken); err != nil {
+			return fmt.Errorf("failed to persist sync token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	log.Println("Cache cleared.")
-
-	s.updateDBCache(ctx, events)
-	return nil
+	return drift, nil
 }
 
-func (s *Syncer) getDatesToConciliateWithDefaultWindow(ctx context.Context, allEvents []*gcal.Event) []time.Time {
-	datesMap := make(map[string]struct{})
-
-	windowStartDate := time.Now().AddDate(0, 0, -s.cfg.App.PastSyncWindowDays)
-	windowEndDate := time.Now().AddDate(0, 0, s.cfg.App.FutureHorizonDays)
-	windowDates := generateDateRange(windowStartDate, windowEndDate)
-	for _, d := range windowDates {
-		dateStr := d.Format("2006-01-02")
-		datesMap[dateStr] = struct{}{}
-	}
+// forEachEventPage lists the events with opts, calling fn with each page
+// as it is received, and returns the sync token of the last page.
+func (s *Syncer) forEachEventPage(ctx context.Context, opts calendar.ListOptions, fn func(events []*gcal.Event) error) (string, error) {
+	for {
+		resp, err := s.calendarService.ListEvents(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		if err := fn(resp.Events); err != nil {
+			return "", err
+		}
 
-	datesToConciliate := s.getDatesToConciliate(ctx, allEvents)
-	for _, d := range datesToConciliate {
-		dateStr := d.Format("2006-01-02")
-		datesMap[dateStr] = struct{}{}
+		if resp.NextPageToken == "" {
+			return resp.NextSyncToken, nil
+		}
+		opts.PageToken = resp.NextPageToken
+		log.Printf("Fetched page, continuing pagination...")
 	}
-
-	return dateStrMapToTimeSlice(datesMap)
 }
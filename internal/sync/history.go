@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// writeScheduleEntry upserts the schedule entry of a date and appends the
+// change (from previous, which is nil if the date didn't have an entry) to
+// the schedule history, together with the event which holds the location
+// and the sync run of ctx.
+func (s *Syncer) writeScheduleEntry(ctx context.Context, previous *database.ScheduleEntry, entry database.ScheduleEntry, eventID string) error {
+	if err := s.dbRepo.UpsertScheduleEntry(ctx, entry); err != nil {
+		return err
+	}
+	change := database.ScheduleEntryChange{
+		Date:            entry.Date,
+		NewLocationCode: entry.LocationCode,
+		NewStatus:       entry.Status,
+		Trigger:         syncTrigger(ctx),
+		SyncRunID:       syncRunID(ctx),
+	}
+	if previous != nil {
+		change.OldLocationCode = &previous.LocationCode
+		change.OldStatus = &previous.Status
+	}
+	if eventID != "" {
+		change.EventID = &eventID
+	}
+	return s.dbRepo.InsertScheduleEntryChange(ctx, change)
+}
+
+// RevertSchedule sets the dates from first to last (inclusive) back to the
+// location they had at the given time according to the schedule history.
+// The location is written to the event of each date (which is created if
+// there isn't one), and the dates are reconciled. Dates without history
+// before that time, or which already have that location, are left as
+// they are. It returns a description of each reverted date.
+func (s *Syncer) RevertSchedule(ctx context.Context, first, last, at time.Time) ([]string, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	ctx = withSyncRun(ctx, database.TriggerRevert)
+
+	if s.readOnly {
+		return nil, fmt.Errorf("dates can't be reverted in a read-only calendar")
+	}
+	history, err := s.dbRepo.GetScheduleEntryHistory(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	changesByDate := make(map[string][]database.ScheduleEntryChange)
+	for _, change := range history {
+		key := change.Date.Format("2006-01-02")
+		changesByDate[key] = append(changesByDate[key], change)
+	}
+
+	var reverted []time.Time
+	var notes []string
+	for _, date := range generateDateRange(first, last) {
+		dateStr := date.Format("2006-01-02")
+		target, ok := locationAt(changesByDate[dateStr], at)
+		if !ok || target == "" {
+			log.Printf("Revert: %s didn't have a location at %s. Skipping it.", dateStr, at.Format(time.RFC3339))
+			continue
+		}
+		current, err := s.dbRepo.GetScheduleEntry(ctx, date)
+		if err != nil {
+			return notes, err
+		}
+		if current != nil && current.LocationCode == target {
+			continue
+		}
+
+		if err := s.setDayLocation(ctx, date, target); err != nil {
+			return notes, fmt.Errorf("failed to revert %s: %w", dateStr, err)
+		}
+		previous := "<none>"
+		if current != nil {
+			previous = current.LocationCode
+		}
+		notes = append(notes, fmt.Sprintf("%s: reverted from %s to %s, the location it had on %s.", dateStr, previous, target, at.In(s.cfg.App.Timezone).Format("2006-01-02 15:04")))
+		reverted = append(reverted, date)
+	}
+
+	if len(reverted) > 0 {
+		if err := s.RunReconciliation(ctx, reverted, false, notes); err != nil {
+			return notes, fmt.Errorf("failed to reconcile the reverted dates: %w", err)
+		}
+	}
+	return notes, nil
+}
+
+// locationAt returns the location code a date had at the given time,
+// according to its changes (in the order they were made), and whether it
+// is known.
+func locationAt(changes []database.ScheduleEntryChange, at time.Time) (string, bool) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		if !changes[i].ChangedAt.After(at) {
+			return changes[i].NewLocationCode, true
+		}
+	}
+	if len(changes) > 0 && changes[0].OldLocationCode != nil {
+		return *changes[0].OldLocationCode, true
+	}
+	return "", false
+}
+
+// setDayLocation writes a location to the calendar: it changes the title
+// of the event which holds the location of the date, or creates a managed
+// event if there isn't one. The event is cached right away, so it is taken
+// into account by the next reconciliation.
+func (s *Syncer) setDayLocation(ctx context.Context, date time.Time, locationCode string) error {
+	cachedEvents, err := s.dbRepo.GetCachedEventsByDate(ctx, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetch cached events: %w", err)
+	}
+
+	var event *gcal.Event
+	if winner := resolveConflicts(cachedEvents, s.isScheduleEvent, s.conflictPolicy).winner; winner != nil {
+		log.Printf("Setting the title of event %s to %s.", winner.EventID, locationCode)
+		event, err = s.calendarService.PatchEvent(ctx, winner.EventID, &gcal.Event{Summary: locationCode})
+	} else {
+		log.Printf("Creating an event for %s with %s.", date.Format("2006-01-02"), locationCode)
+		event, err = s.calendarService.InsertEvent(ctx, &gcal.Event{
+			Id:      newEventID(),
+			Summary: locationCode,
+			Start:   &gcal.EventDateTime{Date: date.Format("2006-01-02")},
+			End:     &gcal.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+			ColorId: s.catalog.DayColorID(s.catalog.ParseDayLocation(locationCode)),
+			ExtendedProperties: &gcal.EventExtendedProperties{
+				Private: map[string]string{calendar.ManagedPropertyKey: "true"},
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return s.updateDBCache(ctx, []*gcal.Event{event})
+}
@@ -6,16 +6,19 @@ import (
 	"log"
 	"time"
 
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
 	gcal "google.golang.org/api/calendar/v3"
-	"google.golang.org/api/googleapi"
 )
 
 // RunIncrementalSync processes changes fetched using a sync token. Returns an error and whether full sync should be attempted.
 func (s *Syncer) RunIncrementalSync(ctx context.Context, syncToken string) (error, bool) {
+	ctx = withSyncRun(ctx, database.TriggerIncrementalSync)
 	log.Printf("Fetching changes using sync token: %s...", syncToken[:min(10, len(syncToken))])
 	changedEvents, nextSyncToken, err := s.fetchIncrementalChanges(ctx, syncToken)
 	if err != nil {
-		err = fmt.Errorf("Failed to fetch incremental changes: %w. syncToken has been cleared.")
+		err = fmt.Errorf("Failed to fetch incremental changes: %w. syncToken has been cleared.", err)
 		// Clear the invalid token so an incremental sync isn't attempted again
 		_ = s.dbRepo.SetSyncState(ctx, "syncToken", "")
 		return err, true
@@ -33,13 +36,23 @@ func (s *Syncer) RunIncrementalSync(ctx context.Context, syncToken string) (erro
 		return nil, false
 	}
 
+	changedEvents, notes := s.expandMultiDayEvents(ctx, changedEvents)
+	changedEvents, recurringNotes := s.materializeRecurringEvents(ctx, changedEvents)
+	notes = append(notes, recurringNotes...)
+
+	// The dates must be determined before updating the cache, since the
+	// date of deleted events is only available there.
+	affectedDates := s.getDatesToConciliate(ctx, changedEvents)
 	err = s.updateDBCache(ctx, changedEvents)
 	if err != nil {
 		err = fmt.Errorf("failed to update cache: %w", err)
 		return err, true
 	}
-	affectedDates := s.getDatesToConciliate(ctx, changedEvents)
-	s.reconciliate(ctx, affectedDates)
+	if err := s.reconciliate(ctx, affectedDates, notes); err != nil {
+		// The sync token isn't advanced, so the changes are received
+		// and reconciled again when the sync is retried.
+		return err, false
+	}
 
 	if nextSyncToken != "" {
 		log.Println("Persisting new sync token after incremental sync.")
@@ -63,18 +76,12 @@ func (s *Syncer) fetchIncrementalChanges(ctx context.Context, syncToken string)
 	var nextSyncToken = syncToken
 
 	for {
-		call := s.calendarService.Events.List(s.cfg.Google.CalendarID).
-			PageToken(pageToken).
-			SingleEvents(true). // Important for recurrence handling
-			SyncToken(syncToken).
-			Fields(googleapi.Field("items(id,summary,description,start,end,updated,colorId,recurringEventId,originalStartTime,extendedProperties,status),nextPageToken,nextSyncToken"))
-
-		resp, err := call.Do()
+		resp, err := s.calendarService.ListEvents(ctx, calendar.ListOptions{PageToken: pageToken, SyncToken: syncToken})
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to list changed calendar events (page token: %s): %w", pageToken, err)
+			return nil, "", err
 		}
 
-		changedEvents = append(changedEvents, resp.Items...)
+		changedEvents = append(changedEvents, resp.Events...)
 
 		if resp.NextPageToken == "" {
 			nextSyncToken = resp.NextSyncToken
@@ -87,14 +94,15 @@ func (s *Syncer) fetchIncrementalChanges(ctx context.Context, syncToken string)
 	return changedEvents, nextSyncToken, nil
 }
 
-func (s *Syncer) reconciliate(ctx context.Context, dates []time.Time) {
+// reconciliate reconciles the dates affected by an incremental sync.
+func (s *Syncer) reconciliate(ctx context.Context, dates []time.Time, notes []string) error {
 	if len(dates) > 0 {
 		log.Printf("Triggering reconciliation for %d affected dates...", len(dates))
-		err := s.RunReconciliation(ctx, dates, true)
-		if err != nil {
-			log.Printf("Error during post-incremental-sync reconciliation: %v", err)
+		if err := s.RunReconciliation(ctx, dates, true, notes); err != nil {
+			return fmt.Errorf("error during post-incremental-sync reconciliation: %w", err)
 		}
 	} else {
 		log.Println("No valid dates identified for reconciliation.")
 	}
+	return nil
 }
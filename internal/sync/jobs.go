@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+const (
+	// Delay before retrying a failed sync job for the first time. It is
+	// doubled after each failure, up to syncJobMaxRetryDelay.
+	syncJobRetryDelay    = 30 * time.Second
+	syncJobMaxRetryDelay = time.Hour
+	// Number of failed attempts after which a sync job is dead, so it isn't
+	// retried until it is requeued with the admin CLI.
+	syncJobMaxAttempts = 10
+	// Interval at which the sync worker looks for jobs to retry, or queued
+	// by other instances.
+	syncJobWorkerInterval = 30 * time.Second
+)
+
+// RequestSync queues an incremental sync (which falls back to a full sync
+// if needed) and wakes up the sync worker. Requests made while an
+// identical job is waiting to run are merged into it.
+func (s *Syncer) RequestSync(ctx context.Context) error {
+	return s.enqueueSyncJob(ctx, database.SyncJob{Kind: database.SyncJobIncremental})
+}
+
+// RequestFullSync queues a full sync and wakes up the sync worker.
+func (s *Syncer) RequestFullSync(ctx context.Context) error {
+	return s.enqueueSyncJob(ctx, database.SyncJob{Kind: database.SyncJobFull})
+}
+
+func (s *Syncer) enqueueSyncJob(ctx context.Context, job database.SyncJob) error {
+	if err := s.dbRepo.EnqueueSyncJob(ctx, job); err != nil {
+		return err
+	}
+	select {
+	case s.syncQueue <- struct{}{}:
+		log.Printf("%s sync requested and queued.", job.Kind)
+	default:
+		log.Printf("%s sync requested and queued (the sync worker was already woken up).", job.Kind)
+	}
+	return nil
+}
+
+// StartSyncWorker launches a background goroutine which runs the queued
+// sync jobs: right away when they are requested, and periodically to retry
+// the failed ones and run the ones left behind by a previous run of the
+// process or queued by other instances.
+func (s *Syncer) StartSyncWorker(ctx context.Context) {
+	log.Println("Starting sync worker goroutine...")
+	go func() {
+		ticker := time.NewTicker(syncJobWorkerInterval)
+		defer ticker.Stop()
+		for {
+			unlock, err := s.lock(ctx)
+			if err == nil {
+				err = s.processSyncJobs(ctx)
+				unlock()
+			}
+			if err != nil {
+				log.Printf("Error processing the sync jobs: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				log.Println("Sync worker stopping due to context cancellation.")
+				return
+			case <-s.syncQueue:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processSyncJobs runs the sync jobs which are due, one after the other,
+// until there are none left. Failed jobs are rescheduled with an
+// exponential backoff, until they have failed syncJobMaxAttempts times.
+// The lock must be held.
+func (s *Syncer) processSyncJobs(ctx context.Context) error {
+	interrupted, err := s.dbRepo.RequeueInterruptedSyncJobs(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	if interrupted > 0 {
+		log.Printf("Requeued %d sync jobs which were interrupted.", interrupted)
+	}
+
+	for {
+		job, err := s.dbRepo.ClaimDueSyncJob(ctx, s.now())
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return nil
+		}
+
+		log.Printf("Running sync job %d (%s, attempt %d)...", job.ID, describeSyncJob(*job), job.Attempts+1)
+		runErr := s.runSyncJob(ctx, *job)
+		if runErr == nil {
+			if err := s.dbRepo.MarkSyncJobDone(ctx, job.ID); err != nil {
+				return err
+			}
+			log.Printf("Sync job %d finished.", job.ID)
+			continue
+		}
+
+		if job.Attempts+1 >= syncJobMaxAttempts {
+			log.Printf("Sync job %d (%s) failed %d times, the last one with: %v. Giving up; requeue it with the admin CLI once the problem is fixed.", job.ID, describeSyncJob(*job), job.Attempts+1, runErr)
+			if err := s.dbRepo.MarkSyncJobDead(ctx, job.ID, runErr.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		delay := min(syncJobRetryDelay<<min(job.Attempts, 20), syncJobMaxRetryDelay)
+		log.Printf("Error running sync job %d (%s, attempt %d): %v. Retrying in %s.", job.ID, describeSyncJob(*job), job.Attempts+1, runErr, delay)
+		if err := s.dbRepo.MarkSyncJobFailed(ctx, job.ID, runErr.Error(), s.now().Add(delay)); err != nil {
+			return err
+		}
+	}
+}
+
+// runSyncJob runs the sync of a job.
+func (s *Syncer) runSyncJob(ctx context.Context, job database.SyncJob) error {
+	switch job.Kind {
+	case database.SyncJobIncremental:
+		return s.runSync(ctx)
+	case database.SyncJobFull:
+		return s.fullSync(ctx)
+	case database.SyncJobReconcileRange:
+		if job.RangeStart == nil || job.RangeEnd == nil {
+			return fmt.Errorf("the job doesn't have a range of dates")
+		}
+		return s.RunReconciliation(ctx, generateDateRange(*job.RangeStart, *job.RangeEnd), false, nil)
+	default:
+		return fmt.Errorf("unknown sync job kind %q", job.Kind)
+	}
+}
+
+// describeSyncJob returns the kind of a job, with its range of dates if it
+// has one.
+func describeSyncJob(job database.SyncJob) string {
+	if job.RangeStart != nil && job.RangeEnd != nil {
+		return fmt.Sprintf("%s %s → %s", job.Kind, job.RangeStart.Format("2006-01-02"), job.RangeEnd.Format("2006-01-02"))
+	}
+	return job.Kind
+}
@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// advisoryLocker takes the advisory locks which coordinate the instances
+// sharing the database. It is implemented by *database.Repository.
+type advisoryLocker interface {
+	AcquireAdvisoryLock(ctx context.Context, key int64) (*database.AdvisoryLock, error)
+}
+
+// lock takes the mutex which serializes the work of the Syncer and, if the
+// store supports it, the sync advisory lock, so other instances (and the
+// admin CLI) wait until the work is done. It returns the function which
+// releases them.
+func (s *Syncer) lock(ctx context.Context) (func(), error) {
+	s.mutex.Lock()
+	locker, ok := s.dbRepo.(advisoryLocker)
+	if !ok {
+		return s.mutex.Unlock, nil
+	}
+	lock, err := locker.AcquireAdvisoryLock(ctx, database.LockKeySync)
+	if err != nil {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("failed to take the sync lock: %w", err)
+	}
+	return func() {
+		lock.Release(context.Background())
+		s.mutex.Unlock()
+	}, nil
+}
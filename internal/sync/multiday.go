@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// expandMultiDayEvents replaces managed all-day events spanning multiple
+// days (e.g. a vacation week) with one managed single-day event per
+// covered date, and deletes the original event from the calendar.
+//
+// The daily events get IDs derived from the original event (see
+// dailyEventID), so if the expansion fails halfway it can be retried
+// without duplicating the days created before the failure: the original is
+// kept until all the days have been created, and expanded again by a later
+// sync.
+//
+// It returns the list of events with the multi-day events replaced by the
+// created ones, and notes describing the expansions for the confirmation
+// email.
+func (s *Syncer) expandMultiDayEvents(ctx context.Context, events []*gcal.Event) ([]*gcal.Event, []string) {
+	if s.readOnly {
+		// Read-only calendars can't be changed. Their providers already
+		// return a single-day event for each covered date.
+		return events, nil
+	}
+
+	result := make([]*gcal.Event, 0, len(events))
+	var notes []string
+
+	for _, event := range events {
+		first, last, isMultiDay := calendar.MultiDayRange(event)
+		if !isMultiDay || event.Status == "cancelled" || event.RecurringEventId != "" {
+			result = append(result, event)
+			continue
+		}
+		if !calendar.HasManagedProperty(event) && !calendar.HasDescriptionTag(event) {
+			result = append(result, event)
+			continue
+		}
+
+		title := s.catalog.CanonicalTitle(event.Summary)
+		day := s.catalog.ParseDayLocation(title)
+		if !day.IsKnown() {
+			log.Printf("Multi-day event %s has an unrecognized title (%q). Ignoring it.", event.Id, title)
+			result = append(result, event)
+			continue
+		}
+
+		firstStr, lastStr := first.Format("2006-01-02"), last.Format("2006-01-02")
+		log.Printf("Expanding multi-day event %s (%s, %s → %s) into daily events...", event.Id, title, firstStr, lastStr)
+
+		created, err := s.createDailyEvents(ctx, event, title, s.catalog.DayColorID(day), generateDateRange(first, last))
+		result = append(result, created...)
+		if err != nil {
+			log.Printf("Error expanding multi-day event %s: %v. The original event will be kept.", event.Id, err)
+			result = append(result, event)
+			continue
+		}
+
+		err = s.deleteEvent(ctx, event.Id, first, fmt.Sprintf("split into %d daily events", len(created)))
+		if err != nil && !googleapi.IsNotModified(err) && !isNotFoundError(err) {
+			log.Printf("Error deleting multi-day event %s after expanding it: %v. It will be expanded again by a later sync.", event.Id, err)
+			result = append(result, event)
+			continue
+		}
+		log.Printf("Deleted multi-day event %s after expanding it into %d daily events.", event.Id, len(created))
+
+		notes = append(notes, fmt.Sprintf("The %s event spanning %s → %s has been split into %d daily events.", title, firstStr, lastStr, len(created)))
+	}
+
+	return result, notes
+}
+
+// createDailyEvents creates a managed single-day event for each date,
+// based on the given source event. The daily events which were already
+// created by a previous attempt are reused, and the ones which were
+// deleted since then aren't created again. It returns the events, and
+// stops at the first error.
+func (s *Syncer) createDailyEvents(ctx context.Context, source *gcal.Event, title, colorID string, dates []time.Time) ([]*gcal.Event, error) {
+	created := make([]*gcal.Event, 0, len(dates))
+	description := calendar.StripDescriptionTag(source.Description)
+
+	for _, date := range dates {
+		dateStr := date.Format("2006-01-02")
+		dailyEvent := &gcal.Event{
+			Id:          dailyEventID(source.Id, date),
+			Summary:     title,
+			Description: description,
+			Start:       &gcal.EventDateTime{Date: dateStr},
+			End:         &gcal.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+			ColorId:     colorID,
+			ExtendedProperties: &gcal.EventExtendedProperties{
+				Private: map[string]string{calendar.ManagedPropertyKey: "true"},
+			},
+		}
+		createdEvent, err := s.calendarService.InsertEvent(ctx, dailyEvent)
+		if isAlreadyExistsError(err) {
+			createdEvent, err = s.calendarService.GetEvent(ctx, dailyEvent.Id)
+			if isNotFoundError(err) || (err == nil && createdEvent.Status == "cancelled") {
+				log.Printf("Daily event %s for %s from event %s was deleted after being created. Not creating it again.", dailyEvent.Id, dateStr, source.Id)
+				continue
+			}
+			if err == nil {
+				log.Printf("Daily event %s for %s from event %s was already created by a previous attempt.", dailyEvent.Id, dateStr, source.Id)
+			}
+		} else if err == nil {
+			log.Printf("Created daily event %s for %s from event %s.", createdEvent.Id, dateStr, source.Id)
+		}
+		if err != nil {
+			return created, fmt.Errorf("failed creating daily event for %s: %w", dateStr, err)
+		}
+		created = append(created, createdEvent)
+	}
+
+	return created, nil
+}
+
+// dailyEventID returns the ID of the daily event created for a date from
+// the given source event. It is derived from both, so creating it again
+// fails instead of duplicating it. Like the IDs of newEventID, it is made
+// of base32hex characters.
+func dailyEventID(sourceID string, date time.Time) string {
+	hash := sha256.Sum256([]byte(sourceID + "/" + date.Format("2006-01-02")))
+	return "vd" + strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(hash[:20]))
+}
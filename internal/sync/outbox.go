@@ -0,0 +1,378 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	"github.com/google/uuid"
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// Maximum number of outbox items executed in a single run.
+	outboxBatchSize = 100
+	// Delay before retrying a failed outbox item for the first time. It is
+	// doubled after each failure, up to outboxMaxRetryDelay.
+	outboxRetryDelay    = 30 * time.Second
+	outboxMaxRetryDelay = time.Hour
+	// Number of failed attempts after which an outbox item is dead, so it
+	// isn't retried until it is requeued with the admin CLI.
+	outboxMaxAttempts = 10
+	// Interval at which the outbox worker looks for items to retry.
+	outboxWorkerInterval = time.Minute
+)
+
+// outboxPayload is the JSON stored with an outbox item. ForceSendFields is
+// stored separately since it isn't part of the event's JSON.
+type outboxPayload struct {
+	Event           *gcal.Event `json:"event,omitempty"`
+	ForceSendFields []string    `json:"forceSendFields,omitempty"`
+	// Why the event is deleted and the sync run which decided it, which
+	// are recorded with the snapshot of deleted events.
+	Reason    string `json:"reason,omitempty"`
+	SyncRunID string `json:"syncRunId,omitempty"`
+}
+
+// enqueueInsert records the creation of an event in the outbox. The ID of
+// the event (see newEventID) is chosen beforehand, so retrying the
+// insertion after a crash can't create a duplicate.
+func (s *Syncer) enqueueInsert(ctx context.Context, date time.Time, eventID string, event *gcal.Event) error {
+	return s.enqueueMutation(ctx, database.OutboxInsert, date, eventID, date.Format("2006-01-02"), outboxPayload{Event: event})
+}
+
+// enqueuePatch records a patch of an event in the outbox.
+func (s *Syncer) enqueuePatch(ctx context.Context, date time.Time, eventID string, patch *gcal.Event) error {
+	return s.enqueueMutation(ctx, database.OutboxPatch, date, eventID, eventID, outboxPayload{Event: patch})
+}
+
+// enqueueDelete records the deletion of an event in the outbox. A snapshot
+// of the event is recorded in deleted_events right before deleting it.
+func (s *Syncer) enqueueDelete(ctx context.Context, date time.Time, eventID, reason string) error {
+	return s.enqueueMutation(ctx, database.OutboxDelete, date, eventID, eventID, outboxPayload{Reason: reason, SyncRunID: syncRunID(ctx)})
+}
+
+// enqueueMutation records a calendar mutation in the outbox. Its
+// idempotency key is derived from the operation, its target (the event,
+// or the date for insertions) and the event or patch, so the same mutation
+// isn't recorded twice while it is pending.
+func (s *Syncer) enqueueMutation(ctx context.Context, operation string, date time.Time, eventID, target string, payload outboxPayload) error {
+	payload.ForceSendFields = forceSendFields(payload.Event)
+	eventData, err := json.Marshal(outboxPayload{Event: payload.Event, ForceSendFields: payload.ForceSendFields})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s of event %s: %w", operation, eventID, err)
+	}
+	hash := sha256.Sum256(eventData)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s of event %s: %w", operation, eventID, err)
+	}
+	item := database.OutboxItem{
+		IdempotencyKey: strings.Join([]string{operation, target, hex.EncodeToString(hash[:16])}, ":"),
+		Operation:      operation,
+		EventID:        eventID,
+		Payload:        data,
+		Date:           date,
+	}
+	return s.dbRepo.EnqueueOutboxItem(ctx, item)
+}
+
+func forceSendFields(event *gcal.Event) []string {
+	if event == nil {
+		return nil
+	}
+	return event.ForceSendFields
+}
+
+// newEventID returns a random event ID which is valid in Google Calendar
+// (base32hex characters, i.e. a-v and 0-9). The UUID is written in hex, so
+// the prefix must also be made of those characters.
+func newEventID() string {
+	return "vp" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// StartOutboxWorker launches a background goroutine which executes the
+// pending outbox items periodically (including the ones left behind by a
+// previous run of the process), retrying the ones which failed.
+func (s *Syncer) StartOutboxWorker(ctx context.Context) {
+	log.Println("Starting outbox worker goroutine...")
+	go func() {
+		ticker := time.NewTicker(outboxWorkerInterval)
+		defer ticker.Stop()
+		for {
+			unlock, err := s.lock(ctx)
+			if err == nil {
+				err = s.ProcessOutbox(ctx)
+				unlock()
+			}
+			if err != nil {
+				log.Printf("Error processing the outbox: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				log.Println("Outbox worker stopping due to context cancellation.")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ProcessOutbox executes the outbox items which are due. Failed items are
+// rescheduled with an exponential backoff, until they have failed
+// outboxMaxAttempts times or fail with an error which can't go away by
+// retrying (see isPermanentError).
+func (s *Syncer) ProcessOutbox(ctx context.Context) error {
+	items, err := s.dbRepo.GetDueOutboxItems(ctx, s.now(), outboxBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	log.Printf("Executing %d calendar mutations from the outbox...", len(items))
+	execErrs := s.executeOutboxItems(ctx, items)
+	failed := 0
+	for i, item := range items {
+		execErr := execErrs[i]
+		if execErr == nil {
+			if err := s.dbRepo.MarkOutboxItemDone(ctx, item.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		failed++
+		if isPermanentError(execErr) || item.Attempts+1 >= outboxMaxAttempts {
+			log.Printf("Error executing outbox item %d (%s of event %s, attempt %d): %v. Giving up; requeue it with the admin CLI once the problem is fixed.", item.ID, item.Operation, item.EventID, item.Attempts+1, execErr)
+			if err := s.dbRepo.MarkOutboxItemDead(ctx, item.ID, execErr.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		delay := min(outboxRetryDelay<<min(item.Attempts, 20), outboxMaxRetryDelay)
+		log.Printf("Error executing outbox item %d (%s of event %s, attempt %d): %v. Retrying in %s.", item.ID, item.Operation, item.EventID, item.Attempts+1, execErr, delay)
+		if err := s.dbRepo.MarkOutboxItemFailed(ctx, item.ID, execErr.Error(), s.now().Add(delay)); err != nil {
+			return err
+		}
+	}
+	log.Printf("Outbox processed: %d mutations executed, %d failed.", len(items)-failed, failed)
+	return nil
+}
+
+// executeOutboxItems executes the items concurrently (the calendar
+// provider limits how many requests are in flight) and returns the error
+// of each one. The items of the same event are executed in order, and
+// stop at the first failure. If the provider supports batches, the events
+// with a single insertion or deletion are executed in batches.
+func (s *Syncer) executeOutboxItems(ctx context.Context, items []database.OutboxItem) []error {
+	execErrs := make([]error, len(items))
+	var eventIDs []string
+	itemsByEvent := make(map[string][]int)
+	for i, item := range items {
+		if _, ok := itemsByEvent[item.EventID]; !ok {
+			eventIDs = append(eventIDs, item.EventID)
+		}
+		itemsByEvent[item.EventID] = append(itemsByEvent[item.EventID], i)
+	}
+
+	batchProvider, canBatch := s.calendarService.(calendar.BatchProvider)
+	var batched []int
+	var wg sync.WaitGroup
+	for _, eventID := range eventIDs {
+		indexes := itemsByEvent[eventID]
+		if canBatch && len(indexes) == 1 && items[indexes[0]].Operation != database.OutboxPatch {
+			batched = append(batched, indexes[0])
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, index := range indexes {
+				execErrs[index] = s.executeOutboxItem(ctx, items[index])
+				if execErrs[index] != nil {
+					for _, skipped := range indexes[i+1:] {
+						execErrs[skipped] = fmt.Errorf("skipped since a previous mutation of the event failed")
+					}
+					return
+				}
+			}
+		}()
+	}
+	for start := 0; start < len(batched); start += calendar.MaxBatchSize {
+		indexes := batched[start:min(start+calendar.MaxBatchSize, len(batched))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.executeOutboxBatch(ctx, batchProvider, items, indexes, execErrs)
+		}()
+	}
+	wg.Wait()
+	return execErrs
+}
+
+// executeOutboxBatch executes the insertions and deletions of items at the
+// given indexes in a single batch, and stores their errors in execErrs.
+func (s *Syncer) executeOutboxBatch(ctx context.Context, batchProvider calendar.BatchProvider, items []database.OutboxItem, indexes []int, execErrs []error) {
+	ops := make([]calendar.BatchOperation, 0, len(indexes))
+	var opIndexes []int
+	for _, index := range indexes {
+		item := items[index]
+		if item.Operation == database.OutboxDelete {
+			if err := s.snapshotOutboxDeletion(ctx, item); err != nil {
+				execErrs[index] = err
+				continue
+			}
+			ops = append(ops, calendar.BatchOperation{DeleteEventID: item.EventID})
+			opIndexes = append(opIndexes, index)
+			continue
+		}
+		event, err := decodeOutboxEvent(item)
+		if err != nil {
+			execErrs[index] = err
+			continue
+		}
+		ops = append(ops, calendar.BatchOperation{Insert: event})
+		opIndexes = append(opIndexes, index)
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	opErrs, err := batchProvider.ExecuteBatch(ctx, ops)
+	for i, index := range opIndexes {
+		if err != nil {
+			execErrs[index] = err
+			continue
+		}
+		execErrs[index] = outboxResult(items[index], opErrs[i])
+	}
+}
+
+// executeOutboxItem executes a calendar mutation.
+func (s *Syncer) executeOutboxItem(ctx context.Context, item database.OutboxItem) error {
+	switch item.Operation {
+	case database.OutboxInsert:
+		event, err := decodeOutboxEvent(item)
+		if err != nil {
+			return err
+		}
+		_, err = s.calendarService.InsertEvent(ctx, event)
+		return outboxResult(item, err)
+	case database.OutboxPatch:
+		patch, err := decodeOutboxEvent(item)
+		if err != nil {
+			return err
+		}
+		_, err = s.calendarService.PatchEvent(ctx, item.EventID, patch)
+		return outboxResult(item, err)
+	case database.OutboxDelete:
+		if err := s.snapshotOutboxDeletion(ctx, item); err != nil {
+			return err
+		}
+		return outboxResult(item, s.calendarService.DeleteEvent(ctx, item.EventID))
+	default:
+		return fmt.Errorf("unknown operation %q", item.Operation)
+	}
+}
+
+// snapshotOutboxDeletion records the snapshot of the event deleted by an
+// outbox item.
+func (s *Syncer) snapshotOutboxDeletion(ctx context.Context, item database.OutboxItem) error {
+	var payload outboxPayload
+	if err := json.Unmarshal(item.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if payload.Reason == "" {
+		payload.Reason = "deleted by reconciliation"
+	}
+	return s.snapshotEvent(ctx, item.EventID, item.Date, payload.Reason, payload.SyncRunID)
+}
+
+// decodeOutboxEvent returns the event (or patch) of an insertion or patch.
+// Insertions get the event ID chosen when they were recorded.
+func decodeOutboxEvent(item database.OutboxItem) (*gcal.Event, error) {
+	var payload outboxPayload
+	if err := json.Unmarshal(item.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if payload.Event == nil {
+		return nil, fmt.Errorf("missing event in %s payload", item.Operation)
+	}
+	payload.Event.ForceSendFields = payload.ForceSendFields
+	if item.Operation == database.OutboxInsert {
+		payload.Event.Id = item.EventID
+	}
+	return payload.Event, nil
+}
+
+// outboxResult returns the error of an executed outbox item. Errors which
+// mean that the mutation was already executed (or no longer applies) are
+// ignored, so items can be safely retried.
+func outboxResult(item database.OutboxItem, err error) error {
+	switch item.Operation {
+	case database.OutboxInsert:
+		if isAlreadyExistsError(err) {
+			log.Printf("Event %s was already created by a previous attempt.", item.EventID)
+			return nil
+		}
+		if err == nil {
+			log.Printf("Successfully created event %s for %s", item.EventID, item.Date.Format("2006-01-02"))
+		}
+	case database.OutboxPatch:
+		if isNotFoundError(err) {
+			log.Printf("Event %s no longer exists, so it can't be patched.", item.EventID)
+			return nil
+		}
+		if err == nil {
+			log.Printf("Successfully patched metadata for event %s", item.EventID)
+		}
+	case database.OutboxDelete:
+		if err == nil || googleapi.IsNotModified(err) || isNotFoundError(err) {
+			log.Printf("Deleted event %s from calendar.", item.EventID)
+			return nil
+		}
+	}
+	return err
+}
+
+// isAlreadyExistsError returns whether an insertion failed because an
+// event with the same ID exists (409 Conflict in Google Calendar, 412
+// Precondition Failed in CalDAV).
+func isAlreadyExistsError(err error) bool {
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return gErr.Code == http.StatusConflict || gErr.Code == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// isPermanentError returns whether a mutation which failed with err would
+// fail again if it was retried: the request is invalid (400 Bad Request),
+// isn't allowed (403 Forbidden, unless it was rate limited) or targets an
+// event which doesn't exist (404 Not Found).
+func isPermanentError(err error) bool {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || calendar.IsRetryableError(err) {
+		return false
+	}
+	switch gErr.Code {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// ActionKind identifies what a reconciliation action does.
+type ActionKind string
+
+const (
+	// ActionDeleteDuplicate deletes a duplicate managed event.
+	ActionDeleteDuplicate ActionKind = "delete_duplicate"
+	// ActionDeleteEvent deletes an event added to a frozen date which
+	// doesn't have a location.
+	ActionDeleteEvent ActionKind = "delete_event"
+	// ActionCreateEvent creates the default event of a date.
+	ActionCreateEvent ActionKind = "create_event"
+	// ActionAddProperty marks an event as managed with the private
+	// property.
+	ActionAddProperty ActionKind = "add_property"
+	// ActionSetTitle changes the title of an event.
+	ActionSetTitle ActionKind = "set_title"
+	// ActionRemoveDescriptionTag removes the tag from the description of
+	// an event.
+	ActionRemoveDescriptionTag ActionKind = "remove_description_tag"
+	// ActionSetColor changes the color of an event.
+	ActionSetColor ActionKind = "set_color"
+	// ActionUpsertScheduleEntry inserts or updates the schedule_entries
+	// row of a date.
+	ActionUpsertScheduleEntry ActionKind = "upsert_schedule_entry"
+	// ActionReplaceSegments replaces the schedule_entry_segments rows of a
+	// date.
+	ActionReplaceSegments ActionKind = "replace_segments"
+	// ActionRecordRejection records a title rejected by strict
+	// validation.
+	ActionRecordRejection ActionKind = "record_rejection"
+	// ActionRecordConflict records that a conflict between events which
+	// are kept in the calendar has been reported.
+	ActionRecordConflict ActionKind = "record_conflict"
+)
+
+// isPatch returns whether the action is applied by patching an event.
+// Consecutive patches of the same event are merged into a single one.
+func (k ActionKind) isPatch() bool {
+	switch k {
+	case ActionAddProperty, ActionSetTitle, ActionRemoveDescriptionTag, ActionSetColor:
+		return true
+	}
+	return false
+}
+
+// Action is a single change computed by the reconciliation planner.
+type Action struct {
+	Kind ActionKind `json:"kind"`
+	// ID of the event affected by the action, if any.
+	EventID string `json:"event_id,omitempty"`
+	// Human-readable summary of the change.
+	Details string `json:"details,omitempty"`
+	// Event to insert, or patch to apply to the event.
+	Event *gcal.Event `json:"event,omitempty"`
+
+	entry     *database.ScheduleEntry
+	segments  []database.ScheduleEntrySegment
+	rejection *database.RejectedTitle
+	// Sorted IDs of the conflicting events, separated by commas.
+	conflictEventIDs string
+	// Entry replaced by entry, recorded in the schedule history.
+	previous *database.ScheduleEntry
+}
+
+// DatePlan holds the actions needed to reconcile a date, and what will be
+// reported in the confirmation email once they are executed.
+type DatePlan struct {
+	Date    string   `json:"date"`
+	Actions []Action `json:"actions"`
+	// Change of the location (e.g. "HOM → V").
+	LocationChange string `json:"location_change,omitempty"`
+	// Explanations of additional actions taken.
+	Notes []string `json:"notes,omitempty"`
+
+	date time.Time
+	// Whether the title of the event was rejected by strict validation.
+	rejected bool
+}
+
+func (p *DatePlan) add(action Action) {
+	p.Actions = append(p.Actions, action)
+}
+
+// ReconciliationPlan is the list of actions which reconciliation would
+// perform for a set of dates.
+type ReconciliationPlan struct {
+	Dates []DatePlan `json:"dates"`
+}
+
+// NumActions returns the number of actions of the plan.
+func (p *ReconciliationPlan) NumActions() int {
+	n := 0
+	for _, datePlan := range p.Dates {
+		n += len(datePlan.Actions)
+	}
+	return n
+}
+
+// PlanReconciliation computes the actions which reconciliation would
+// perform for the given dates (or the sync window, if empty), based on the
+// event cache, without modifying the calendar nor the database.
+func (s *Syncer) PlanReconciliation(ctx context.Context, dates []time.Time) (*ReconciliationPlan, error) {
+	if len(dates) == 0 {
+		dates = s.syncWindowDates()
+	}
+	plan := &ReconciliationPlan{}
+	for _, date := range dates {
+		datePlan, err := s.planDate(ctx, date)
+		if err != nil {
+			return nil, err
+		}
+		plan.Dates = append(plan.Dates, *datePlan)
+	}
+	return plan, nil
+}
+
+// executePlan applies the actions of a date plan: DB changes are written
+// directly and calendar mutations are recorded in the outbox. It must be
+// called inside the transaction in which the plan was computed.
+func (s *Syncer) executePlan(ctx context.Context, plan *DatePlan) error {
+	dateStr := plan.date.Format("2006-01-02")
+
+	var patch *gcal.Event
+	var patchEventID string
+	flushPatch := func() error {
+		if patch == nil {
+			return nil
+		}
+		if err := s.enqueuePatch(ctx, plan.date, patchEventID, patch); err != nil {
+			return fmt.Errorf("failed recording patch of calendar event %s metadata: %w", patchEventID, err)
+		}
+		patch, patchEventID = nil, ""
+		return nil
+	}
+
+	for _, action := range plan.Actions {
+		if action.Kind.isPatch() {
+			if patch != nil && patchEventID != action.EventID {
+				if err := flushPatch(); err != nil {
+					return err
+				}
+			}
+			if patch == nil {
+				patch, patchEventID = &gcal.Event{}, action.EventID
+			}
+			log.Printf("Patching event %s (%s): %s", action.EventID, action.Kind, action.Details)
+			patch = mergeEventPatches(patch, action.Event)
+			continue
+		}
+		if err := flushPatch(); err != nil {
+			return err
+		}
+
+		switch action.Kind {
+		case ActionDeleteDuplicate:
+			log.Printf("Deleting duplicate event %s from calendar for date %s", action.EventID, dateStr)
+			if err := s.enqueueDelete(ctx, plan.date, action.EventID, action.Details); err != nil {
+				return fmt.Errorf("failed to record deletion of duplicate event %s: %w", action.EventID, err)
+			}
+		case ActionDeleteEvent:
+			log.Printf("Deleting event %s from calendar for frozen date %s", action.EventID, dateStr)
+			if err := s.enqueueDelete(ctx, plan.date, action.EventID, action.Details); err != nil {
+				return fmt.Errorf("failed to record deletion of event %s: %w", action.EventID, err)
+			}
+		case ActionCreateEvent:
+			log.Printf("Creating default calendar event for %s", dateStr)
+			if err := s.enqueueInsert(ctx, plan.date, action.EventID, action.Event); err != nil {
+				return fmt.Errorf("failed recording creation of default calendar event for %s: %w", dateStr, err)
+			}
+		case ActionUpsertScheduleEntry:
+			for _, segment := range action.segments {
+				s.registerLocation(ctx, segment.LocationCode, derefString(segment.Category))
+			}
+			log.Printf("Updating schedule_entries for %s: Code=%s, Status=%s", dateStr, action.entry.LocationCode, action.entry.Status)
+			if err := s.writeScheduleEntry(ctx, action.previous, *action.entry, action.EventID); err != nil {
+				return fmt.Errorf("failed to update schedule_entries for %s: %w", dateStr, err)
+			}
+		case ActionReplaceSegments:
+			log.Printf("Updating schedule_entry_segments for %s (%s)", dateStr, action.Details)
+			if err := s.dbRepo.ReplaceScheduleEntrySegments(ctx, plan.date, action.segments); err != nil {
+				return fmt.Errorf("failed to update schedule_entry_segments for %s: %w", dateStr, err)
+			}
+		case ActionRecordRejection:
+			s.recordRejectedTitle(ctx, *action.rejection)
+		case ActionRecordConflict:
+			s.recordReportedConflict(ctx, plan.date, action.conflictEventIDs)
+		default:
+			return fmt.Errorf("unknown reconciliation action %q", action.Kind)
+		}
+	}
+	return flushPatch()
+}
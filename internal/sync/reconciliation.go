@@ -2,253 +2,708 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
-	"sort"
+	"strings"
 	"time"
 	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
 	"gomodules.avm99963.com/zenithplanner/internal/database"
-	"gomodules.avm99963.com/zenithplanner/internal/email"
 
 	gcal "google.golang.org/api/calendar/v3"
 	"google.golang.org/api/googleapi"
 )
 
 // RunReconciliation performs the cleanup and core reconciliation logic for a set of dates.
-func (s *Syncer) RunReconciliation(ctx context.Context, datesToReconcile []time.Time, triggeredByIncremental bool) error {
+// notes are explanations of actions performed earlier during the sync,
+// which are included in the confirmation email. A date which fails doesn't
+// stop the others from being reconciled, but the errors of all of them are
+// returned, so the sync can be retried.
+func (s *Syncer) RunReconciliation(ctx context.Context, datesToReconcile []time.Time, triggeredByIncremental bool, notes []string) error {
 	log.Printf("Starting reconciliation for %d dates...", len(datesToReconcile))
+	ctx = withSyncRun(ctx, database.TriggerReconciliation)
 	changesForEmail := make(map[string]string) // (date_str, "previous -> new")
-	var emailClient *email.Client
-
-	if s.cfg.App.EnableEmailConfirmations {
-		emailClient = email.NewClient(s.cfg.SMTP)
-	}
 
+	anyRejected := false
+	var errs []error
 	for _, date := range datesToReconcile {
 		dateStr := date.Format("2006-01-02")
-		locationDiff, err := s.runSingleReconciliation(ctx, date)
+		plan, err := s.runSingleReconciliation(ctx, date)
 		if err != nil {
 			log.Printf("Error reconcialiating date %s: %v", dateStr, err)
+			errs = append(errs, fmt.Errorf("failed to reconcile %s: %w", dateStr, err))
+		}
+		if plan == nil {
+			continue
 		}
-		if locationDiff != "" {
-			changesForEmail[dateStr] = locationDiff
+		if plan.LocationChange != "" {
+			changesForEmail[dateStr] = plan.LocationChange
 		}
+		notes = append(notes, plan.Notes...)
+		anyRejected = anyRejected || plan.rejected
+	}
+
+	if anyRejected {
+		notes = append(notes, "Valid locations are: "+strings.Join(s.catalog.ValidTitles(), ", ")+".")
 	}
 
-	if emailClient != nil && len(changesForEmail) > 0 {
-		log.Printf("Sending confirmation email for %d changed dates.", len(changesForEmail))
-		emailErr := emailClient.SendConfirmation(changesForEmail)
+	if err := s.ProcessOutbox(ctx); err != nil {
+		log.Printf("Error processing the outbox after reconciliation: %v", err)
+	}
+
+	if s.notifier != nil && (len(changesForEmail) > 0 || len(notes) > 0) {
+		log.Printf("Sending confirmation email for %d changed dates and %d notes.", len(changesForEmail), len(notes))
+		emailErr := s.notifier.SendConfirmation(changesForEmail, notes)
 		if emailErr != nil {
 			log.Printf("Error sending confirmation email: %v", emailErr)
 		}
 	}
 
-	log.Printf("Reconciliation finished for %d dates.", len(datesToReconcile))
-	return nil
+	log.Printf("Reconciliation finished for %d dates (%d failed).", len(datesToReconcile), len(errs))
+	return errors.Join(errs...)
+}
+
+// runSingleReconciliation plans the reconciliation of a date and executes
+// the plan, which is returned (with the outcome to be included in the
+// email) together with an error. The DB changes and the calendar mutations
+// recorded in the outbox are committed in a single transaction, so they
+// can't disagree.
+func (s *Syncer) runSingleReconciliation(ctx context.Context, date time.Time) (*DatePlan, error) {
+	var plan *DatePlan
+	err := s.dbRepo.InTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if plan, err = s.planDate(ctx, date); err != nil {
+			return err
+		}
+		return s.executePlan(ctx, plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
 }
 
-// runSingleReconciliation runs reconciliation, and returns a string
-// with the change performed to the location (in order to be included in
-// the email) and an error.
-func (s *Syncer) runSingleReconciliation(ctx context.Context, date time.Time) (string, error) {
+// planDate computes the actions needed to reconcile a date. It only reads
+// from the DB.
+func (s *Syncer) planDate(ctx context.Context, date time.Time) (*DatePlan, error) {
 	dateStr := date.Format("2006-01-02")
 	log.Printf("Reconciling date: %s", dateStr)
 
 	cachedEvents, err := s.dbRepo.GetCachedEventsByDate(ctx, date)
 	if err != nil {
-		return "", fmt.Errorf("error querying cache for date %s: %w", dateStr, err)
+		return nil, fmt.Errorf("error querying cache for date %s: %w", dateStr, err)
 	}
 
-	authoritativeEvent := s.cleanUpDuplicates(dateStr, cachedEvents)
+	plan := &DatePlan{Date: dateStr, date: date}
+	authoritativeEvent := s.planDuplicateCleanUp(ctx, date, cachedEvents, plan)
 
 	currentDbEntry, err := s.dbRepo.GetScheduleEntry(ctx, date)
 	if err != nil {
-		return "", fmt.Errorf("error fetching current schedule_entries for %s: %w", dateStr, err)
+		return nil, fmt.Errorf("error fetching current schedule_entries for %s: %w", dateStr, err)
 	}
 
-	previousLocation := s.cfg.App.DefaultLocationCode
+	defaultLocation, _, err := s.defaultLocationFor(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	previousLocation := defaultLocation
 	if currentDbEntry != nil {
 		previousLocation = currentDbEntry.LocationCode
 	}
 
-	dbChanged, newLocationCode, err := s.coreReconciliationLogic(ctx, date, authoritativeEvent, currentDbEntry)
+	dbChanged, newLocationCode, err := s.planCoreReconciliation(ctx, date, authoritativeEvent, currentDbEntry, plan)
 	if err != nil {
-		return "", fmt.Errorf("Error during core reconciliation for %s: %w", dateStr, err)
+		return nil, fmt.Errorf("Error during core reconciliation for %s: %w", dateStr, err)
 	}
 
-	locationDiff := ""
-	if dbChanged && previousLocation != newLocationCode && (authoritativeEvent != nil || newLocationCode != s.cfg.App.DefaultLocationCode) {
+	if dbChanged && previousLocation != newLocationCode && (authoritativeEvent != nil || newLocationCode != defaultLocation) {
 		formattedPreviousLocation := previousLocation
 		if authoritativeEvent == nil {
 			formattedPreviousLocation = "<none>"
 		}
-		locationDiff = fmt.Sprintf("%s → %s", formattedPreviousLocation, newLocationCode)
+		plan.LocationChange = fmt.Sprintf("%s → %s", formattedPreviousLocation, newLocationCode)
 	}
 
-	return locationDiff, nil
+	return plan, nil
 }
 
-func (s *Syncer) cleanUpDuplicates(dateStr string, cachedEvents []database.CachedEvent) *database.CachedEvent {
-	authoritativeEvent, duplicatesToDelete := identifyAuthoritativeCachedEvent(cachedEvents)
-	s.deleteEventsFromCalendar(dateStr, duplicatesToDelete)
-	return authoritativeEvent
-}
-
-// identifyAuthoritativeCachedEvent returns the authorative cached event
-// (the most recent one) and a list of duplicates to be deleted.
-func identifyAuthoritativeCachedEvent(cachedEvents []database.CachedEvent) (*database.CachedEvent, []string) {
-	var authoritativeEvent *database.CachedEvent = nil
-	duplicates := []string{}
-	managedEvents := make([]database.CachedEvent, 0, len(cachedEvents))
+// planDuplicateCleanUp chooses the authoritative event among the schedule
+// events of a date with the conflict policy, adds the deletion of the other
+// ones to plan (unless the policy keeps them), and explains the choice in
+// its notes. Conflicts which are kept in the calendar are only explained
+// the first time, and again if the conflicting events change.
+func (s *Syncer) planDuplicateCleanUp(ctx context.Context, date time.Time, cachedEvents []database.CachedEvent, plan *DatePlan) *database.CachedEvent {
+	resolution := resolveConflicts(cachedEvents, s.isScheduleEvent, s.conflictPolicy)
+	if s.readOnly || len(resolution.losers) == 0 {
+		// Duplicates can't be removed from a read-only calendar, so the
+		// chosen event is used and the rest are ignored.
+		return resolution.winner
+	}
 
-	for i := range cachedEvents {
-		event := cachedEvents[i]
-		if event.IsManagedProperty || event.IsManagedDescription {
-			managedEvents = append(managedEvents, event)
+	dateStr := date.Format("2006-01-02")
+	log.Printf("Found %d duplicate managed events for %s. Event %s wins because %s.", len(resolution.losers), dateStr, resolution.winner.EventID, resolution.reason)
+	if s.keepConflictingEvents {
+		eventIDs := conflictEventIDs(resolution)
+		reported, err := s.dbRepo.GetReportedConflict(ctx, date)
+		if err != nil {
+			log.Printf("Error checking whether the conflict of %s was already reported: %v", dateStr, err)
+		}
+		if reported != eventIDs {
+			plan.Notes = append(plan.Notes, conflictNote(dateStr, resolution, true))
+			plan.add(Action{
+				Kind:             ActionRecordConflict,
+				Details:          eventIDs,
+				conflictEventIDs: eventIDs,
+			})
 		}
+		return resolution.winner
 	}
-
-	if len(managedEvents) > 0 {
-		sort.Slice(managedEvents, func(i, j int) bool {
-			return managedEvents[j].UpdatedTs.Before(managedEvents[i].UpdatedTs)
+	plan.Notes = append(plan.Notes, conflictNote(dateStr, resolution, false))
+	for _, loser := range resolution.losers {
+		plan.add(Action{
+			Kind:    ActionDeleteDuplicate,
+			EventID: loser.EventID,
+			Details: fmt.Sprintf("duplicate of %s (%s)", resolution.winner.EventID, resolution.reason),
 		})
-		authoritativeEvent = &managedEvents[0]
-		for i := 1; i < len(managedEvents); i++ {
-			duplicates = append(duplicates, managedEvents[i].EventID)
-		}
 	}
-
-	return authoritativeEvent, duplicates
+	return resolution.winner
 }
 
-func (s *Syncer) deleteEventsFromCalendar(dateStr string, eventIDs []string) {
-	if len(eventIDs) > 0 {
-		log.Printf("Found %d duplicate managed events for %s. Cleaning up...", len(eventIDs), dateStr)
-		for _, eventID := range eventIDs {
-			log.Printf("Deleting duplicate event %s from calendar for date %s", eventID, dateStr)
-			err := s.calendarService.Events.Delete(s.cfg.Google.CalendarID, eventID).Do()
-			if err != nil && !googleapi.IsNotModified(err) && !isNotFoundError(err) { // Check for acceptable errors
-				log.Printf("Error deleting duplicate event %s from calendar: %v", eventID, err)
-			} else if err == nil {
-				log.Printf("Successfully deleted duplicate event %s from calendar.", eventID)
-			} else {
-				log.Printf("Event %s likely already gone (the action was a noop).", eventID)
-			}
-		}
+// isScheduleEvent returns whether a cached event holds the location of its
+// date: managed events and events tagged to be added, and, in read-only
+// mode, also events whose title is a known location (since they can't be
+// tagged).
+func (s *Syncer) isScheduleEvent(event database.CachedEvent) bool {
+	if event.IsManagedProperty || event.IsManagedDescription {
+		return true
 	}
+	return s.readOnly && s.catalog.ParseDayLocation(s.catalog.CanonicalTitle(derefString(event.Title))).IsKnown()
 }
 
-// coreReconciliationLogic ensures the schedule_entries table and the single
-// authoritative Calendar event's metadata are consistent.
-// Assumes Calendar cleanup (duplicate deletion) already happened for this date.
-// Returns true if schedule_entries was updated, the new location code, and any error.
-func (s *Syncer) coreReconciliationLogic(ctx context.Context, date time.Time, authoritativeCacheData *database.CachedEvent, currentDbEntry *database.ScheduleEntry) (dbChanged bool, finalLocationCode string, err error) {
+// planCoreReconciliation adds to plan the actions which make the
+// schedule_entries table and the single authoritative Calendar event's
+// metadata consistent.
+// Assumes Calendar cleanup (duplicate deletion) was already planned for this date.
+// Notes for the email are added to plan.
+// Returns true if schedule_entries will be updated, the new location code, and any error.
+func (s *Syncer) planCoreReconciliation(ctx context.Context, date time.Time, authoritativeCacheData *database.CachedEvent, currentDbEntry *database.ScheduleEntry, plan *DatePlan) (dbChanged bool, finalLocationCode string, err error) {
 	var targetLocationCode, targetStatus, eventId string
-	var needsProperty, needsDescriptionUpdate, needsColorUpdate, needsDbUpdate, needsEventCreation bool
+	var needsProperty, needsDescriptionUpdate, needsColorUpdate, needsTitleUpdate, needsDbUpdate, needsEventCreation bool
+	var calendarTitle, calendarColor string
+	var isAutoDefaultTitle, restoresFrozenEvent bool
 
 	dateStr := date.Format("2006-01-02") // For logging
 
+	defaultLocationCode, defaultNeedsEvent, err := s.defaultLocationFor(ctx, date)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Frozen dates keep the location stored in the DB, and changes in the
+	// calendar are undone.
+	frozen := currentDbEntry != nil && s.isFrozen(ctx, date)
+	if frozen && currentDbEntry.LocationCode == "" && authoritativeCacheData != nil && !s.readOnly {
+		log.Printf("%s is frozen without a location. Deleting event %s.", dateStr, authoritativeCacheData.EventID)
+		plan.Notes = append(plan.Notes, s.frozenNote(dateStr, fmt.Sprintf("the event “%s” was added", derefString(authoritativeCacheData.Title)), "it has been deleted"))
+		plan.add(Action{
+			Kind:    ActionDeleteEvent,
+			EventID: authoritativeCacheData.EventID,
+			Details: "added to a frozen date",
+		})
+		authoritativeCacheData = nil
+	}
+
 	// 1. Determine Target State & Required Actions
+	var targetDay calendar.DayLocation
 	if authoritativeCacheData != nil {
 		title := derefString(authoritativeCacheData.Title)
-		status := calendar.DetermineStatus(title)
+		// Events created automatically which haven't been modified by the
+		// user follow the current default location (e.g. if the date
+		// became a holiday after the event was created).
+		if !frozen && isUnmodifiedAutoDefault(authoritativeCacheData) && defaultLocationCode != "" && title != defaultLocationCode {
+			log.Printf("Default location for %s changed from %s to %s. Updating auto-created event %s.", dateStr, title, defaultLocationCode, authoritativeCacheData.EventID)
+			title = defaultLocationCode
+			isAutoDefaultTitle = true
+		}
+		if canonicalTitle := s.catalog.CanonicalTitle(title); canonicalTitle != title {
+			log.Printf("Interpreting title %q of event %s as %s.", title, authoritativeCacheData.EventID, canonicalTitle)
+			// Read-only calendars keep the original title, so the
+			// interpretation is only explained when it is stored.
+			if !s.readOnly || currentDbEntry == nil || currentDbEntry.LocationCode != canonicalTitle {
+				plan.Notes = append(plan.Notes, fmt.Sprintf("%s: you wrote “%s”, interpreted as %s.", dateStr, title, canonicalTitle))
+			}
+			title = canonicalTitle
+		}
+		calendarTitle = title
+		targetDay = s.dayLocationFor(title)
+		expectedColor := s.catalog.DayColorID(targetDay)
+
+		if frozen && title != currentDbEntry.LocationCode {
+			log.Printf("%s is frozen. Undoing the change of event %s from %s to %s.", dateStr, authoritativeCacheData.EventID, currentDbEntry.LocationCode, title)
+			// Read-only calendars can't be restored, so the change is only
+			// ignored.
+			if !s.readOnly {
+				plan.Notes = append(plan.Notes, s.frozenNote(dateStr, fmt.Sprintf("the event was changed to “%s”", derefString(authoritativeCacheData.Title)), "it has been restored to "+currentDbEntry.LocationCode))
+			}
+			title = currentDbEntry.LocationCode
+			calendarTitle = title
+			targetDay = s.dayLocationFor(title)
+			expectedColor = s.catalog.DayColorID(targetDay)
+		} else if s.cfg.App.StrictValidation.Enabled && !targetDay.IsKnown() {
+			rejection := s.rejectUnknownTitle(ctx, date, authoritativeCacheData.EventID, title, currentDbEntry, defaultLocationCode, plan)
+			title = rejection.locationCode
+			calendarTitle = rejection.calendarTitle
+			targetDay = s.dayLocationFor(title)
+			expectedColor = rejection.colorID
+		}
+
 		targetLocationCode = title
-		targetStatus = string(status)
+		targetStatus = string(s.catalog.DayStatus(targetDay))
 		eventId = authoritativeCacheData.EventID
 
+		needsTitleUpdate = calendarTitle != derefString(authoritativeCacheData.Title)
 		needsProperty = !authoritativeCacheData.IsManagedProperty
 		needsDescriptionUpdate = authoritativeCacheData.IsManagedDescription
-		expectedColor := s.colorMap[status]
 		needsColorUpdate = derefString(authoritativeCacheData.ColorID) != expectedColor
+		if needsColorUpdate {
+			calendarColor = expectedColor
+		}
+	} else if frozen {
+		targetLocationCode = currentDbEntry.LocationCode
+		needsEventCreation = targetLocationCode != "" && !s.readOnly
+		restoresFrozenEvent = needsEventCreation
+		targetDay = s.dayLocationFor(targetLocationCode)
+		targetStatus = string(s.catalog.DayStatus(targetDay))
+		if needsEventCreation {
+			log.Printf("%s is frozen. Restoring its deleted event with %s.", dateStr, targetLocationCode)
+			plan.Notes = append(plan.Notes, s.frozenNote(dateStr, "the event was deleted", "it has been created again with "+targetLocationCode))
+			eventId = newEventID()
+		}
 	} else {
-		targetLocationCode = s.cfg.App.DefaultLocationCode
-		targetStatus = string(calendar.DetermineStatus(targetLocationCode))
+		// Read-only calendars can't hold default events, so the default
+		// location is only stored in the DB.
+		targetLocationCode, needsEventCreation = defaultLocationCode, defaultNeedsEvent && !s.readOnly
+		targetDay = s.dayLocationFor(targetLocationCode)
+		targetStatus = string(s.catalog.DayStatus(targetDay))
 		eventId = ""
+		if needsEventCreation {
+			// The ID of the created event is chosen now, so the schedule
+			// history can refer to it.
+			eventId = newEventID()
+		}
+	}
+
+	var targetDescription calendar.DescriptionData
+	if authoritativeCacheData != nil {
+		targetDescription = calendar.ParseDescription(derefString(authoritativeCacheData.Description))
+	} else {
+		targetDescription = calendar.ParseDescription("")
+	}
 
-		needsEventCreation = true
+	targetCategory, _ := s.statsAttributes(calendar.LocationStatus(targetStatus))
+	targetSegments := s.segmentsForDay(date, targetDay)
+	targetIsWorkingDay := false
+	for _, segment := range targetSegments {
+		targetIsWorkingDay = targetIsWorkingDay || segment.IsWorkingDay
+	}
+	if frozen {
+		// The stats of frozen dates are final, so only their note and tags
+		// can still change.
+		targetStatus = currentDbEntry.Status
+		targetCategory = derefString(currentDbEntry.Category)
+		targetIsWorkingDay = currentDbEntry.IsWorkingDay
 	}
 
-	needsDbUpdate = currentDbEntry == nil || currentDbEntry.LocationCode != targetLocationCode || currentDbEntry.Status != targetStatus
+	needsDbUpdate = currentDbEntry == nil ||
+		currentDbEntry.LocationCode != targetLocationCode ||
+		currentDbEntry.Status != targetStatus ||
+		derefString(currentDbEntry.Category) != targetCategory ||
+		currentDbEntry.IsWorkingDay != targetIsWorkingDay
+	needsSegmentsUpdate := needsDbUpdate
+	needsDbUpdate = needsDbUpdate ||
+		derefString(currentDbEntry.Note) != targetDescription.Note ||
+		!maps.Equal(currentDbEntry.Tags, targetDescription.Tags)
+
+	if !needsSegmentsUpdate && !frozen {
+		currentSegments, segErr := s.dbRepo.GetScheduleEntrySegments(ctx, date)
+		if segErr != nil {
+			return false, targetLocationCode, fmt.Errorf("failed to fetch segments for %s: %w", dateStr, segErr)
+		}
+		needsSegmentsUpdate = !segmentsEqual(currentSegments, targetSegments)
+	}
 
 	finalLocationCode = targetLocationCode
 
 	if needsDbUpdate {
-		log.Printf("Updating schedule_entries for %s: Code=%s, Status=%s", dateStr, targetLocationCode, targetStatus)
 		entry := database.ScheduleEntry{
 			Date:         date,
 			LocationCode: targetLocationCode,
 			Status:       targetStatus,
+			IsWorkingDay: targetIsWorkingDay,
+			Tags:         targetDescription.Tags,
 		}
-		dbErr := s.dbRepo.UpsertScheduleEntry(ctx, entry)
-		if dbErr != nil {
-			return false, finalLocationCode, fmt.Errorf("failed to update schedule_entries for %s: %w", dateStr, dbErr)
+		if targetCategory != "" {
+			entry.Category = &targetCategory
 		}
-		dbChanged = true // Mark DB as changed only on successful update
+		if targetDescription.Note != "" {
+			entry.Note = &targetDescription.Note
+		}
+		previous := "<none>"
+		if currentDbEntry != nil {
+			previous = fmt.Sprintf("%s (%s)", currentDbEntry.LocationCode, currentDbEntry.Status)
+		}
+		plan.add(Action{
+			Kind:     ActionUpsertScheduleEntry,
+			EventID:  eventId,
+			Details:  fmt.Sprintf("%s -> %s (%s)", previous, targetLocationCode, targetStatus),
+			entry:    &entry,
+			segments: targetSegments,
+			previous: currentDbEntry,
+		})
+		dbChanged = true
 	}
 
-	if eventId != "" {
-		var patchEvent *gcal.Event
-		var patchNeeded bool
+	if needsSegmentsUpdate {
+		plan.add(Action{
+			Kind:     ActionReplaceSegments,
+			Details:  describeSegments(targetSegments),
+			segments: targetSegments,
+		})
+	}
 
-		// Prepare patch object based on needed updates
+	if authoritativeCacheData != nil && !s.readOnly {
+		// Patches are computed against the cached event.
 		eventToPatch := &gcal.Event{
 			Id:          eventId,
+			Summary:     derefString(authoritativeCacheData.Title),
 			Description: derefString(authoritativeCacheData.Description),
 			ColorId:     derefString(authoritativeCacheData.ColorID),
 		}
+		addPatch := func(kind ActionKind, details string, patch *gcal.Event) {
+			if patch != nil {
+				plan.add(Action{Kind: kind, EventID: eventId, Details: details, Event: patch})
+			}
+		}
 
 		if needsProperty {
-			log.Printf("Adding managed property to event %s", eventId)
-			propPatch := calendar.AddManagedProperty(eventToPatch)
-			patchEvent = mergeEventPatches(patchEvent, propPatch)
-			patchNeeded = true
+			addPatch(ActionAddProperty, "mark as managed", calendar.AddManagedProperty(eventToPatch))
+		}
+		if needsTitleUpdate {
+			var titlePatch *gcal.Event
+			if isAutoDefaultTitle {
+				titlePatch = calendar.SetAutoDefaultTitle(eventToPatch, calendarTitle)
+			} else {
+				titlePatch = calendar.SetTitle(eventToPatch, calendarTitle)
+			}
+			addPatch(ActionSetTitle, fmt.Sprintf("%s -> %s", eventToPatch.Summary, calendarTitle), titlePatch)
 		}
 		if needsDescriptionUpdate {
-			log.Printf("Removing description tag from event %s", eventId)
-			descPatch := calendar.RemoveDescriptionTag(eventToPatch) // Use cached description via eventToPatch
-			patchEvent = mergeEventPatches(patchEvent, descPatch)
-			patchNeeded = patchNeeded || descPatch != nil
+			addPatch(ActionRemoveDescriptionTag, "remove the tag from the description", calendar.RemoveDescriptionTag(eventToPatch))
 		}
 		if needsColorUpdate {
-			log.Printf("Updating color for event %s", eventId)
-			colorPatch := calendar.SetColor(eventToPatch, s.colorMap[calendar.LocationStatus(targetStatus)])
-			patchEvent = mergeEventPatches(patchEvent, colorPatch)
-			patchNeeded = patchNeeded || colorPatch != nil
+			addPatch(ActionSetColor, fmt.Sprintf("%s -> %s", describeColor(eventToPatch.ColorId), describeColor(calendarColor)), calendar.SetColor(eventToPatch, calendarColor))
 		}
+	}
 
-		if patchNeeded && patchEvent != nil {
-			_, patchErr := s.calendarService.Events.Patch(s.cfg.Google.CalendarID, eventId, patchEvent).Do()
-			if patchErr != nil {
-				return false, finalLocationCode, fmt.Errorf("failed patching calendar event %s metadata: %w", eventId, patchErr)
-			} else {
-				log.Printf("Successfully patched metadata for event %s", eventId)
-			}
-		}
+	if authoritativeCacheData == nil && !needsEventCreation {
+		log.Printf("No calendar event needed for non-working day %s", dateStr)
 	}
 
 	if needsEventCreation {
-		log.Printf("Creating default calendar event for %s", dateStr)
-		defaultEvent := &gcal.Event{
-			Summary: targetLocationCode,
-			Start:   &gcal.EventDateTime{Date: date.Format("2006-01-02")},
-			End:     &gcal.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
-			ColorId: s.colorMap[calendar.LocationStatus(targetStatus)],
-			ExtendedProperties: &gcal.EventExtendedProperties{
-				Private: map[string]string{calendar.ManagedPropertyKey: "true"},
-			},
+		colorID := s.catalog.DayColorID(targetDay)
+		properties := map[string]string{
+			calendar.ManagedPropertyKey:     "true",
+			calendar.AutoDefaultPropertyKey: targetLocationCode,
 		}
-		createdEvent, insertErr := s.calendarService.Events.Insert(s.cfg.Google.CalendarID, defaultEvent).Do()
-		if insertErr != nil {
-			return false, finalLocationCode, fmt.Errorf("failaed creating default calendar event for %s: %w", dateStr, insertErr)
-		} else {
-			log.Printf("Successfully created default event %s for %s", createdEvent.Id, dateStr)
+		if restoresFrozenEvent {
+			// The restored location isn't a default one, so the event
+			// shouldn't follow later changes of the default location.
+			delete(properties, calendar.AutoDefaultPropertyKey)
 		}
+		plan.add(Action{
+			Kind:    ActionCreateEvent,
+			EventID: eventId,
+			Details: fmt.Sprintf("%s (color %s)", targetLocationCode, describeColor(colorID)),
+			Event: &gcal.Event{
+				Summary: targetLocationCode,
+				Start:   &gcal.EventDateTime{Date: date.Format("2006-01-02")},
+				End:     &gcal.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+				ColorId: colorID,
+				ExtendedProperties: &gcal.EventExtendedProperties{
+					Private: properties,
+				},
+			},
+		})
 	}
 
 	return dbChanged, finalLocationCode, nil
 }
 
+// describeSegments returns a summary of the segments of a day (e.g.
+// "AM: HOM, PM: V").
+func describeSegments(segments []database.ScheduleEntrySegment) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		code := segment.LocationCode
+		if code == "" {
+			code = "<none>"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", segment.Half, code))
+	}
+	if len(parts) == 0 {
+		return "no segments"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeColor returns a color ID, or "default" for the calendar color.
+func describeColor(colorID string) string {
+	if colorID == "" {
+		return "default"
+	}
+	return colorID
+}
+
+// defaultLocationFor returns the location code which the given date
+// should have if it doesn't have an explicit location, and whether an
+// event should be created for it.
+func (s *Syncer) defaultLocationFor(ctx context.Context, date time.Time) (locationCode string, createEvent bool, err error) {
+	workingWeek := s.cfg.App.WorkingWeek
+	if !workingWeek.IsWorkingDay(date.Weekday()) {
+		return workingWeek.NonWorkingDayCode, workingWeek.NonWorkingDayCode != "", nil
+	}
+
+	if s.cfg.App.Holidays.Code != "" {
+		holiday, err := s.dbRepo.GetHoliday(ctx, date)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to check whether %s is a holiday: %w", date.Format("2006-01-02"), err)
+		}
+		if holiday != nil {
+			return s.cfg.App.Holidays.Code, true, nil
+		}
+	}
+
+	return s.cfg.App.DefaultLocationCode, true, nil
+}
+
+// dayLocationFor interprets a location code stored in schedule_entries or
+// used as a default, where an empty code means a non-working day without
+// event.
+func (s *Syncer) dayLocationFor(locationCode string) calendar.DayLocation {
+	if locationCode == "" {
+		return calendar.NonWorkingDayLocation()
+	}
+	return s.catalog.ParseDayLocation(locationCode)
+}
+
+// rejectionActionIgnore is the action recorded for titles rejected in
+// read-only mode, where the event can't be reverted nor marked.
+const rejectionActionIgnore = "ignore"
+
+// titleRejection describes how an event whose title was rejected by strict
+// validation should be handled.
+type titleRejection struct {
+	// Location code kept in schedule_entries.
+	locationCode string
+	// Title the calendar event should have.
+	calendarTitle string
+	// Color the calendar event should have.
+	colorID string
+}
+
+// rejectUnknownTitle handles an event title which doesn't match any
+// location when strict validation is enabled. The last valid location is
+// kept in schedule_entries, and the event is either reverted to it or
+// marked with the error prefix. The recording of new rejections is added
+// to plan, and they are explained in its notes.
+func (s *Syncer) rejectUnknownTitle(ctx context.Context, date time.Time, eventID, title string, currentDbEntry *database.ScheduleEntry, defaultLocationCode string, plan *DatePlan) titleRejection {
+	strictCfg := s.cfg.App.StrictValidation
+	dateStr := date.Format("2006-01-02")
+
+	restoredCode := defaultLocationCode
+	if currentDbEntry != nil && (currentDbEntry.LocationCode == "" || s.catalog.ParseDayLocation(currentDbEntry.LocationCode).IsKnown()) {
+		restoredCode = currentDbEntry.LocationCode
+	}
+
+	action := strictCfg.Action
+	if action == config.StrictValidationRevert && restoredCode == "" {
+		// There is no location to revert the event to (e.g. non-working
+		// days without event), so mark it instead.
+		action = config.StrictValidationMark
+	}
+
+	var rejection titleRejection
+	var note string
+	if s.readOnly {
+		// The event can't be changed, so only the DB keeps the last valid
+		// location.
+		action = rejectionActionIgnore
+		rejection = titleRejection{
+			locationCode:  restoredCode,
+			calendarTitle: title,
+		}
+		alreadyRejected, err := s.dbRepo.HasRejectedTitle(ctx, date, eventID, title)
+		if err != nil {
+			log.Printf("Error checking whether the title of %s was already rejected: %v", dateStr, err)
+		}
+		if alreadyRejected {
+			return rejection
+		}
+		note = fmt.Sprintf("%s: “%s” isn't a valid location, so it has been ignored. Please fix the title of the event.", dateStr, title)
+	} else if action == config.StrictValidationMark {
+		rejection = titleRejection{
+			locationCode:  restoredCode,
+			calendarTitle: strictCfg.ErrorPrefix + title,
+			colorID:       s.catalog.UnknownColorID,
+		}
+		if strings.HasPrefix(title, strictCfg.ErrorPrefix) {
+			// The event was already marked as invalid.
+			rejection.calendarTitle = title
+			return rejection
+		}
+		note = fmt.Sprintf("%s: “%s” isn't a valid location, so the event has been marked as invalid. Please fix its title.", dateStr, title)
+	} else {
+		rejection = titleRejection{
+			locationCode:  restoredCode,
+			calendarTitle: restoredCode,
+			colorID:       s.catalog.DayColorID(s.dayLocationFor(restoredCode)),
+		}
+		note = fmt.Sprintf("%s: “%s” isn't a valid location, so the event has been reverted to %s.", dateStr, title, restoredCode)
+	}
+
+	log.Printf("Strict validation rejected title %q of event %s for %s (action: %s).", title, eventID, dateStr, action)
+	rejected := database.RejectedTitle{
+		Date:    date,
+		EventID: eventID,
+		Title:   title,
+		Action:  action,
+	}
+	if restoredCode != "" {
+		rejected.RestoredLocationCode = &restoredCode
+	}
+	plan.add(Action{
+		Kind:      ActionRecordRejection,
+		EventID:   eventID,
+		Details:   fmt.Sprintf("“%s” (action: %s)", title, action),
+		rejection: &rejected,
+	})
+
+	plan.Notes = append(plan.Notes, note)
+	plan.rejected = true
+	return rejection
+}
+
+// isUnmodifiedAutoDefault returns whether the event was created
+// automatically by ZenithPlanner and its title hasn't been changed since.
+func isUnmodifiedAutoDefault(event *database.CachedEvent) bool {
+	return event.AutoDefaultCode != nil && *event.AutoDefaultCode == derefString(event.Title)
+}
+
+// registerLocation adds the location code to the locations table if it
+// hasn't been seen before. Failures are logged but don't stop
+// reconciliation, since the table only holds display metadata. It runs in
+// a savepoint, so a failure doesn't abort the transaction of the date.
+func (s *Syncer) registerLocation(ctx context.Context, locationCode, category string) {
+	if locationCode == "" {
+		return
+	}
+	var categoryPtr *string
+	if category != "" {
+		categoryPtr = &category
+	}
+	var created bool
+	err := s.dbRepo.InTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = s.dbRepo.RegisterLocation(ctx, locationCode, categoryPtr)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error registering location %s: %v", locationCode, err)
+	} else if created {
+		log.Printf("Registered new location %s.", locationCode)
+	}
+}
+
+// recordRejectedTitle records a title rejected by strict validation. Like
+// registerLocation, it is best-effort: the record is only informational.
+func (s *Syncer) recordRejectedTitle(ctx context.Context, rejected database.RejectedTitle) {
+	err := s.dbRepo.InTransaction(ctx, func(ctx context.Context) error {
+		return s.dbRepo.InsertRejectedTitle(ctx, rejected)
+	})
+	if err != nil {
+		log.Printf("Error recording rejected title for %s: %v", rejected.Date.Format("2006-01-02"), err)
+	}
+}
+
+// recordReportedConflict records that the conflict between the given
+// events has been reported for a date. Like registerLocation, it is
+// best-effort: if it fails, the conflict is only reported again.
+func (s *Syncer) recordReportedConflict(ctx context.Context, date time.Time, eventIDs string) {
+	err := s.dbRepo.InTransaction(ctx, func(ctx context.Context) error {
+		return s.dbRepo.SetReportedConflict(ctx, date, eventIDs)
+	})
+	if err != nil {
+		log.Printf("Error recording reported conflict for %s: %v", date.Format("2006-01-02"), err)
+	}
+}
+
+// statsAttributes returns the stats category and working day flag which
+// should be stored in schedule_entries for the given status.
+func (s *Syncer) statsAttributes(status calendar.LocationStatus) (category string, isWorkingDay bool) {
+	locationType := s.catalog.LocationType(status)
+	if locationType == nil && status == calendar.StatusNonWorking {
+		return "Non-working", false
+	}
+	if locationType == nil {
+		// Unknown locations are still counted as working days, as before
+		// location types were configurable.
+		return "", true
+	}
+	return locationType.Category, locationType.WorkingDay
+}
+
+// segmentsForDay returns the schedule_entry_segments rows which represent
+// the given day.
+func (s *Syncer) segmentsForDay(date time.Time, day calendar.DayLocation) []database.ScheduleEntrySegment {
+	segments := make([]database.ScheduleEntrySegment, 0, 2)
+	for _, daySegment := range day.Segments() {
+		category, isWorkingDay := s.statsAttributes(daySegment.Status)
+		segment := database.ScheduleEntrySegment{
+			Date:         date,
+			Half:         string(daySegment.Half),
+			LocationCode: daySegment.LocationCode,
+			Status:       string(daySegment.Status),
+			IsWorkingDay: isWorkingDay,
+		}
+		if category != "" {
+			segment.Category = &category
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// segmentsEqual returns whether two lists of segments (ordered by half)
+// hold the same values.
+func segmentsEqual(a, b []database.ScheduleEntrySegment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Half != b[i].Half ||
+			a[i].LocationCode != b[i].LocationCode ||
+			a[i].Status != b[i].Status ||
+			derefString(a[i].Category) != derefString(b[i].Category) ||
+			a[i].IsWorkingDay != b[i].IsWorkingDay {
+			return false
+		}
+	}
+	return true
+}
+
 // Helper to merge patch objects, prioritizing non-nil fields from patch2
 func mergeEventPatches(patch1, patch2 *gcal.Event) *gcal.Event {
 	if patch1 == nil {
@@ -280,6 +735,12 @@ func mergeEventPatches(patch1, patch2 *gcal.Event) *gcal.Event {
 		patch1.ForceSendFields = appendIfMissing(patch1.ForceSendFields, "ColorId")
 	}
 
+	// Merge Summary
+	if patch2.Summary != "" || contains(patch2.ForceSendFields, "Summary") {
+		patch1.Summary = patch2.Summary
+		patch1.ForceSendFields = appendIfMissing(patch1.ForceSendFields, "Summary")
+	}
+
 	// Merge Description
 	descNeedsUpdate := false
 	// Check if Description is explicitly set in patch2 (even if empty string)
@@ -343,7 +804,8 @@ func appendIfMissing(slice []string, item string) []string {
 
 // Helper to check for 404/410 errors which might be acceptable when deleting
 func isNotFoundError(err error) bool {
-	if gErr, ok := err.(*googleapi.Error); ok {
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
 		return gErr.Code == http.StatusNotFound || gErr.Code == http.StatusGone
 	}
 	return false
@@ -0,0 +1,365 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/ics"
+
+	gcal "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// materializeRecurringEvents replaces the instances of managed recurring
+// events with a recognized title (e.g. a weekly library day) with one
+// standalone managed single-day event per covered date, and removes them
+// from the recurring event (see endSeries), so later changes to the series
+// can't override the days. Only the dates from the start of the sync window
+// until the end of the future horizon are materialized (see
+// materializationRange).
+//
+// It returns the list of events with the instances replaced by the created
+// events and cancelled ones (so they are removed from the cache), and
+// notes describing the conversions for the confirmation email.
+func (s *Syncer) materializeRecurringEvents(ctx context.Context, events []*gcal.Event) ([]*gcal.Event, []string) {
+	if s.readOnly {
+		// Read-only calendars can't be changed, so the instances are used
+		// as they are.
+		return events, nil
+	}
+
+	seriesIDs, titles := s.materializableSeries(events, nil, nil)
+	instances := make(map[string][]*gcal.Event)
+	for _, event := range events {
+		if _, ok := titles[event.RecurringEventId]; ok {
+			instances[event.RecurringEventId] = append(instances[event.RecurringEventId], event)
+		}
+	}
+
+	first, last := s.materializationRange()
+	replacements := make(map[string][]*gcal.Event)
+	var notes []string
+	for _, seriesID := range seriesIDs {
+		received := instances[seriesID]
+		all, err := s.seriesInstances(ctx, seriesID, received, first, last)
+		if err != nil {
+			replacements[seriesID] = received
+			log.Printf("Error materializing recurring event %s: %v. The recurring event will be kept.", seriesID, err)
+			continue
+		}
+		replacement, note, err := s.materializeSeries(ctx, seriesID, titles[seriesID], received, all)
+		replacements[seriesID] = replacement
+		if err != nil {
+			log.Printf("Error materializing recurring event %s: %v. The recurring event will be kept.", seriesID, err)
+			continue
+		}
+		notes = append(notes, note)
+	}
+
+	result := make([]*gcal.Event, 0, len(events))
+	added := make(map[string]bool)
+	for _, event := range events {
+		replacement, ok := replacements[event.RecurringEventId]
+		if !ok {
+			result = append(result, event)
+			continue
+		}
+		if !added[event.RecurringEventId] {
+			result = append(result, replacement...)
+			added[event.RecurringEventId] = true
+		}
+	}
+	return result, notes
+}
+
+// materializeListedSeries materializes the given recurring events (see
+// materializeRecurringEvents) from the instances collected by
+// collectMaterializableInstances. It is used by full syncs once all the
+// instances have been listed, since they can be spread over several pages.
+// It returns the created events and cancelled copies of the instances, and
+// the notes for the email.
+func (s *Syncer) materializeListedSeries(ctx context.Context, seriesIDs []string, titles map[string]string, instances map[string][]*gcal.Event) ([]*gcal.Event, []string) {
+	var events []*gcal.Event
+	var notes []string
+	for _, seriesID := range seriesIDs {
+		all := instances[seriesID]
+		sort.SliceStable(all, func(i, j int) bool {
+			return instanceStart(all[i]) < instanceStart(all[j])
+		})
+		replacement, note, err := s.materializeSeries(ctx, seriesID, titles[seriesID], all, all)
+		events = append(events, replacement...)
+		if err != nil {
+			log.Printf("Error materializing recurring event %s: %v. The recurring event will be kept.", seriesID, err)
+			continue
+		}
+		notes = append(notes, note)
+	}
+	return events, notes
+}
+
+// collectMaterializableInstances adds to instances (by recurring event ID)
+// the instances of all-day recurring events from the start of the
+// materialization range on, which are the ones replaced if their recurring
+// event is materialized.
+func (s *Syncer) collectMaterializableInstances(events []*gcal.Event, instances map[string][]*gcal.Event) {
+	first, _ := s.materializationRange()
+	for _, event := range events {
+		if event.RecurringEventId != "" && event.Start != nil && event.Start.Date >= first.Format("2006-01-02") {
+			instances[event.RecurringEventId] = append(instances[event.RecurringEventId], event)
+		}
+	}
+}
+
+// materializableSeries adds to seriesIDs and titles (in order of
+// appearance) the recurring events of the given instances which should be
+// materialized: those which are managed (or tagged) and have a recognized
+// title (which is the one stored in titles) and an instance in the
+// materialization range.
+func (s *Syncer) materializableSeries(events []*gcal.Event, seriesIDs []string, titles map[string]string) ([]string, map[string]string) {
+	if titles == nil {
+		titles = make(map[string]string)
+	}
+	first, last := s.materializationRange()
+	firstStr, lastStr := first.Format("2006-01-02"), last.Format("2006-01-02")
+	for _, instance := range events {
+		if instance.RecurringEventId == "" || instance.Status == "cancelled" || instance.Start == nil || instance.Start.Date == "" {
+			continue
+		}
+		if instance.Start.Date < firstStr || instance.Start.Date > lastStr {
+			continue
+		}
+		if _, ok := titles[instance.RecurringEventId]; ok {
+			continue
+		}
+		if !calendar.HasManagedProperty(instance) && !calendar.HasDescriptionTag(instance) {
+			continue
+		}
+		title := s.catalog.CanonicalTitle(instance.Summary)
+		if s.catalog.ParseDayLocation(title).IsKnown() {
+			seriesIDs = append(seriesIDs, instance.RecurringEventId)
+			titles[instance.RecurringEventId] = title
+		}
+	}
+	return seriesIDs, titles
+}
+
+// materializationRange returns the first and last dates whose occurrences
+// of recurring events are materialized: from the start of the sync window
+// until the end of the future horizon.
+func (s *Syncer) materializationRange() (time.Time, time.Time) {
+	today := s.today()
+	return today.AddDate(0, 0, -s.cfg.App.PastSyncWindowDays), today.AddDate(0, 0, s.cfg.App.FutureHorizonDays)
+}
+
+// materializeSeries creates a standalone event for each date in the
+// materialization range covered by all the instances of a recurring event
+// (sorted by date), and removes them from the recurring event. It returns the created events
+// followed by the instances before the range (which are kept) and
+// cancelled copies of the other instances, and the note for the email. If
+// it fails, the recurring event is kept and the events created until then
+// are returned together with the received instances (the ones listed from
+// the calendar, which can be fewer than all of them); since the created
+// events have deterministic IDs, a later sync can materialize the series
+// again without duplicating them.
+func (s *Syncer) materializeSeries(ctx context.Context, seriesID, title string, received, all []*gcal.Event) ([]*gcal.Event, string, error) {
+	first, last := s.materializationRange()
+
+	log.Printf("Materializing recurring event %s (%s) into daily events...", seriesID, title)
+	var created, replaced, kept []*gcal.Event
+	for _, instance := range all {
+		if instanceStart(instance) < first.Format("2006-01-02") {
+			kept = append(kept, instance)
+			continue
+		}
+		replaced = append(replaced, instance)
+		if instance.Status == "cancelled" {
+			continue
+		}
+		instanceTitle := s.catalog.CanonicalTitle(instance.Summary)
+		colorID := s.catalog.DayColorID(s.catalog.ParseDayLocation(instanceTitle))
+		var dates []time.Time
+		for _, date := range instanceDates(instance) {
+			if !date.Before(first) && !date.After(last) {
+				dates = append(dates, date)
+			}
+		}
+		events, err := s.createDailyEvents(ctx, instance, instanceTitle, colorID, dates)
+		created = append(created, events...)
+		if err != nil {
+			return append(created, received...), "", err
+		}
+	}
+
+	seriesDate := first
+	if len(created) > 0 {
+		seriesDate, _ = time.Parse("2006-01-02", created[0].Start.Date)
+	}
+	keptPast, droppedFuture, err := s.endSeries(ctx, seriesID, first, last, seriesDate, fmt.Sprintf("recurring event converted into %d daily events", len(created)))
+	if err != nil {
+		return append(created, received...), "", err
+	}
+
+	note := fmt.Sprintf("The recurring %s event has been converted into %d daily events.", title, len(created))
+	if len(created) > 0 {
+		note = fmt.Sprintf("The recurring %s event has been converted into %d daily events (%s → %s).", title, len(created),
+			created[0].Start.Date, created[len(created)-1].Start.Date)
+	}
+	if keptPast {
+		note += fmt.Sprintf(" Its occurrences before %s have been kept in the series, which now ends on %s.",
+			first.Format("2006-01-02"), first.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	if droppedFuture {
+		note += fmt.Sprintf(" Its occurrences after %s have been removed, since days are only planned %d days ahead: please add them again later.",
+			last.Format("2006-01-02"), s.cfg.App.FutureHorizonDays)
+	}
+	result := append(created, kept...)
+	return append(result, cancelledCopies(replaced)...), note, nil
+}
+
+// endSeries removes the occurrences of a recurring event from first on. If
+// the recurring event starts before first, its recurrence is ended the day
+// before (with UNTIL) so the past occurrences are kept, and keptPast is
+// true. Otherwise, the recurring event is deleted. droppedFuture is true
+// if the recurring event had occurrences after last, which aren't
+// materialized.
+func (s *Syncer) endSeries(ctx context.Context, seriesID string, first, last, date time.Time, reason string) (keptPast, droppedFuture bool, err error) {
+	master, err := s.calendarService.GetEvent(ctx, seriesID)
+	if isNotFoundError(err) || (err == nil && master.Status == "cancelled") {
+		log.Printf("Recurring event %s was already deleted.", seriesID)
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to fetch recurring event %s: %w", seriesID, err)
+	}
+	droppedFuture = occursAfter(master, last)
+
+	if instanceStart(master) >= first.Format("2006-01-02") {
+		err := s.deleteEvent(ctx, seriesID, date, reason)
+		if err != nil && !googleapi.IsNotModified(err) && !isNotFoundError(err) {
+			return false, false, fmt.Errorf("failed to delete recurring event %s: %w", seriesID, err)
+		}
+		log.Printf("Deleted recurring event %s after materializing it.", seriesID)
+		return false, droppedFuture, nil
+	}
+
+	until := first.AddDate(0, 0, -1)
+	patch := &gcal.Event{Recurrence: recurrenceUntil(master.Recurrence, until)}
+	if _, err := s.calendarService.PatchEvent(ctx, seriesID, patch); err != nil {
+		return false, false, fmt.Errorf("failed to end recurring event %s on %s: %w", seriesID, until.Format("2006-01-02"), err)
+	}
+	log.Printf("Ended recurring event %s on %s after materializing it, keeping its past occurrences.", seriesID, until.Format("2006-01-02"))
+	return true, droppedFuture, nil
+}
+
+// occursAfter returns whether a recurring event has occurrences after the
+// given date. Rules which can't be expanded are assumed to have them.
+func occursAfter(master *gcal.Event, date time.Time) bool {
+	start, err := time.Parse("2006-01-02", instanceStart(master))
+	if err != nil {
+		return true
+	}
+	for _, line := range master.Recurrence {
+		rule, isRule := strings.CutPrefix(line, "RRULE:")
+		if !isRule {
+			continue
+		}
+		dates, err := ics.ExpandDates(rule, start, date.AddDate(0, 0, 1))
+		if err != nil || (len(dates) > 0 && dates[len(dates)-1].After(date)) {
+			return true
+		}
+	}
+	return false
+}
+
+// recurrenceUntil returns the recurrence with its rules ending on the given
+// date (replacing their COUNT or UNTIL, if any).
+func recurrenceUntil(recurrence []string, until time.Time) []string {
+	result := make([]string, 0, len(recurrence))
+	for _, line := range recurrence {
+		rule, isRule := strings.CutPrefix(line, "RRULE:")
+		if !isRule {
+			result = append(result, line)
+			continue
+		}
+		var parts []string
+		for _, part := range strings.Split(rule, ";") {
+			if !strings.HasPrefix(part, "UNTIL=") && !strings.HasPrefix(part, "COUNT=") {
+				parts = append(parts, part)
+			}
+		}
+		parts = append(parts, "UNTIL="+until.Format("20060102"))
+		result = append(result, "RRULE:"+strings.Join(parts, ";"))
+	}
+	return result
+}
+
+// seriesInstances returns the received instances of a recurring event,
+// together with the cached ones from first to last which weren't received,
+// sorted by date.
+func (s *Syncer) seriesInstances(ctx context.Context, seriesID string, received []*gcal.Event, first, last time.Time) ([]*gcal.Event, error) {
+	all := append([]*gcal.Event{}, received...)
+	receivedIDs := make(map[string]bool)
+	for _, instance := range received {
+		receivedIDs[instance.Id] = true
+	}
+
+	cachedEvents, err := s.dbRepo.GetCachedEventsInRange(ctx, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cached instances: %w", err)
+	}
+	for _, cached := range cachedEvents {
+		if derefString(cached.RecurringEventID) != seriesID || receivedIDs[cached.EventID] {
+			continue
+		}
+		dateStr := cached.Date.Format("2006-01-02")
+		all = append(all, &gcal.Event{
+			Id:               cached.EventID,
+			Summary:          derefString(cached.Title),
+			Description:      derefString(cached.Description),
+			Start:            &gcal.EventDateTime{Date: dateStr},
+			End:              &gcal.EventDateTime{Date: cached.Date.AddDate(0, 0, 1).Format("2006-01-02")},
+			RecurringEventId: seriesID,
+		})
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return instanceStart(all[i]) < instanceStart(all[j])
+	})
+	return all, nil
+}
+
+// instanceDates returns the dates covered by an all-day event.
+func instanceDates(event *gcal.Event) []time.Time {
+	if first, last, ok := calendar.MultiDayRange(event); ok {
+		return generateDateRange(first, last)
+	}
+	if event.Start == nil || event.Start.Date == "" {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", event.Start.Date)
+	if err != nil {
+		return nil
+	}
+	return []time.Time{date}
+}
+
+func instanceStart(event *gcal.Event) string {
+	if event.Start == nil {
+		return ""
+	}
+	return event.Start.Date
+}
+
+// cancelledCopies returns a cancelled event with the ID of each event.
+func cancelledCopies(events []*gcal.Event) []*gcal.Event {
+	cancelled := make([]*gcal.Event, 0, len(events))
+	for _, event := range events {
+		cancelled = append(cancelled, &gcal.Event{Id: event.Id, RecurringEventId: event.RecurringEventId, Status: "cancelled"})
+	}
+	return cancelled
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// syncRun identifies a run of a sync or a task, which is recorded together
+// with the changes it makes (deleted events, schedule history).
+type syncRun struct {
+	id string
+	// What started the run (one of the database.Trigger* constants).
+	trigger string
+}
+
+// syncRunKey is the context key of the current sync run.
+type syncRunKey struct{}
+
+// withSyncRun returns a context with a new sync run started by trigger,
+// unless ctx already has one.
+func withSyncRun(ctx context.Context, trigger string) context.Context {
+	if _, ok := ctx.Value(syncRunKey{}).(syncRun); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, syncRunKey{}, syncRun{id: uuid.New().String(), trigger: trigger})
+}
+
+// syncRunID returns the ID of the sync run of ctx, or "" if it doesn't
+// have one.
+func syncRunID(ctx context.Context) string {
+	run, _ := ctx.Value(syncRunKey{}).(syncRun)
+	return run.id
+}
+
+// syncTrigger returns what started the sync run of ctx, or "" if it
+// doesn't have one.
+func syncTrigger(ctx context.Context) string {
+	run, _ := ctx.Value(syncRunKey{}).(syncRun)
+	return run.trigger
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// Store is the persistence used by the Syncer. It is implemented by
+// *database.Repository.
+type Store interface {
+	// InTransaction runs fn in a transaction, which includes the calls
+	// made with the context passed to fn. Nested calls run in a savepoint:
+	// if they fail, only their changes are rolled back.
+	InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// Sync state
+	GetSyncState(ctx context.Context, key string) (string, error)
+	SetSyncState(ctx context.Context, key, value string) error
+
+	// Calendar event cache
+	UpsertCachedEvent(ctx context.Context, event database.CachedEvent) error
+	DeleteCachedEvent(ctx context.Context, eventID string) error
+	GetAllCachedEvents(ctx context.Context) ([]database.CachedEvent, error)
+	GetCachedEventsInRange(ctx context.Context, from, to time.Time) ([]database.CachedEvent, error)
+	GetCachedEventsByDate(ctx context.Context, date time.Time) ([]database.CachedEvent, error)
+	GetCachedEventByID(ctx context.Context, eventID string) (*database.CachedEvent, error)
+
+	// Schedule
+	UpsertScheduleEntry(ctx context.Context, entry database.ScheduleEntry) error
+	GetScheduleEntry(ctx context.Context, date time.Time) (*database.ScheduleEntry, error)
+	ReplaceScheduleEntrySegments(ctx context.Context, date time.Time, segments []database.ScheduleEntrySegment) error
+	GetScheduleEntrySegments(ctx context.Context, date time.Time) ([]database.ScheduleEntrySegment, error)
+
+	// Schedule history
+	InsertScheduleEntryChange(ctx context.Context, change database.ScheduleEntryChange) error
+	GetScheduleEntryHistory(ctx context.Context, from, to time.Time) ([]database.ScheduleEntryChange, error)
+
+	// Reference data
+	RegisterLocation(ctx context.Context, code string, category *string) (bool, error)
+	GetHoliday(ctx context.Context, date time.Time) (*database.Holiday, error)
+	InsertRejectedTitle(ctx context.Context, rejected database.RejectedTitle) error
+	HasRejectedTitle(ctx context.Context, date time.Time, eventID, title string) (bool, error)
+	GetReportedConflict(ctx context.Context, date time.Time) (string, error)
+	SetReportedConflict(ctx context.Context, date time.Time, eventIDs string) error
+
+	// Deleted events
+	InsertDeletedEvent(ctx context.Context, deleted database.DeletedEvent) error
+	GetDeletedEvent(ctx context.Context, id int64) (*database.DeletedEvent, error)
+	MarkDeletedEventRestored(ctx context.Context, id int64, restoredEventID string) error
+
+	// Calendar outbox
+	EnqueueOutboxItem(ctx context.Context, item database.OutboxItem) error
+	GetDueOutboxItems(ctx context.Context, now time.Time, limit int) ([]database.OutboxItem, error)
+	MarkOutboxItemDone(ctx context.Context, id int64) error
+	MarkOutboxItemFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	MarkOutboxItemDead(ctx context.Context, id int64, lastError string) error
+
+	// Sync jobs
+	EnqueueSyncJob(ctx context.Context, job database.SyncJob) error
+	ClaimDueSyncJob(ctx context.Context, now time.Time) (*database.SyncJob, error)
+	RequeueInterruptedSyncJobs(ctx context.Context, now time.Time) (int64, error)
+	MarkSyncJobDone(ctx context.Context, id int64) error
+	MarkSyncJobFailed(ctx context.Context, id int64, lastError string, nextRunAt time.Time) error
+	MarkSyncJobDead(ctx context.Context, id int64, lastError string) error
+}
+
+var _ Store = (*database.Repository)(nil)
@@ -0,0 +1,581 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	stdsync "sync"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+)
+
+// memoryStore is an in-memory Store used by the tests.
+type memoryStore struct {
+	mu             stdsync.Mutex
+	syncState      map[string]string
+	cachedEvents   map[string]database.CachedEvent
+	entries        map[string]database.ScheduleEntry
+	segments       map[string][]database.ScheduleEntrySegment
+	locations      map[string]*string
+	holidays       map[string]database.Holiday
+	rejectedTitles []database.RejectedTitle
+	conflicts      map[string]string
+	outbox         []database.OutboxItem
+	deletedEvents  []database.DeletedEvent
+	history        []database.ScheduleEntryChange
+	syncJobs       []database.SyncJob
+	// Error returned by EnqueueOutboxItem, if set.
+	enqueueErr error
+	// Error returned by UpsertCachedEvent, if set.
+	upsertCachedEventErr error
+	// Error returned by RegisterLocation, if set.
+	registerLocationErr error
+	// Number of transactions which were rolled back.
+	rollbacks int
+}
+
+var _ Store = (*memoryStore)(nil)
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		syncState:    make(map[string]string),
+		cachedEvents: make(map[string]database.CachedEvent),
+		entries:      make(map[string]database.ScheduleEntry),
+		segments:     make(map[string][]database.ScheduleEntrySegment),
+		locations:    make(map[string]*string),
+		holidays:     make(map[string]database.Holiday),
+		conflicts:    make(map[string]string),
+	}
+}
+
+// InTransaction restores the previous state of the store if fn fails.
+// Like in PostgreSQL, once a write fails the following ones fail too until
+// the transaction (or the savepoint, for nested calls) is rolled back.
+// Transactions aren't isolated from concurrent calls, which the tests
+// don't make.
+func (m *memoryStore) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	if err := checkMemoryTx(ctx); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	snapshot := m.clone()
+	m.mu.Unlock()
+
+	parent, _ := ctx.Value(memoryTxKey{}).(*memoryTx)
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, &memoryTx{parent: parent})); err != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.restore(snapshot)
+		m.rollbacks++
+		return err
+	}
+	return nil
+}
+
+// memoryTx is a transaction (or savepoint) of the memoryStore.
+type memoryTx struct {
+	parent *memoryTx
+	// Whether a write failed, so the transaction can only be rolled back.
+	aborted bool
+}
+
+type memoryTxKey struct{}
+
+// checkMemoryTx returns an error if the transaction of the context, or
+// one which contains it, was aborted.
+func checkMemoryTx(ctx context.Context) error {
+	for tx, _ := ctx.Value(memoryTxKey{}).(*memoryTx); tx != nil; tx = tx.parent {
+		if tx.aborted {
+			return fmt.Errorf("current transaction is aborted, commands ignored until end of transaction block")
+		}
+	}
+	return nil
+}
+
+// write returns the error of a write made with the context: the injected
+// error, which aborts the transaction, or the one of an aborted
+// transaction. Must be called with m.mu held.
+func (m *memoryStore) write(ctx context.Context, injected error) error {
+	if err := checkMemoryTx(ctx); err != nil {
+		return err
+	}
+	if injected != nil {
+		if tx, ok := ctx.Value(memoryTxKey{}).(*memoryTx); ok {
+			tx.aborted = true
+		}
+		return injected
+	}
+	return nil
+}
+
+// clone returns a copy of the state of the store. Must be called with
+// m.mu held.
+func (m *memoryStore) clone() *memoryStore {
+	return &memoryStore{
+		syncState:      maps.Clone(m.syncState),
+		cachedEvents:   maps.Clone(m.cachedEvents),
+		entries:        maps.Clone(m.entries),
+		segments:       maps.Clone(m.segments),
+		locations:      maps.Clone(m.locations),
+		holidays:       maps.Clone(m.holidays),
+		rejectedTitles: append([]database.RejectedTitle{}, m.rejectedTitles...),
+		conflicts:      maps.Clone(m.conflicts),
+		outbox:         append([]database.OutboxItem{}, m.outbox...),
+		deletedEvents:  append([]database.DeletedEvent{}, m.deletedEvents...),
+		history:        append([]database.ScheduleEntryChange{}, m.history...),
+		syncJobs:       append([]database.SyncJob{}, m.syncJobs...),
+	}
+}
+
+// restore replaces the state of the store with a copy made by clone. Must
+// be called with m.mu held.
+func (m *memoryStore) restore(snapshot *memoryStore) {
+	m.syncState = snapshot.syncState
+	m.cachedEvents = snapshot.cachedEvents
+	m.entries = snapshot.entries
+	m.segments = snapshot.segments
+	m.locations = snapshot.locations
+	m.holidays = snapshot.holidays
+	m.rejectedTitles = snapshot.rejectedTitles
+	m.conflicts = snapshot.conflicts
+	m.outbox = snapshot.outbox
+	m.deletedEvents = snapshot.deletedEvents
+	m.history = snapshot.history
+	m.syncJobs = snapshot.syncJobs
+}
+
+func (m *memoryStore) GetSyncState(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.syncState[key]
+	if !ok {
+		return "", fmt.Errorf("sync state key '%s' not found", key)
+	}
+	return value, nil
+}
+
+func (m *memoryStore) SetSyncState(ctx context.Context, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncState[key] = value
+	return nil
+}
+
+func (m *memoryStore) UpsertCachedEvent(ctx context.Context, event database.CachedEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, m.upsertCachedEventErr); err != nil {
+		return err
+	}
+	event.Date = normalizeTestDate(event.Date)
+	m.cachedEvents[event.EventID] = event
+	return nil
+}
+
+func (m *memoryStore) DeleteCachedEvent(ctx context.Context, eventID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	delete(m.cachedEvents, eventID)
+	return nil
+}
+
+func (m *memoryStore) GetAllCachedEvents(ctx context.Context) ([]database.CachedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []database.CachedEvent{}
+	for _, event := range m.cachedEvents {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].EventID < events[j].EventID })
+	return events, nil
+}
+
+func (m *memoryStore) GetCachedEventsInRange(ctx context.Context, from, to time.Time) ([]database.CachedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []database.CachedEvent{}
+	for _, event := range m.cachedEvents {
+		if key := dateKey(event.Date); key >= dateKey(from) && key <= dateKey(to) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].EventID < events[j].EventID })
+	return events, nil
+}
+
+func (m *memoryStore) GetCachedEventsByDate(ctx context.Context, date time.Time) ([]database.CachedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []database.CachedEvent{}
+	for _, event := range m.cachedEvents {
+		if dateKey(event.Date) == dateKey(date) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[j].UpdatedTs.Before(events[i].UpdatedTs)
+	})
+	return events, nil
+}
+
+func (m *memoryStore) GetCachedEventByID(ctx context.Context, eventID string) (*database.CachedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event, ok := m.cachedEvents[eventID]
+	if !ok {
+		return nil, nil
+	}
+	return &event, nil
+}
+
+func (m *memoryStore) UpsertScheduleEntry(ctx context.Context, entry database.ScheduleEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	entry.Date = normalizeTestDate(entry.Date)
+	entry.Tags = maps.Clone(entry.Tags)
+	if entry.Tags == nil {
+		entry.Tags = map[string]string{}
+	}
+	m.entries[dateKey(entry.Date)] = entry
+	return nil
+}
+
+func (m *memoryStore) GetScheduleEntry(ctx context.Context, date time.Time) (*database.ScheduleEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[dateKey(date)]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (m *memoryStore) ReplaceScheduleEntrySegments(ctx context.Context, date time.Time, segments []database.ScheduleEntrySegment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	stored := make([]database.ScheduleEntrySegment, len(segments))
+	for i, segment := range segments {
+		segment.Date = normalizeTestDate(date)
+		stored[i] = segment
+	}
+	m.segments[dateKey(date)] = stored
+	return nil
+}
+
+func (m *memoryStore) GetScheduleEntrySegments(ctx context.Context, date time.Time) ([]database.ScheduleEntrySegment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]database.ScheduleEntrySegment{}, m.segments[dateKey(date)]...), nil
+}
+
+func (m *memoryStore) RegisterLocation(ctx context.Context, code string, category *string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, m.registerLocationErr); err != nil {
+		return false, err
+	}
+	if _, exists := m.locations[code]; exists {
+		return false, nil
+	}
+	m.locations[code] = category
+	return true, nil
+}
+
+func (m *memoryStore) GetHoliday(ctx context.Context, date time.Time) (*database.Holiday, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	holiday, ok := m.holidays[dateKey(date)]
+	if !ok {
+		return nil, nil
+	}
+	return &holiday, nil
+}
+
+func (m *memoryStore) InsertRejectedTitle(ctx context.Context, rejected database.RejectedTitle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	rejected.ID = int64(len(m.rejectedTitles) + 1)
+	rejected.Date = normalizeTestDate(rejected.Date)
+	m.rejectedTitles = append(m.rejectedTitles, rejected)
+	return nil
+}
+
+func (m *memoryStore) HasRejectedTitle(ctx context.Context, date time.Time, eventID, title string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rejected := range m.rejectedTitles {
+		if dateKey(rejected.Date) == dateKey(date) && rejected.EventID == eventID && rejected.Title == title {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) GetReportedConflict(ctx context.Context, date time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conflicts[dateKey(date)], nil
+}
+
+func (m *memoryStore) SetReportedConflict(ctx context.Context, date time.Time, eventIDs string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	m.conflicts[dateKey(date)] = eventIDs
+	return nil
+}
+
+func (m *memoryStore) InsertScheduleEntryChange(ctx context.Context, change database.ScheduleEntryChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, nil); err != nil {
+		return err
+	}
+	change.ID = int64(len(m.history) + 1)
+	change.Date = normalizeTestDate(change.Date)
+	change.ChangedAt = time.Now()
+	m.history = append(m.history, change)
+	return nil
+}
+
+func (m *memoryStore) GetScheduleEntryHistory(ctx context.Context, from, to time.Time) ([]database.ScheduleEntryChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes := []database.ScheduleEntryChange{}
+	for _, change := range m.history {
+		if !change.Date.Before(normalizeTestDate(from)) && !change.Date.After(normalizeTestDate(to)) {
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Date.Before(changes[j].Date)
+	})
+	return changes, nil
+}
+
+func (m *memoryStore) InsertDeletedEvent(ctx context.Context, deleted database.DeletedEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted.Date = normalizeTestDate(deleted.Date)
+	deleted.DeletedAt = time.Now()
+	for i, existing := range m.deletedEvents {
+		if existing.SyncRunID == deleted.SyncRunID && existing.EventID == deleted.EventID {
+			deleted.ID = existing.ID
+			m.deletedEvents[i] = deleted
+			return nil
+		}
+	}
+	deleted.ID = int64(len(m.deletedEvents) + 1)
+	m.deletedEvents = append(m.deletedEvents, deleted)
+	return nil
+}
+
+func (m *memoryStore) GetDeletedEvent(ctx context.Context, id int64) (*database.DeletedEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || int(id) > len(m.deletedEvents) {
+		return nil, nil
+	}
+	deleted := m.deletedEvents[id-1]
+	return &deleted, nil
+}
+
+func (m *memoryStore) MarkDeletedEventRestored(ctx context.Context, id int64, restoredEventID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	restoredAt := time.Now()
+	m.deletedEvents[id-1].RestoredAt = &restoredAt
+	m.deletedEvents[id-1].RestoredEventID = &restoredEventID
+	return nil
+}
+
+// deleted returns the snapshots of the deleted events.
+func (m *memoryStore) deleted() []database.DeletedEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]database.DeletedEvent{}, m.deletedEvents...)
+}
+
+func (m *memoryStore) EnqueueOutboxItem(ctx context.Context, item database.OutboxItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(ctx, m.enqueueErr); err != nil {
+		return err
+	}
+	for _, existing := range m.outbox {
+		if existing.Status() == database.OutboxPending && existing.IdempotencyKey == item.IdempotencyKey {
+			return nil
+		}
+	}
+	item.ID = int64(len(m.outbox) + 1)
+	item.Date = normalizeTestDate(item.Date)
+	item.NextAttemptAt = time.Time{}
+	m.outbox = append(m.outbox, item)
+	return nil
+}
+
+func (m *memoryStore) GetDueOutboxItems(ctx context.Context, now time.Time, limit int) ([]database.OutboxItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	items := []database.OutboxItem{}
+	for _, item := range m.outbox {
+		if item.Status() == database.OutboxPending && !item.NextAttemptAt.After(now) && len(items) < limit {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *memoryStore) MarkOutboxItemDone(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doneAt := time.Now()
+	m.outbox[id-1].DoneAt = &doneAt
+	return nil
+}
+
+func (m *memoryStore) MarkOutboxItemFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outbox[id-1].Attempts++
+	m.outbox[id-1].LastError = &lastError
+	m.outbox[id-1].NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (m *memoryStore) MarkOutboxItemDead(ctx context.Context, id int64, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deadAt := time.Now()
+	m.outbox[id-1].Attempts++
+	m.outbox[id-1].LastError = &lastError
+	m.outbox[id-1].DeadAt = &deadAt
+	return nil
+}
+
+func (m *memoryStore) EnqueueSyncJob(ctx context.Context, job database.SyncJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.syncJobs {
+		if existing.Status == database.SyncJobPending && existing.Attempts == 0 && existing.DedupKey() == job.DedupKey() {
+			return nil
+		}
+	}
+	job.ID = int64(len(m.syncJobs) + 1)
+	job.Status = database.SyncJobPending
+	job.Attempts = 0
+	job.NextRunAt = time.Time{}
+	m.syncJobs = append(m.syncJobs, job)
+	return nil
+}
+
+func (m *memoryStore) ClaimDueSyncJob(ctx context.Context, now time.Time) (*database.SyncJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.syncJobs {
+		if m.syncJobs[i].Status == database.SyncJobPending && !m.syncJobs[i].NextRunAt.After(now) {
+			m.syncJobs[i].Status = database.SyncJobRunning
+			job := m.syncJobs[i]
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) RequeueInterruptedSyncJobs(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for i := range m.syncJobs {
+		if m.syncJobs[i].Status == database.SyncJobRunning {
+			lastError := "interrupted before finishing"
+			m.syncJobs[i].Status = database.SyncJobPending
+			m.syncJobs[i].Attempts++
+			m.syncJobs[i].LastError = &lastError
+			m.syncJobs[i].NextRunAt = now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) MarkSyncJobDone(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncJobs[id-1].Status = database.SyncJobDone
+	return nil
+}
+
+func (m *memoryStore) MarkSyncJobFailed(ctx context.Context, id int64, lastError string, nextRunAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncJobs[id-1].Status = database.SyncJobPending
+	m.syncJobs[id-1].Attempts++
+	m.syncJobs[id-1].LastError = &lastError
+	m.syncJobs[id-1].NextRunAt = nextRunAt
+	return nil
+}
+
+func (m *memoryStore) MarkSyncJobDead(ctx context.Context, id int64, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncJobs[id-1].Status = database.SyncJobDead
+	m.syncJobs[id-1].Attempts++
+	m.syncJobs[id-1].LastError = &lastError
+	return nil
+}
+
+// jobs returns a copy of the sync jobs.
+func (m *memoryStore) jobs() []database.SyncJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]database.SyncJob{}, m.syncJobs...)
+}
+
+// pendingOutboxItems returns the outbox items which haven't been executed
+// nor given up.
+func (m *memoryStore) pendingOutboxItems() []database.OutboxItem {
+	return m.outboxItems(database.OutboxPending)
+}
+
+// outboxItems returns the outbox items with the given status.
+func (m *memoryStore) outboxItems(status string) []database.OutboxItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []database.OutboxItem
+	for _, item := range m.outbox {
+		if item.Status() == status {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// entry returns the schedule entry of a date (in the "2006-01-02" format).
+func (m *memoryStore) entry(date string) (database.ScheduleEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[date]
+	return entry, ok
+}
+
+func normalizeTestDate(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
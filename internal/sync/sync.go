@@ -9,6 +9,7 @@ import (
 	"gomodules.avm99963.com/zenithplanner/internal/calendar"
 	"gomodules.avm99963.com/zenithplanner/internal/config"
 	"gomodules.avm99963.com/zenithplanner/internal/database"
+	"gomodules.avm99963.com/zenithplanner/internal/email"
 
 	gcal "google.golang.org/api/calendar/v3"
 )
@@ -18,65 +19,72 @@ import (
 // code to a cache package with methods which interact with the DB,
 // calendar code should be moved to calendar, ...
 type Syncer struct {
-	dbRepo          *database.Repository
-	calendarService *gcal.Service
+	dbRepo          Store
+	calendarService calendar.CalendarProvider
 	cfg             *config.Config
-	colorMap        map[calendar.LocationStatus]string // Precomputed color map
-	// Mutex shared between sync and other tasks to perform work.
+	catalog         *calendar.Catalog
+	// Function which returns the current time (replaceable for testing).
+	now func() time.Time
+	// Sender of the confirmation emails, or nil if they are disabled.
+	notifier confirmationSender
+	// Whether the calendar can't be modified (e.g. an iCalendar feed). In
+	// this case, events with a known location are read even if they
+	// aren't managed, and defaults are only stored in the DB.
+	readOnly bool
+	// Policy which decides which event holds the location of a date with
+	// several schedule events.
+	conflictPolicy conflictPolicy
+	// Whether the events which lose a conflict are kept in the calendar
+	// (instead of being deleted).
+	keepConflictingEvents bool
+	// Mutex shared between sync and other tasks to perform work. It is
+	// taken together with the sync advisory lock (see lock), which
+	// extends it to the other instances.
 	mutex sync.Mutex
-	// Queue used to perform sync. At most 1 sync will be queued.
+	// Wakes up the sync worker when a sync job is queued. The jobs are
+	// stored in the DB (see RequestSync), so at most 1 wake-up is queued.
 	syncQueue chan struct{}
 }
 
 // NewSyncer creates a new Syncer instance.
-func NewSyncer(dbRepo *database.Repository, calendarService *gcal.Service, cfg *config.Config) *Syncer {
-	colorMap := map[calendar.LocationStatus]string{
-		calendar.StatusHome:     "3",  // Mauve/Grape
-		calendar.StatusVacation: "10", // Green/Basil
-		calendar.StatusOffice:   "5",  // Yellow/Banana
-		calendar.StatusLibrary:  "2",  // Pale Green/Sage
-		calendar.StatusUnknown:  "8",  // Gray
-	}
-
-	return &Syncer{
+func NewSyncer(dbRepo Store, calendarService calendar.CalendarProvider, cfg *config.Config, catalog *calendar.Catalog) *Syncer {
+	s := &Syncer{
 		dbRepo:          dbRepo,
 		calendarService: calendarService,
 		cfg:             cfg,
-		colorMap:        colorMap,
+		catalog:         catalog,
+		now:             time.Now,
+		readOnly:        cfg.IsReadOnly(),
 		syncQueue:       make(chan struct{}, 1),
 	}
+	s.conflictPolicy, s.keepConflictingEvents = newConflictPolicy(cfg.App.ConflictResolution, catalog)
+	if cfg.App.EnableEmailConfirmations {
+		s.notifier = email.NewClient(cfg.SMTP)
+	}
+	return s
 }
 
-// StartSyncWorker launches a background goroutine to process queued incremental syncs.
-func (s *Syncer) StartSyncWorker(ctx context.Context) {
-	log.Println("Starting sync worker goroutine...")
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Sync worker stopping due to context cancellation.")
-				return
-			case <-s.syncQueue:
-				s.mutex.Lock()
-				syncCtx := context.Background()
-				err := s.runSync(syncCtx)
-				if err != nil {
-					log.Printf("Error during worker-driven sync: %v", err)
-				}
-				s.mutex.Unlock()
-			}
-		}
-	}()
+// LoadCatalog loads the location catalog set in the app config and adds
+// the location codes which are configured separately: the non-working day
+// and holiday codes.
+func LoadCatalog(appCfg config.AppConfig) (*calendar.Catalog, error) {
+	c, err := calendar.LoadCatalog(appCfg.LocationCatalogFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AddReservedCode(appCfg.WorkingWeek.NonWorkingDayCode, calendar.StatusNonWorking, "Non-working"); err != nil {
+		return nil, fmt.Errorf("failed to add the non-working day code to the location catalog: %w", err)
+	}
+	if err := c.AddReservedCode(appCfg.Holidays.Code, calendar.StatusHoliday, "Holiday"); err != nil {
+		return nil, fmt.Errorf("failed to add the holiday code to the location catalog: %w", err)
+	}
+	return c, nil
 }
 
-// RequestIncrementalSync attempts to queue a sync.
-func (s *Syncer) RequestSync() {
-	select {
-	case s.syncQueue <- struct{}{}:
-		log.Println("Sync requested and queued.")
-	default:
-		log.Println("Sync requested but queue is full (sync likely already running or queued). Request ignored.")
-	}
+// confirmationSender sends the confirmation emails. It is implemented by
+// *email.Client.
+type confirmationSender interface {
+	SendConfirmation(changes map[string]string, notes []string) error
 }
 
 // runSync synchronizes location data between Google Calendar and the
@@ -88,18 +96,18 @@ func (s *Syncer) runSync(ctx context.Context) error {
 	syncToken, err := s.dbRepo.GetSyncState(ctx, "syncToken")
 	if err != nil {
 		log.Printf("No sync token found or error retrieving it: %v. Triggering full sync.", err)
-		return s.RunFullSync(ctx)
+		return s.fullSync(ctx)
 	}
 	if syncToken == "" {
 		log.Println("Empty sync token found. Triggering full sync.")
-		return s.RunFullSync(ctx)
+		return s.fullSync(ctx)
 	}
 
 	log.Println("Performing an incremental sync since syncToken is available...")
 	err, performFullSync := s.RunIncrementalSync(ctx, syncToken)
 	if err != nil && performFullSync {
 		log.Printf("Failed incremental sync: %v. Falling back to a full sync...", err)
-		return s.RunFullSync(ctx)
+		return s.fullSync(ctx)
 	}
 	return err
 }
@@ -174,41 +182,52 @@ func (s *Syncer) updateDBCache(ctx context.Context, changedEvents []*gcal.Event)
 			if err := s.dbRepo.DeleteCachedEvent(ctx, event.Id); err != nil {
 				return fmt.Errorf("failed to delete event %s from cache: %w", event.Id, err)
 			}
-		} else {
-			parsedInfo, _ := calendar.ParseEvent(event, s.colorMap)
-			if parsedInfo != nil {
-				cachedEvent := database.CachedEvent{
-					EventID:              parsedInfo.EventID,
-					Date:                 parsedInfo.Date,
-					Title:                &parsedInfo.LocationCode,
-					Description:          &parsedInfo.Description,
-					UpdatedTs:            parsedInfo.UpdatedTs,
-					IsManagedProperty:    calendar.HasManagedProperty(event),
-					IsManagedDescription: calendar.HasDescriptionTag(event),
-					ColorID:              &parsedInfo.ColorID,
-					RecurringEventID:     parsedInfo.RecurringEventID,
-					OriginalStartTime:    parsedInfo.OriginalStartTime,
-				}
-				if parsedInfo.LocationCode == "" {
-					cachedEvent.Title = nil
-				}
-				if parsedInfo.Description == "" {
-					cachedEvent.Description = nil
-				}
-				if parsedInfo.ColorID == "" {
-					cachedEvent.ColorID = nil
-				}
-
-				log.Printf("Upserting event %s into cache.", event.Id)
-				if err := s.dbRepo.UpsertCachedEvent(ctx, cachedEvent); err != nil {
-					return fmt.Errorf("failed to upsert event %s into cache: %w", event.Id, err)
-				}
+		} else if cachedEvent := s.cachedEventFromCalendar(event); cachedEvent != nil {
+			log.Printf("Upserting event %s into cache.", event.Id)
+			if err := s.dbRepo.UpsertCachedEvent(ctx, *cachedEvent); err != nil {
+				return fmt.Errorf("failed to upsert event %s into cache: %w", event.Id, err)
 			}
 		}
 	}
 	return nil
 }
 
+// cachedEventFromCalendar returns the cache row of a calendar event, or nil
+// if the event isn't cached (e.g. it isn't an all-day event).
+func (s *Syncer) cachedEventFromCalendar(event *gcal.Event) *database.CachedEvent {
+	parseEvent := calendar.ParseEvent
+	if s.readOnly {
+		parseEvent = calendar.ParseKnownEvent
+	}
+	parsedInfo, _ := parseEvent(event, s.catalog)
+	if parsedInfo == nil {
+		return nil
+	}
+	cachedEvent := &database.CachedEvent{
+		EventID:              parsedInfo.EventID,
+		Date:                 parsedInfo.Date,
+		Title:                &parsedInfo.LocationCode,
+		Description:          &parsedInfo.Description,
+		UpdatedTs:            parsedInfo.UpdatedTs,
+		IsManagedProperty:    calendar.HasManagedProperty(event),
+		IsManagedDescription: calendar.HasDescriptionTag(event),
+		ColorID:              &parsedInfo.ColorID,
+		RecurringEventID:     parsedInfo.RecurringEventID,
+		OriginalStartTime:    parsedInfo.OriginalStartTime,
+		AutoDefaultCode:      parsedInfo.AutoDefaultCode,
+	}
+	if parsedInfo.LocationCode == "" {
+		cachedEvent.Title = nil
+	}
+	if parsedInfo.Description == "" {
+		cachedEvent.Description = nil
+	}
+	if parsedInfo.ColorID == "" {
+		cachedEvent.ColorID = nil
+	}
+	return cachedEvent
+}
+
 // deleteRecurringEventIDsFromDBCache makes sure that the cache doesn't
 // contain the original event when we receive recurring events.
 func (s *Syncer) deleteRecurringEventIDsFromDBCache(ctx context.Context, changedEvents []*gcal.Event) error {
@@ -220,11 +239,11 @@ func (s *Syncer) deleteRecurringEventIDsFromDBCache(ctx context.Context, changed
 		}
 	}
 
-	log.Printf("Possibly deleting %d events which might have been promoted to recurring events.")
+	log.Printf("Possibly deleting %d events which might have been promoted to recurring events.", len(recurringEventIDs))
 	for id := range recurringEventIDs {
 		err := s.dbRepo.DeleteCachedEvent(ctx, id)
 		if err != nil {
-			return fmt.Errorf("failed to delete cached event which might have been promoted to recurring event: %v")
+			return fmt.Errorf("failed to delete cached event which might have been promoted to recurring event: %v", err)
 		}
 	}
 
@@ -0,0 +1,1448 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/calendar"
+	"gomodules.avm99963.com/zenithplanner/internal/calendar/calendartest"
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
+	gcal "google.golang.org/api/calendar/v3"
+)
+
+// testNow is a Monday. With the test config, the sync window spans from
+// 2025-03-09 to 2025-03-12.
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+var testWindow = []string{"2025-03-09", "2025-03-10", "2025-03-11", "2025-03-12"}
+
+// recordingNotifier records the confirmation emails instead of sending
+// them.
+type recordingNotifier struct {
+	changes map[string]string
+	notes   []string
+	sent    int
+}
+
+func (n *recordingNotifier) SendConfirmation(changes map[string]string, notes []string) error {
+	if n.changes == nil {
+		n.changes = make(map[string]string)
+	}
+	for date, diff := range changes {
+		n.changes[date] = diff
+	}
+	n.notes = append(n.notes, notes...)
+	n.sent++
+	return nil
+}
+
+func (n *recordingNotifier) hasNote(substr string) bool {
+	for _, note := range n.notes {
+		if strings.Contains(note, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+type syncTestEnv struct {
+	syncer   *Syncer
+	calendar *calendartest.Fake
+	store    *memoryStore
+	notifier *recordingNotifier
+}
+
+func newSyncTestEnv(t *testing.T, configure func(*config.AppConfig)) *syncTestEnv {
+	t.Helper()
+	appCfg := config.AppConfig{
+		Timezone:            time.UTC,
+		DefaultLocationCode: "HOM",
+		FutureHorizonDays:   2,
+		PastSyncWindowDays:  1,
+		WorkingWeek: config.WorkingWeekConfig{
+			WorkingDays: [7]bool{true, true, true, true, true, true, true},
+		},
+		Holidays: config.HolidaysConfig{Code: "H"},
+	}
+	if configure != nil {
+		configure(&appCfg)
+	}
+	catalog, err := LoadCatalog(appCfg)
+	if err != nil {
+		t.Fatalf("failed to load catalog: %v", err)
+	}
+
+	fake := calendartest.NewFake()
+	clock := testNow
+	fake.Now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	env := &syncTestEnv{
+		calendar: fake,
+		store:    newMemoryStore(),
+		notifier: &recordingNotifier{},
+	}
+	env.syncer = NewSyncer(env.store, fake, &config.Config{App: appCfg}, catalog)
+	env.syncer.now = func() time.Time { return testNow }
+	env.syncer.notifier = env.notifier
+	return env
+}
+
+// sync runs a sync like the worker does (incremental if possible).
+func (env *syncTestEnv) sync(t *testing.T) {
+	t.Helper()
+	if err := env.syncer.runSync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+}
+
+// insert creates an event in the calendar as the user would.
+func (env *syncTestEnv) insert(t *testing.T, event *gcal.Event) *gcal.Event {
+	t.Helper()
+	created, err := env.calendar.InsertEvent(context.Background(), event)
+	if err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+	return created
+}
+
+// setTitle changes the title of an event as the user would.
+func (env *syncTestEnv) setTitle(t *testing.T, eventID, title string) {
+	t.Helper()
+	_, err := env.calendar.PatchEvent(context.Background(), eventID, &gcal.Event{Summary: title})
+	if err != nil {
+		t.Fatalf("failed to patch event %s: %v", eventID, err)
+	}
+}
+
+// onlyEventOn returns the single event of a date, failing otherwise.
+func (env *syncTestEnv) onlyEventOn(t *testing.T, date string) *gcal.Event {
+	t.Helper()
+	events := env.calendar.EventsOn(date)
+	if len(events) != 1 {
+		titles := make([]string, len(events))
+		for i, e := range events {
+			titles[i] = e.Summary
+		}
+		t.Fatalf("expected exactly 1 event on %s, got %d: %q", date, len(events), titles)
+	}
+	return events[0]
+}
+
+func (env *syncTestEnv) assertEntry(t *testing.T, date, locationCode, status string) database.ScheduleEntry {
+	t.Helper()
+	entry, ok := env.store.entry(date)
+	if !ok {
+		t.Fatalf("no schedule entry for %s", date)
+	}
+	if entry.LocationCode != locationCode || entry.Status != status {
+		t.Errorf("schedule entry for %s = (%s, %s), want (%s, %s)", date, entry.LocationCode, entry.Status, locationCode, status)
+	}
+	return entry
+}
+
+// testDate parses a date in the "2006-01-02" format.
+func testDate(date string) time.Time {
+	d, _ := time.Parse("2006-01-02", date)
+	return d
+}
+
+func allDayEvent(date, title string) *gcal.Event {
+	start, _ := time.Parse("2006-01-02", date)
+	return &gcal.Event{
+		Summary: title,
+		Start:   &gcal.EventDateTime{Date: date},
+		End:     &gcal.EventDateTime{Date: start.AddDate(0, 0, 1).Format("2006-01-02")},
+	}
+}
+
+func managedEvent(date, title string) *gcal.Event {
+	event := allDayEvent(date, title)
+	event.ExtendedProperties = &gcal.EventExtendedProperties{
+		Private: map[string]string{calendar.ManagedPropertyKey: "true"},
+	}
+	return event
+}
+
+func TestRunFullSyncCreatesDefaultEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+
+	for _, date := range testWindow {
+		env.assertEntry(t, date, "HOM", "Home")
+		event := env.onlyEventOn(t, date)
+		if event.Summary != "HOM" || event.ColorId != "3" {
+			t.Errorf("event on %s = (%q, color %q), want (HOM, color 3)", date, event.Summary, event.ColorId)
+		}
+		if !calendar.HasManagedProperty(event) || calendar.AutoDefaultCode(event) != "HOM" {
+			t.Errorf("event on %s isn't tagged as a managed auto-default event: %v", date, event.ExtendedProperties)
+		}
+	}
+
+	token, err := env.store.GetSyncState(context.Background(), "syncToken")
+	if err != nil || token == "" {
+		t.Errorf("sync token wasn't persisted (token %q, err %v)", token, err)
+	}
+	if env.notifier.sent != 0 {
+		t.Errorf("default events shouldn't trigger an email, got changes %v and notes %q", env.notifier.changes, env.notifier.notes)
+	}
+}
+
+func TestRunFullSyncAdoptsTaggedEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	event := allDayEvent("2025-03-11", "V")
+	event.Description = "Add-To-ZenithPlanner: true\nwith team\ndesk: 14"
+	created := env.insert(t, event)
+
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+
+	got := env.onlyEventOn(t, "2025-03-11")
+	if got.Id != created.Id {
+		t.Errorf("event on 2025-03-11 is %s, want the user's event %s", got.Id, created.Id)
+	}
+	if !calendar.HasManagedProperty(got) {
+		t.Error("the managed property wasn't added")
+	}
+	if got.Description != "with team\ndesk: 14" {
+		t.Errorf("description = %q, want the tag removed", got.Description)
+	}
+	if got.ColorId != "10" {
+		t.Errorf("color = %q, want 10", got.ColorId)
+	}
+
+	entry := env.assertEntry(t, "2025-03-11", "V", "Vacation")
+	if entry.IsWorkingDay {
+		t.Error("vacation days shouldn't count as working days")
+	}
+	if entry.Note == nil || *entry.Note != "with team" || entry.Tags["desk"] != "14" {
+		t.Errorf("note and tags = (%v, %v), want (with team, desk: 14)", entry.Note, entry.Tags)
+	}
+}
+
+func TestRunFullSyncRemovesDuplicates(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.insert(t, managedEvent("2025-03-10", "HOM"))
+	latest := env.insert(t, managedEvent("2025-03-10", "V"))
+
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+
+	if got := env.onlyEventOn(t, "2025-03-10"); got.Id != latest.Id {
+		t.Errorf("kept event %s (%s), want the most recently updated one %s", got.Id, got.Summary, latest.Id)
+	}
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	if !env.notifier.hasNote("“V” was kept because it was the most recently updated one, and “HOM” has been deleted") {
+		t.Errorf("the email doesn't explain which event won: %q", env.notifier.notes)
+	}
+}
+
+func TestDeletedDuplicateCanBeRestored(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	trip := managedEvent("2025-03-10", "V")
+	trip.Description = "Trip to Rome"
+	trip = env.insert(t, trip)
+	latest := env.insert(t, managedEvent("2025-03-10", "HOM"))
+	env.sync(t)
+
+	deleted := env.store.deleted()
+	if len(deleted) != 1 || deleted[0].EventID != trip.Id {
+		t.Fatalf("deleted events = %+v, want a snapshot of %s", deleted, trip.Id)
+	}
+	if want := "duplicate of " + latest.Id; !strings.Contains(deleted[0].Reason, want) || deleted[0].SyncRunID == "" {
+		t.Errorf("snapshot has reason %q and sync run %q, want a sync run and a reason containing %q", deleted[0].Reason, deleted[0].SyncRunID, want)
+	}
+	var snapshot gcal.Event
+	if err := json.Unmarshal(deleted[0].Event, &snapshot); err != nil || snapshot.Description != "Trip to Rome" {
+		t.Errorf("snapshot = %s (%v), want the full event", deleted[0].Event, err)
+	}
+
+	restored, err := env.syncer.RestoreDeletedEvent(context.Background(), deleted[0].ID)
+	if err != nil {
+		t.Fatalf("RestoreDeletedEvent failed: %v", err)
+	}
+
+	// The restored event is the most recently updated one, so it wins.
+	if got := env.onlyEventOn(t, "2025-03-10"); got.Id != restored.Id || got.Description != "Trip to Rome" {
+		t.Errorf("event on 2025-03-10 = %s (%q), want the restored event %s", got.Id, got.Description, restored.Id)
+	}
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	if !env.notifier.hasNote("the deleted event “V” has been restored") {
+		t.Errorf("the email doesn't mention the restored event: %q", env.notifier.notes)
+	}
+	deleted = env.store.deleted()
+	if derefString(deleted[0].RestoredEventID) != restored.Id {
+		t.Errorf("snapshot restored as %q, want %s", derefString(deleted[0].RestoredEventID), restored.Id)
+	}
+	if len(deleted) != 2 || deleted[1].EventID != latest.Id || deleted[1].SyncRunID == deleted[0].SyncRunID {
+		t.Errorf("deleted events = %+v, want a snapshot of %s from another sync run", deleted, latest.Id)
+	}
+
+	if _, err := env.syncer.RestoreDeletedEvent(context.Background(), deleted[0].ID); err == nil {
+		t.Error("restoring the same snapshot twice succeeded")
+	}
+}
+
+func TestConflictResolutionPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		policy     string
+		wantTitle  string
+		wantEvents int
+		wantNote   string
+	}{
+		{config.ConflictPolicyLatest, "HOM", 1, "“HOM” was kept because it was the most recently updated one, and “V” has been deleted"},
+		{config.ConflictPolicyUserOverDefault, "V", 1, "“V” was kept because it was created by you, while the others were automatic defaults"},
+		{config.ConflictPolicyStatusPriority, "V", 1, "“V” was kept because its status (Vacation) has a higher priority than Home"},
+		{config.ConflictPolicyKeepAll, "HOM", 2, "“HOM” is used because it was the most recently updated one, and “V” has been left as is"},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+				appCfg.ConflictResolution = config.ConflictResolutionConfig{
+					Policy:         tt.policy,
+					StatusPriority: []string{"Vacation", "Holiday"},
+				}
+			})
+			env.sync(t)
+			env.sync(t)
+
+			// A vacation is added on top of the automatic default, which
+			// is updated afterwards (e.g. its color is changed).
+			autoDefault := env.onlyEventOn(t, "2025-03-10")
+			env.insert(t, managedEvent("2025-03-10", "V"))
+			if _, err := env.calendar.PatchEvent(context.Background(), autoDefault.Id, &gcal.Event{ColorId: "1"}); err != nil {
+				t.Fatalf("failed to patch event: %v", err)
+			}
+			env.sync(t)
+
+			events := env.calendar.EventsOn("2025-03-10")
+			if len(events) != tt.wantEvents {
+				t.Errorf("%d events on 2025-03-10, want %d", len(events), tt.wantEvents)
+			}
+			env.assertEntry(t, "2025-03-10", tt.wantTitle, map[string]string{"HOM": "Home", "V": "Vacation"}[tt.wantTitle])
+			if !env.notifier.hasNote(tt.wantNote) {
+				t.Errorf("the email doesn't explain which event won: %q", env.notifier.notes)
+			}
+		})
+	}
+}
+
+func TestKeptConflictsAreOnlyReportedOnce(t *testing.T) {
+	env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+		appCfg.ConflictResolution.Policy = config.ConflictPolicyKeepAll
+	})
+	ctx := context.Background()
+	env.sync(t)
+	env.sync(t)
+	env.insert(t, managedEvent("2025-03-10", "V"))
+	env.sync(t)
+	if !env.notifier.hasNote("2025-03-10: there are several events for this day") {
+		t.Fatalf("the email doesn't report the conflict: %q", env.notifier.notes)
+	}
+
+	// Reconciling the date again doesn't report the same conflict again.
+	env.notifier.notes = nil
+	if err := env.syncer.RunFullSync(ctx); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	if err := env.syncer.RunHorizonMaintenanceTask(ctx); err != nil {
+		t.Fatalf("RunHorizonMaintenanceTask failed: %v", err)
+	}
+	if env.notifier.hasNote("several events") {
+		t.Errorf("the conflict was reported again: %q", env.notifier.notes)
+	}
+
+	// A new conflicting event is reported.
+	env.insert(t, managedEvent("2025-03-10", "LIB"))
+	env.sync(t)
+	if !env.notifier.hasNote("2025-03-10: there are several events for this day") {
+		t.Errorf("the email doesn't report the changed conflict: %q", env.notifier.notes)
+	}
+}
+
+func TestMultiDayEventsAreExpandedIntoDailyEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	vacation := managedEvent("2025-03-10", "vacation")
+	vacation.End.Date = "2025-03-13"
+	original := env.insert(t, vacation)
+
+	// The original can't be deleted, so it is kept and expanded again by
+	// the next sync.
+	flaky := &flakyCalendar{CalendarProvider: env.calendar, failDeletes: true}
+	env.syncer.calendarService = flaky
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	if env.calendar.Event(original.Id) == nil {
+		t.Fatalf("the multi-day event was deleted")
+	}
+	if env.notifier.hasNote("has been split") {
+		t.Errorf("the email says that the event was split, but it wasn't deleted: %q", env.notifier.notes)
+	}
+
+	flaky.failDeletes = false
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+
+	if env.calendar.Event(original.Id) != nil {
+		t.Errorf("the multi-day event %s wasn't deleted", original.Id)
+	}
+	for _, date := range []string{"2025-03-10", "2025-03-11", "2025-03-12"} {
+		got := env.onlyEventOn(t, date)
+		if got.Summary != "V" || got.Id != dailyEventID(original.Id, testDate(date)) || !calendar.HasManagedProperty(got) {
+			t.Errorf("event on %s = %+v, want a managed V event created from the multi-day event", date, got)
+		}
+		env.assertEntry(t, date, "V", "Vacation")
+	}
+	env.assertEntry(t, "2025-03-09", "HOM", "Home")
+	if !env.notifier.hasNote("The V event spanning 2025-03-10 → 2025-03-12 has been split into 3 daily events.") {
+		t.Errorf("the email doesn't report the whole range: %q", env.notifier.notes)
+	}
+}
+
+func TestRunFullSyncMaterializesRecurringEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	// The instances are received in different pages.
+	env.calendar.PageSize = 1
+	event := managedEvent("2025-03-10", "LIB-CENTRAL")
+	event.ColorId = "2"
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=2"}
+	master := env.insert(t, event)
+	// Recurring events which aren't managed are left alone.
+	lunch := allDayEvent("2025-03-09", "Team lunch")
+	lunch.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=1"}
+	env.insert(t, lunch)
+
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+
+	env.assertEntry(t, "2025-03-09", "HOM", "Home")
+	env.assertEntry(t, "2025-03-10", "LIB-CENTRAL", "Library")
+	env.assertEntry(t, "2025-03-11", "LIB-CENTRAL", "Library")
+	env.assertEntry(t, "2025-03-12", "HOM", "Home")
+	for _, date := range []string{"2025-03-10", "2025-03-11"} {
+		got := env.onlyEventOn(t, date)
+		if got.RecurringEventId != "" || !calendar.HasManagedProperty(got) {
+			t.Errorf("event on %s = %+v, want a standalone managed event", date, got)
+		}
+	}
+	if env.calendar.Event(master.Id) != nil {
+		t.Errorf("the recurring event %s wasn't deleted", master.Id)
+	}
+	if len(env.calendar.EventsOn("2025-03-09")) != 2 {
+		t.Errorf("the unmanaged recurring event was modified")
+	}
+	if !env.notifier.hasNote("recurring LIB-CENTRAL event has been converted into 2 daily events (2025-03-10 → 2025-03-11).") {
+		t.Errorf("the email doesn't explain the conversion: %q", env.notifier.notes)
+	}
+	if env.notifier.hasNote("have been removed") {
+		t.Errorf("the email says that occurrences were removed, but the series ends within the horizon: %q", env.notifier.notes)
+	}
+}
+
+func TestRunIncrementalSyncAppliesUserChanges(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t) // Full sync
+	env.sync(t) // Picks up the created default events
+
+	event := env.onlyEventOn(t, "2025-03-11")
+	env.setTitle(t, event.Id, "V")
+
+	token, _ := env.store.GetSyncState(context.Background(), "syncToken")
+	err, fullSyncNeeded := env.syncer.RunIncrementalSync(context.Background(), token)
+	if err != nil {
+		t.Fatalf("RunIncrementalSync failed (full sync needed: %t): %v", fullSyncNeeded, err)
+	}
+
+	env.assertEntry(t, "2025-03-11", "V", "Vacation")
+	if got := env.onlyEventOn(t, "2025-03-11"); got.ColorId != "10" {
+		t.Errorf("color = %q, want 10", got.ColorId)
+	}
+	if diff := env.notifier.changes["2025-03-11"]; diff != "HOM → V" {
+		t.Errorf("email change for 2025-03-11 = %q, want \"HOM → V\"", diff)
+	}
+	if len(env.notifier.changes) != 1 {
+		t.Errorf("expected only 1 change in the email, got %v", env.notifier.changes)
+	}
+}
+
+func TestRunIncrementalSyncRecreatesDeletedDefaultEvent(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+
+	deleted := env.onlyEventOn(t, "2025-03-11")
+	if err := env.calendar.DeleteEvent(context.Background(), deleted.Id); err != nil {
+		t.Fatalf("failed to delete event: %v", err)
+	}
+	env.sync(t)
+
+	got := env.onlyEventOn(t, "2025-03-11")
+	if got.Id == deleted.Id || got.Summary != "HOM" {
+		t.Errorf("event on 2025-03-11 = %s (%s), want a new HOM event", got.Id, got.Summary)
+	}
+	env.assertEntry(t, "2025-03-11", "HOM", "Home")
+}
+
+func TestRunIncrementalSyncMaterializesRecurringEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+
+	// The series continues beyond the horizon, which ends on 2025-03-12.
+	event := managedEvent("2025-03-10", "LIB-CENTRAL")
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=5"}
+	master := env.insert(t, event)
+	env.sync(t)
+
+	for _, date := range []string{"2025-03-10", "2025-03-11", "2025-03-12"} {
+		if got := env.onlyEventOn(t, date); got.RecurringEventId != "" || got.Summary != "LIB-CENTRAL" {
+			t.Errorf("event on %s = %+v, want a standalone LIB-CENTRAL event", date, got)
+		}
+		env.assertEntry(t, date, "LIB-CENTRAL", "Library")
+	}
+	if events := env.calendar.EventsOn("2025-03-13"); len(events) != 0 || env.calendar.Event(master.Id) != nil {
+		t.Errorf("the recurring event wasn't deleted")
+	}
+	if !env.notifier.hasNote("converted into 3 daily events") {
+		t.Errorf("the email doesn't say how many days were created: %q", env.notifier.notes)
+	}
+	// The recurring event is deleted first, and the defaults it replaces
+	// afterwards.
+	if deleted := env.store.deleted(); len(deleted) != 4 || deleted[0].EventID != master.Id || dateKey(deleted[0].Date) != "2025-03-10" {
+		t.Errorf("got %d deleted events, want a snapshot of the recurring event and 3 defaults", len(deleted))
+	}
+
+	// Each day can now be changed independently.
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-11").Id, "V")
+	env.sync(t)
+
+	env.assertEntry(t, "2025-03-10", "LIB-CENTRAL", "Library")
+	env.assertEntry(t, "2025-03-11", "V", "Vacation")
+	env.assertEntry(t, "2025-03-12", "LIB-CENTRAL", "Library")
+	if diff := env.notifier.changes["2025-03-11"]; diff != "LIB-CENTRAL → V" {
+		t.Errorf("email change for 2025-03-11 = %q, want \"LIB-CENTRAL → V\"", diff)
+	}
+}
+
+func TestMaterializedRecurringEventsKeepTheirPastOccurrences(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+
+	// The series started before the sync window, which starts on
+	// 2025-03-09.
+	event := managedEvent("2025-03-06", "LIB-CENTRAL")
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=9"}
+	master := env.insert(t, event)
+	env.sync(t)
+
+	for _, date := range []string{"2025-03-06", "2025-03-07", "2025-03-08"} {
+		if got := env.onlyEventOn(t, date); got.RecurringEventId != master.Id {
+			t.Errorf("event on %s = %+v, want the occurrence of the recurring event", date, got)
+		}
+	}
+	for _, date := range testWindow {
+		if got := env.onlyEventOn(t, date); got.RecurringEventId != "" || got.Summary != "LIB-CENTRAL" {
+			t.Errorf("event on %s = %+v, want a standalone LIB-CENTRAL event", date, got)
+		}
+		env.assertEntry(t, date, "LIB-CENTRAL", "Library")
+	}
+	if events := env.calendar.EventsOn("2025-03-13"); len(events) != 0 {
+		t.Errorf("the occurrences after the horizon weren't removed: %+v", events)
+	}
+	if got := env.calendar.Event(master.Id); got == nil || !slices.Equal(got.Recurrence, []string{"RRULE:FREQ=DAILY;UNTIL=20250308"}) {
+		t.Errorf("recurring event = %+v, want it to end on 2025-03-08", got)
+	}
+	if !env.notifier.hasNote("converted into 4 daily events (2025-03-09 → 2025-03-12). Its occurrences before 2025-03-09 have been kept in the series, which now ends on 2025-03-08. Its occurrences after 2025-03-12 have been removed, since days are only planned 2 days ahead: please add them again later.") {
+		t.Errorf("the email doesn't explain the conversion: %q", env.notifier.notes)
+	}
+
+	// The occurrences which are kept aren't materialized again.
+	notes := len(env.notifier.notes)
+	env.sync(t)
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	if len(env.notifier.notes) != notes {
+		t.Errorf("the recurring event was materialized again: %q", env.notifier.notes[notes:])
+	}
+}
+
+func TestRunIncrementalSyncRequestsFullSyncWhenTokenIsGone(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	token, _ := env.store.GetSyncState(context.Background(), "syncToken")
+
+	env.calendar.InvalidateSyncTokens()
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "V")
+
+	err, fullSyncNeeded := env.syncer.RunIncrementalSync(context.Background(), token)
+	if err == nil || !fullSyncNeeded {
+		t.Fatalf("RunIncrementalSync = (%v, %t), want an error requesting a full sync", err, fullSyncNeeded)
+	}
+	if cleared, _ := env.store.GetSyncState(context.Background(), "syncToken"); cleared != "" {
+		t.Errorf("the invalid sync token wasn't cleared: %q", cleared)
+	}
+
+	env.sync(t)
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+}
+
+func TestRunReconciliationCanonicalizesAliases(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.insert(t, managedEvent("2025-03-10", "vacation"))
+	env.sync(t)
+
+	if got := env.onlyEventOn(t, "2025-03-10"); got.Summary != "V" {
+		t.Errorf("title = %q, want the canonical code V", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	if !env.notifier.hasNote("you wrote “vacation”, interpreted as V") {
+		t.Errorf("the email doesn't explain the interpretation: %q", env.notifier.notes)
+	}
+}
+
+func TestRunReconciliationRejectsUnknownTitlesInStrictMode(t *testing.T) {
+	env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+		appCfg.StrictValidation = config.StrictValidationConfig{
+			Enabled:     true,
+			Action:      config.StrictValidationRevert,
+			ErrorPrefix: "⚠️ ",
+		}
+	})
+	env.sync(t)
+	env.sync(t)
+
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "LBI")
+	env.sync(t)
+
+	if got := env.onlyEventOn(t, "2025-03-10"); got.Summary != "HOM" {
+		t.Errorf("title = %q, want it reverted to HOM", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-10", "HOM", "Home")
+	if len(env.store.rejectedTitles) != 1 || env.store.rejectedTitles[0].Title != "LBI" {
+		t.Errorf("rejected titles = %+v, want the LBI rejection", env.store.rejectedTitles)
+	}
+	if !env.notifier.hasNote("“LBI” isn't a valid location") || !env.notifier.hasNote("Valid locations are:") {
+		t.Errorf("the email doesn't explain the rejection: %q", env.notifier.notes)
+	}
+}
+
+func TestScheduleHistoryRecordsEachChange(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+	defaultEvent := env.onlyEventOn(t, "2025-03-10")
+	env.setTitle(t, defaultEvent.Id, "V")
+	env.sync(t)
+
+	history, err := env.store.GetScheduleEntryHistory(context.Background(), testDate("2025-03-10"), testDate("2025-03-10"))
+	if err != nil {
+		t.Fatalf("GetScheduleEntryHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d changes for 2025-03-10, want 2: %+v", len(history), history)
+	}
+	created, changed := history[0], history[1]
+	if created.OldLocationCode != nil || created.NewLocationCode != "HOM" || created.Trigger != database.TriggerFullSync || derefString(created.EventID) != defaultEvent.Id {
+		t.Errorf("first change = %+v, want the creation of HOM by the full sync with event %s", created, defaultEvent.Id)
+	}
+	if derefString(changed.OldLocationCode) != "HOM" || derefString(changed.OldStatus) != "Home" || changed.NewLocationCode != "V" || changed.NewStatus != "Vacation" ||
+		changed.Trigger != database.TriggerIncrementalSync || derefString(changed.EventID) != defaultEvent.Id || changed.SyncRunID == created.SyncRunID {
+		t.Errorf("second change = %+v, want HOM → V by an incremental sync", changed)
+	}
+}
+
+func TestRevertScheduleRestoresAnEarlierLocation(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+	beforeTrip := time.Now()
+
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "V")
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-11").Id, "V")
+	env.sync(t)
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-11").Id, "LIB-CENTRAL")
+	env.sync(t)
+
+	notes, err := env.syncer.RevertSchedule(context.Background(), testDate("2025-03-10"), testDate("2025-03-12"), beforeTrip)
+	if err != nil {
+		t.Fatalf("RevertSchedule failed: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Errorf("got notes %q, want one for each reverted date", notes)
+	}
+	for _, date := range []string{"2025-03-10", "2025-03-11", "2025-03-12"} {
+		if got := env.onlyEventOn(t, date); got.Summary != "HOM" {
+			t.Errorf("event on %s has title %q, want HOM", date, got.Summary)
+		}
+		env.assertEntry(t, date, "HOM", "Home")
+	}
+	if !env.notifier.hasNote("2025-03-11: reverted from LIB-CENTRAL to HOM") {
+		t.Errorf("the email doesn't mention the reverted dates: %q", env.notifier.notes)
+	}
+
+	history, err := env.store.GetScheduleEntryHistory(context.Background(), testDate("2025-03-11"), testDate("2025-03-11"))
+	if err != nil {
+		t.Fatalf("GetScheduleEntryHistory failed: %v", err)
+	}
+	if last := history[len(history)-1]; last.Trigger != database.TriggerRevert || derefString(last.OldLocationCode) != "LIB-CENTRAL" || last.NewLocationCode != "HOM" {
+		t.Errorf("last change of 2025-03-11 = %+v, want LIB-CENTRAL → HOM by the revert", last)
+	}
+}
+
+func TestFrozenDatesUndoChanges(t *testing.T) {
+	env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+		// Only 2025-03-09 is frozen.
+		appCfg.Freeze = config.FreezeConfig{Rule: config.FreezeRuleDays, Days: 0}
+	})
+	env.sync(t)
+	env.sync(t)
+
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-09").Id, "V")
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "V")
+	env.sync(t)
+
+	if got := env.onlyEventOn(t, "2025-03-09"); got.Summary != "HOM" {
+		t.Errorf("event on the frozen date has title %q, want it restored to HOM", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-09", "HOM", "Home")
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	if !env.notifier.hasNote("2025-03-09: the event was changed to “V”, but dates before 2025-03-10 are frozen") {
+		t.Errorf("the email doesn't explain the freeze: %q", env.notifier.notes)
+	}
+
+	if err := env.calendar.DeleteEvent(context.Background(), env.onlyEventOn(t, "2025-03-09").Id); err != nil {
+		t.Fatalf("DeleteEvent failed: %v", err)
+	}
+	env.sync(t)
+
+	if got := env.onlyEventOn(t, "2025-03-09"); got.Summary != "HOM" {
+		t.Errorf("event on the frozen date has title %q, want the deleted event restored with HOM", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-09", "HOM", "Home")
+}
+
+func TestCorrectScheduleOverridesTheFreeze(t *testing.T) {
+	env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+		appCfg.Freeze = config.FreezeConfig{Rule: config.FreezeRuleDays, Days: 0}
+	})
+	env.sync(t)
+	env.sync(t)
+
+	notes, err := env.syncer.CorrectSchedule(context.Background(), testDate("2025-03-09"), testDate("2025-03-09"), "V")
+	if err != nil {
+		t.Fatalf("CorrectSchedule failed: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Errorf("got notes %q, want one for the corrected date", notes)
+	}
+	if got := env.onlyEventOn(t, "2025-03-09"); got.Summary != "V" {
+		t.Errorf("event on the corrected date has title %q, want V", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-09", "V", "Vacation")
+
+	// The next syncs keep the correction.
+	env.sync(t)
+	env.assertEntry(t, "2025-03-09", "V", "Vacation")
+
+	history, err := env.store.GetScheduleEntryHistory(context.Background(), testDate("2025-03-09"), testDate("2025-03-09"))
+	if err != nil {
+		t.Fatalf("GetScheduleEntryHistory failed: %v", err)
+	}
+	if last := history[len(history)-1]; last.Trigger != database.TriggerCorrection || last.NewLocationCode != "V" {
+		t.Errorf("last change of 2025-03-09 = %+v, want → V by the correction", last)
+	}
+}
+
+func TestRunReconciliationAppliesNewHolidaysToDefaultEvents(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+
+	holidayDate, _ := time.Parse("2006-01-02", "2025-03-11")
+	env.store.holidays["2025-03-11"] = database.Holiday{Date: holidayDate, Name: "Test holiday"}
+	err := env.syncer.RunReconciliation(context.Background(), []time.Time{holidayDate}, false, nil)
+	if err != nil {
+		t.Fatalf("RunReconciliation failed: %v", err)
+	}
+
+	if got := env.onlyEventOn(t, "2025-03-11"); got.Summary != "H" {
+		t.Errorf("title = %q, want the holiday code H", got.Summary)
+	}
+	env.assertEntry(t, "2025-03-11", "H", "Holiday")
+}
+
+func TestReadOnlyModeOnlyUpdatesTheDatabase(t *testing.T) {
+	env := newSyncTestEnv(t, func(appCfg *config.AppConfig) {
+		appCfg.StrictValidation = config.StrictValidationConfig{
+			Enabled:     true,
+			Action:      config.StrictValidationRevert,
+			ErrorPrefix: "⚠️ ",
+		}
+	})
+	env.syncer.readOnly = true
+	env.insert(t, allDayEvent("2025-03-10", "vacation"))
+	env.insert(t, allDayEvent("2025-03-11", "Company offsite"))
+	tagged := allDayEvent("2025-03-12", "LBI")
+	tagged.Description = "Add-To-ZenithPlanner: true"
+	env.insert(t, tagged)
+	before := len(env.calendar.Events())
+
+	env.sync(t)
+	env.sync(t)
+
+	if after := len(env.calendar.Events()); after != before {
+		t.Errorf("the calendar has %d events after syncing, want the original %d", after, before)
+	}
+	env.assertEntry(t, "2025-03-09", "HOM", "Home")
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	env.assertEntry(t, "2025-03-11", "HOM", "Home")
+	env.assertEntry(t, "2025-03-12", "HOM", "Home")
+	if got := env.onlyEventOn(t, "2025-03-12"); got.Summary != "LBI" {
+		t.Errorf("title = %q, want the rejected title to be kept in the calendar", got.Summary)
+	}
+	if len(env.store.rejectedTitles) != 1 || env.store.rejectedTitles[0].Action != rejectionActionIgnore {
+		t.Errorf("rejected titles = %+v, want a single ignored LBI rejection", env.store.rejectedTitles)
+	}
+
+	notes := len(env.notifier.notes)
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	if len(env.notifier.notes) != notes {
+		t.Errorf("a full sync repeated the rejection notes: %q", env.notifier.notes[notes:])
+	}
+}
+
+// flakyCalendar makes the insertions or deletions of the wrapped calendar
+// fail. It doesn't support batches, so mutations are executed one by one.
+type flakyCalendar struct {
+	calendar.CalendarProvider
+	// Fail the insertions without performing them.
+	failInserts bool
+	// Perform the insertions, but report them as failed (e.g. the process
+	// crashed or the response was lost).
+	loseInsertResponses bool
+	// Fail the deletions without performing them.
+	failDeletes bool
+}
+
+func (c *flakyCalendar) DeleteEvent(ctx context.Context, eventID string) error {
+	if c.failDeletes {
+		return errors.New("simulated failure")
+	}
+	return c.CalendarProvider.DeleteEvent(ctx, eventID)
+}
+
+func (c *flakyCalendar) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	if c.failInserts {
+		return nil, errors.New("simulated failure")
+	}
+	created, err := c.CalendarProvider.InsertEvent(ctx, event)
+	if err == nil && c.loseInsertResponses {
+		return nil, errors.New("simulated lost response")
+	}
+	return created, err
+}
+
+func TestOutboxRetriesFailedMutations(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	flaky := &flakyCalendar{CalendarProvider: env.calendar, failInserts: true}
+	env.syncer.calendarService = flaky
+
+	env.sync(t)
+
+	for _, date := range testWindow {
+		env.assertEntry(t, date, "HOM", "Home")
+	}
+	if events := env.calendar.Events(); len(events) != 0 {
+		t.Fatalf("the calendar has %d events, want none since insertions fail", len(events))
+	}
+	pending := env.store.pendingOutboxItems()
+	if len(pending) != len(testWindow) || pending[0].Attempts != 1 || pending[0].LastError == nil {
+		t.Fatalf("pending outbox items = %+v, want %d failed insertions", pending, len(testWindow))
+	}
+
+	// Items aren't retried before their backoff expires.
+	flaky.failInserts = false
+	if err := env.syncer.ProcessOutbox(context.Background()); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	if events := env.calendar.Events(); len(events) != 0 {
+		t.Fatalf("the outbox was retried before the backoff expired")
+	}
+
+	env.syncer.now = func() time.Time { return testNow.Add(outboxRetryDelay) }
+	if err := env.syncer.ProcessOutbox(context.Background()); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	for _, date := range testWindow {
+		if event := env.onlyEventOn(t, date); event.Summary != "HOM" {
+			t.Errorf("event on %s = %q, want HOM", date, event.Summary)
+		}
+	}
+	if pending := env.store.pendingOutboxItems(); len(pending) != 0 {
+		t.Errorf("pending outbox items = %+v, want none", pending)
+	}
+}
+
+func TestOutboxGivesUpOnFailedMutations(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+
+	// An invalid event ID can't succeed however many times it is retried.
+	if err := env.syncer.enqueueInsert(ctx, testDate("2025-03-10"), "zpinvalid", managedEvent("2025-03-10", "HOM")); err != nil {
+		t.Fatalf("enqueueInsert failed: %v", err)
+	}
+	if err := env.syncer.ProcessOutbox(ctx); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+	dead := env.store.outboxItems(database.OutboxDead)
+	if len(dead) != 1 || dead[0].Attempts != 1 || env.store.pendingOutboxItems() != nil {
+		t.Fatalf("outbox items = %+v, want a single dead item after one attempt", env.store.outbox)
+	}
+
+	// Other errors are retried until the item has failed too many times.
+	flaky := &flakyCalendar{CalendarProvider: env.calendar, failInserts: true}
+	env.syncer.calendarService = flaky
+	if err := env.syncer.enqueueInsert(ctx, testDate("2025-03-11"), newEventID(), managedEvent("2025-03-11", "HOM")); err != nil {
+		t.Fatalf("enqueueInsert failed: %v", err)
+	}
+	for attempt := range outboxMaxAttempts + 1 {
+		env.syncer.now = func() time.Time { return testNow.Add(time.Duration(attempt) * outboxMaxRetryDelay) }
+		if err := env.syncer.ProcessOutbox(ctx); err != nil {
+			t.Fatalf("ProcessOutbox failed: %v", err)
+		}
+	}
+	dead = env.store.outboxItems(database.OutboxDead)
+	if len(dead) != 2 || dead[1].Attempts != outboxMaxAttempts || env.store.pendingOutboxItems() != nil {
+		t.Errorf("outbox items = %+v, want the second one dead after %d attempts", env.store.outbox, outboxMaxAttempts)
+	}
+	if events := env.calendar.Events(); len(events) != 0 {
+		t.Errorf("the calendar has %d events, want none", len(events))
+	}
+}
+
+func TestSyncRequestsAreQueuedInTheDatabase(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	for range 2 {
+		if err := env.syncer.RequestSync(ctx); err != nil {
+			t.Fatalf("RequestSync failed: %v", err)
+		}
+	}
+	if jobs := env.store.jobs(); len(jobs) != 1 {
+		t.Fatalf("sync jobs = %+v, want the requests to be merged into one", jobs)
+	}
+
+	// The job was left running by a process which crashed.
+	if _, err := env.store.ClaimDueSyncJob(ctx, testNow); err != nil {
+		t.Fatalf("ClaimDueSyncJob failed: %v", err)
+	}
+	if err := env.syncer.processSyncJobs(ctx); err != nil {
+		t.Fatalf("processSyncJobs failed: %v", err)
+	}
+
+	job := env.store.jobs()[0]
+	if job.Status != database.SyncJobDone || job.Attempts != 1 {
+		t.Errorf("sync job = %+v, want it to be done after being interrupted once", job)
+	}
+	for _, date := range testWindow {
+		env.assertEntry(t, date, "HOM", "Home")
+	}
+}
+
+func TestFailedSyncJobsAreRetriedUntilTheyAreDead(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	env.store.upsertCachedEventErr = errors.New("simulated failure")
+	env.insert(t, managedEvent("2025-03-10", "V"))
+	if err := env.syncer.RequestFullSync(ctx); err != nil {
+		t.Fatalf("RequestFullSync failed: %v", err)
+	}
+
+	now := testNow
+	env.syncer.now = func() time.Time { return now }
+	for attempt := 1; attempt <= syncJobMaxAttempts; attempt++ {
+		if err := env.syncer.processSyncJobs(ctx); err != nil {
+			t.Fatalf("processSyncJobs failed: %v", err)
+		}
+		job := env.store.jobs()[0]
+		if job.Attempts != attempt || job.LastError == nil {
+			t.Fatalf("sync job after attempt %d = %+v, want the failure to be recorded", attempt, job)
+		}
+		if attempt < syncJobMaxAttempts {
+			wantDelay := min(syncJobRetryDelay<<(attempt-1), syncJobMaxRetryDelay)
+			if job.Status != database.SyncJobPending || job.NextRunAt.Sub(now) != wantDelay {
+				t.Fatalf("sync job after attempt %d = %+v, want it to be retried in %s", attempt, job, wantDelay)
+			}
+			now = job.NextRunAt
+		}
+	}
+
+	if job := env.store.jobs()[0]; job.Status != database.SyncJobDead {
+		t.Fatalf("sync job = %+v, want it to be dead", job)
+	}
+
+	// Dead jobs aren't retried.
+	env.store.upsertCachedEventErr = nil
+	now = now.Add(24 * time.Hour)
+	if err := env.syncer.processSyncJobs(ctx); err != nil {
+		t.Fatalf("processSyncJobs failed: %v", err)
+	}
+	if _, ok := env.store.entry("2025-03-10"); ok {
+		t.Errorf("the dead job was run again")
+	}
+}
+
+func TestFailedReconciliationsAreRetried(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	env.sync(t)
+	env.sync(t)
+	token, _ := env.store.GetSyncState(ctx, "syncToken")
+
+	// The sync token isn't advanced if the changed dates can't be
+	// reconciled, so the changes are received again by the retry.
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "V")
+	env.store.enqueueErr = errors.New("simulated outbox failure")
+	if err := env.syncer.RequestSync(ctx); err != nil {
+		t.Fatalf("RequestSync failed: %v", err)
+	}
+	if err := env.syncer.processSyncJobs(ctx); err != nil {
+		t.Fatalf("processSyncJobs failed: %v", err)
+	}
+	if job := env.store.jobs()[0]; job.Status != database.SyncJobPending || job.LastError == nil {
+		t.Fatalf("sync job = %+v, want it to be retried", job)
+	}
+	if newToken, _ := env.store.GetSyncState(ctx, "syncToken"); newToken != token {
+		t.Errorf("the sync token was advanced although the reconciliation failed")
+	}
+
+	env.store.enqueueErr = nil
+	env.syncer.now = func() time.Time { return env.store.jobs()[0].NextRunAt }
+	if err := env.syncer.processSyncJobs(ctx); err != nil {
+		t.Fatalf("processSyncJobs failed: %v", err)
+	}
+	if job := env.store.jobs()[0]; job.Status != database.SyncJobDone {
+		t.Fatalf("sync job = %+v, want it to be done", job)
+	}
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+
+	// The same applies to reconcile_range jobs.
+	first, last := testDate("2025-03-11"), testDate("2025-03-12")
+	// The default event of the date has to be created again.
+	env.store.DeleteCachedEvent(ctx, env.onlyEventOn(t, "2025-03-11").Id)
+	env.store.enqueueErr = errors.New("simulated outbox failure")
+	if err := env.syncer.enqueueSyncJob(ctx, database.SyncJob{Kind: database.SyncJobReconcileRange, RangeStart: &first, RangeEnd: &last}); err != nil {
+		t.Fatalf("enqueueSyncJob failed: %v", err)
+	}
+	if err := env.syncer.processSyncJobs(ctx); err != nil {
+		t.Fatalf("processSyncJobs failed: %v", err)
+	}
+	jobs := env.store.jobs()
+	if job := jobs[len(jobs)-1]; job.Kind != database.SyncJobReconcileRange || job.Status != database.SyncJobPending || job.LastError == nil {
+		t.Fatalf("reconcile_range job = %+v, want it to be retried", job)
+	}
+}
+
+func TestOutboxInsertionsAreIdempotent(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	flaky := &flakyCalendar{CalendarProvider: env.calendar, loseInsertResponses: true}
+	env.syncer.calendarService = flaky
+
+	env.sync(t)
+	flaky.loseInsertResponses = false
+	env.syncer.now = func() time.Time { return testNow.Add(outboxRetryDelay) }
+	if err := env.syncer.ProcessOutbox(context.Background()); err != nil {
+		t.Fatalf("ProcessOutbox failed: %v", err)
+	}
+
+	for _, date := range testWindow {
+		env.onlyEventOn(t, date)
+	}
+	if pending := env.store.pendingOutboxItems(); len(pending) != 0 {
+		t.Errorf("pending outbox items = %+v, want none", pending)
+	}
+}
+
+func TestReconciliationRollsBackWhenTheOutboxFails(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.store.enqueueErr = errors.New("simulated outbox failure")
+
+	if err := env.syncer.runSync(context.Background()); err == nil {
+		t.Fatalf("sync succeeded, want the reconciliation errors")
+	}
+
+	for _, date := range testWindow {
+		if entry, ok := env.store.entry(date); ok {
+			t.Errorf("schedule entry for %s = %+v, want none since its calendar mutation couldn't be recorded", date, entry)
+		}
+	}
+	if env.store.rollbacks != len(testWindow) {
+		t.Errorf("%d transactions were rolled back, want %d", env.store.rollbacks, len(testWindow))
+	}
+
+	env.store.enqueueErr = nil
+	if err := env.syncer.RunFullSync(context.Background()); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	for _, date := range testWindow {
+		env.assertEntry(t, date, "HOM", "Home")
+		env.onlyEventOn(t, date)
+	}
+}
+
+func TestFailedBestEffortWritesDontAbortTheReconciliation(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.store.registerLocationErr = errors.New("simulated locations failure")
+
+	env.sync(t)
+
+	for _, date := range testWindow {
+		env.assertEntry(t, date, "HOM", "Home")
+		env.onlyEventOn(t, date)
+	}
+}
+
+func TestOutboxBatchesInsertions(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+
+	env.sync(t)
+
+	for _, date := range testWindow {
+		env.onlyEventOn(t, date)
+	}
+	if batches := env.calendar.Batches(); batches != 1 {
+		t.Errorf("the events were created in %d batches, want 1", batches)
+	}
+}
+
+func TestFullSyncRepairsCacheDrift(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	env.sync(t)
+	env.sync(t) // Caches the events created by the first sync.
+
+	// Simulate missed notifications: an event missing from the cache, an
+	// outdated one and a leftover of a deleted event.
+	missing := env.onlyEventOn(t, "2025-03-09")
+	outdated := env.onlyEventOn(t, "2025-03-10")
+	env.store.DeleteCachedEvent(ctx, missing.Id)
+	cached, _ := env.store.GetCachedEventByID(ctx, outdated.Id)
+	staleTitle := "LIB"
+	cached.Title = &staleTitle
+	env.store.UpsertCachedEvent(ctx, *cached)
+	ghostTitle := "HOM"
+	env.store.UpsertCachedEvent(ctx, database.CachedEvent{
+		EventID: "ghost",
+		Date:    time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC),
+		Title:   &ghostTitle,
+	})
+
+	drift, err := env.syncer.syncEventCache(ctx, calendar.ListOptions{}, nil)
+	if err != nil {
+		t.Fatalf("syncEventCache failed: %v", err)
+	}
+	if len(drift.Inserted) != 1 || len(drift.Updated) != 1 || len(drift.Deleted) != 1 {
+		t.Fatalf("drift = %d inserted, %d updated and %d deleted events, want 1 of each", len(drift.Inserted), len(drift.Updated), len(drift.Deleted))
+	}
+	report := drift.report()
+	for _, line := range []string{
+		"+ 2025-03-09 " + missing.Id + " HOM",
+		"~ 2025-03-10 " + outdated.Id + " LIB -> HOM (changed: title)",
+		"- 2025-03-11 ghost HOM",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("drift report doesn't contain %q:\n%s", line, report)
+		}
+	}
+
+	if event, _ := env.store.GetCachedEventByID(ctx, missing.Id); event == nil {
+		t.Errorf("missing event %s wasn't added to the cache", missing.Id)
+	}
+	if event, _ := env.store.GetCachedEventByID(ctx, outdated.Id); event == nil || *event.Title != "HOM" {
+		t.Errorf("outdated event %s wasn't updated in the cache: %+v", outdated.Id, event)
+	}
+	if event, _ := env.store.GetCachedEventByID(ctx, "ghost"); event != nil {
+		t.Errorf("deleted event is still in the cache: %+v", event)
+	}
+
+	drift, err = env.syncer.syncEventCache(ctx, calendar.ListOptions{}, nil)
+	if err != nil {
+		t.Fatalf("syncEventCache failed: %v", err)
+	}
+	if !drift.isEmpty() {
+		t.Errorf("drift after repairing the cache:\n%s", drift.report())
+	}
+}
+
+func TestFullSyncDoesNotPartiallyUpdateTheCache(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	env.sync(t)
+	env.sync(t)
+	cachedBefore, _ := env.store.GetAllCachedEvents(ctx)
+	tokenBefore, _ := env.store.GetSyncState(ctx, "syncToken")
+
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "LIB")
+	env.store.upsertCachedEventErr = errors.New("simulated failure")
+	if err := env.syncer.RunFullSync(ctx); err == nil {
+		t.Fatalf("RunFullSync succeeded, want an error")
+	}
+
+	cachedAfter, _ := env.store.GetAllCachedEvents(ctx)
+	if len(cachedAfter) != len(cachedBefore) {
+		t.Errorf("the cache has %d events after the failed full sync, want %d", len(cachedAfter), len(cachedBefore))
+	}
+	for i := range cachedAfter {
+		if *cachedAfter[i].Title != *cachedBefore[i].Title {
+			t.Errorf("cached event %s was changed to %q by the failed full sync", cachedAfter[i].EventID, *cachedAfter[i].Title)
+		}
+	}
+	if token, _ := env.store.GetSyncState(ctx, "syncToken"); token != tokenBefore {
+		t.Errorf("sync token changed to %q by the failed full sync, want %q", token, tokenBefore)
+	}
+}
+
+// txCheckingCalendar records the mutations of the wrapped calendar which
+// are made inside a transaction of the memory store.
+type txCheckingCalendar struct {
+	calendar.CalendarProvider
+	mutationsInTx []string
+}
+
+func (c *txCheckingCalendar) check(ctx context.Context, mutation string) {
+	if _, ok := ctx.Value(memoryTxKey{}).(*memoryTx); ok {
+		c.mutationsInTx = append(c.mutationsInTx, mutation)
+	}
+}
+
+func (c *txCheckingCalendar) InsertEvent(ctx context.Context, event *gcal.Event) (*gcal.Event, error) {
+	c.check(ctx, "insert "+event.Id)
+	return c.CalendarProvider.InsertEvent(ctx, event)
+}
+
+func (c *txCheckingCalendar) PatchEvent(ctx context.Context, eventID string, patch *gcal.Event) (*gcal.Event, error) {
+	c.check(ctx, "patch "+eventID)
+	return c.CalendarProvider.PatchEvent(ctx, eventID, patch)
+}
+
+func (c *txCheckingCalendar) DeleteEvent(ctx context.Context, eventID string) error {
+	c.check(ctx, "delete "+eventID)
+	return c.CalendarProvider.DeleteEvent(ctx, eventID)
+}
+
+func TestFullSyncModifiesTheCalendarOutsideTheCacheTransaction(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	ctx := context.Background()
+	env.calendar.PageSize = 1
+	vacation := managedEvent("2025-03-10", "vacation")
+	vacation.End.Date = "2025-03-12"
+	original := env.insert(t, vacation)
+	checking := &txCheckingCalendar{CalendarProvider: env.calendar}
+	env.syncer.calendarService = checking
+
+	// The multi-day event is expanded before the cache is written, so the
+	// daily events are found (and not created again) by the next full sync.
+	env.store.upsertCachedEventErr = errors.New("simulated failure")
+	if err := env.syncer.RunFullSync(ctx); err == nil {
+		t.Fatalf("RunFullSync succeeded, want an error")
+	}
+	if env.calendar.Event(original.Id) != nil {
+		t.Errorf("the multi-day event %s wasn't expanded", original.Id)
+	}
+	if cached, _ := env.store.GetAllCachedEvents(ctx); len(cached) != 0 {
+		t.Errorf("the failed full sync cached %d events", len(cached))
+	}
+
+	env.store.upsertCachedEventErr = nil
+	if err := env.syncer.RunFullSync(ctx); err != nil {
+		t.Fatalf("RunFullSync failed: %v", err)
+	}
+	for _, date := range []string{"2025-03-10", "2025-03-11"} {
+		if got := env.onlyEventOn(t, date); got.Id != dailyEventID(original.Id, testDate(date)) {
+			t.Errorf("event on %s = %s, want the daily event of the multi-day event", date, got.Id)
+		}
+		env.assertEntry(t, date, "V", "Vacation")
+	}
+	if len(checking.mutationsInTx) > 0 {
+		t.Errorf("the full sync modified the calendar inside a transaction: %v", checking.mutationsInTx)
+	}
+}
+
+func TestFullSyncOnlyFetchesTheWindow(t *testing.T) {
+	env := newSyncTestEnv(t, func(cfg *config.AppConfig) {
+		cfg.FullSync.WindowMarginDays = 1
+	})
+	ctx := context.Background()
+	past := env.insert(t, managedEvent("2025-01-01", "LIB"))
+	future := env.insert(t, managedEvent("2025-06-01", "LIB"))
+	margin := env.insert(t, managedEvent("2025-03-13", "LIB"))
+	oldTitle := "HOM"
+	env.store.UpsertCachedEvent(ctx, database.CachedEvent{
+		EventID: "old",
+		Date:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Title:   &oldTitle,
+	})
+
+	env.sync(t)
+
+	for _, id := range []string{past.Id, future.Id} {
+		if event, _ := env.store.GetCachedEventByID(ctx, id); event != nil {
+			t.Errorf("event %s outside the full sync window was cached", id)
+		}
+	}
+	if event, _ := env.store.GetCachedEventByID(ctx, margin.Id); event == nil {
+		t.Errorf("event %s in the margin of the full sync window wasn't cached", margin.Id)
+	}
+	if event, _ := env.store.GetCachedEventByID(ctx, "old"); event == nil {
+		t.Errorf("cached event outside the full sync window was deleted")
+	}
+
+	if err := env.syncer.RunArchiveSync(ctx); err != nil {
+		t.Fatalf("RunArchiveSync failed: %v", err)
+	}
+	for _, id := range []string{past.Id, future.Id} {
+		if event, _ := env.store.GetCachedEventByID(ctx, id); event == nil {
+			t.Errorf("event %s wasn't cached by the archive sync", id)
+		}
+	}
+	if event, _ := env.store.GetCachedEventByID(ctx, "old"); event != nil {
+		t.Errorf("the archive sync didn't delete a cached event which no longer exists")
+	}
+	env.assertEntry(t, "2025-01-01", "LIB", "Library")
+}
+
+func TestFullSyncProcessesPagesAndKeepsTheSyncToken(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.calendar.PageSize = 1
+	for _, date := range testWindow[:3] {
+		env.insert(t, managedEvent(date, "LIB"))
+	}
+
+	env.sync(t)
+	for _, date := range testWindow[:3] {
+		env.assertEntry(t, date, "LIB", "Library")
+	}
+
+	// The sync token of the last page lets the next sync be incremental.
+	env.setTitle(t, env.onlyEventOn(t, "2025-03-10").Id, "V")
+	token, _ := env.store.GetSyncState(context.Background(), "syncToken")
+	env.sync(t)
+	env.assertEntry(t, "2025-03-10", "V", "Vacation")
+	if newToken, _ := env.store.GetSyncState(context.Background(), "syncToken"); newToken == token {
+		t.Errorf("the sync token wasn't updated by the incremental sync")
+	}
+}
+
+// planKinds returns the kinds of the actions planned for each date.
+func planKinds(plan *ReconciliationPlan) map[string][]ActionKind {
+	kinds := make(map[string][]ActionKind)
+	for _, datePlan := range plan.Dates {
+		for _, action := range datePlan.Actions {
+			kinds[datePlan.Date] = append(kinds[datePlan.Date], action.Kind)
+		}
+	}
+	return kinds
+}
+
+func TestPlanReconciliationDoesNotModifyAnything(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	env.sync(t)
+	env.sync(t)
+
+	holidayDate, _ := time.Parse("2006-01-02", "2025-03-11")
+	env.store.holidays["2025-03-11"] = database.Holiday{Date: holidayDate, Name: "Test holiday"}
+	event := env.onlyEventOn(t, "2025-03-11")
+
+	plan, err := env.syncer.PlanReconciliation(context.Background(), []time.Time{holidayDate})
+	if err != nil {
+		t.Fatalf("PlanReconciliation failed: %v", err)
+	}
+
+	want := []ActionKind{ActionUpsertScheduleEntry, ActionReplaceSegments, ActionSetTitle, ActionSetColor}
+	if got := planKinds(plan)["2025-03-11"]; !slices.Equal(got, want) {
+		t.Errorf("planned actions = %v, want %v", got, want)
+	}
+	if got := plan.Dates[0].LocationChange; got != "HOM → H" {
+		t.Errorf("location change = %q, want HOM → H", got)
+	}
+	for _, action := range plan.Dates[0].Actions {
+		if action.Kind.isPatch() && action.EventID != event.Id {
+			t.Errorf("%s action targets event %q, want %q", action.Kind, action.EventID, event.Id)
+		}
+	}
+
+	env.assertEntry(t, "2025-03-11", "HOM", "Home")
+	if pending := env.store.pendingOutboxItems(); len(pending) != 0 {
+		t.Errorf("the plan recorded %d calendar mutations in the outbox", len(pending))
+	}
+	if got := env.onlyEventOn(t, "2025-03-11"); got.Summary != "HOM" {
+		t.Errorf("title = %q, want the event to be left untouched", got.Summary)
+	}
+}
+
+func TestPlanReconciliationDefaultsToTheSyncWindow(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+
+	plan, err := env.syncer.PlanReconciliation(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("PlanReconciliation failed: %v", err)
+	}
+
+	kinds := planKinds(plan)
+	want := []ActionKind{ActionUpsertScheduleEntry, ActionReplaceSegments, ActionCreateEvent}
+	for _, date := range testWindow {
+		if !slices.Equal(kinds[date], want) {
+			t.Errorf("planned actions for %s = %v, want %v", date, kinds[date], want)
+		}
+	}
+	if plan.NumActions() != len(testWindow)*len(want) {
+		t.Errorf("the plan has %d actions, want %d", plan.NumActions(), len(testWindow)*len(want))
+	}
+	if len(env.calendar.Events()) != 0 || len(env.store.entries) != 0 {
+		t.Errorf("the plan modified the calendar or the database")
+	}
+}
+
+func TestExecutedPlanPatchesEachEventOnce(t *testing.T) {
+	env := newSyncTestEnv(t, nil)
+	// The tagged event needs the property, the description and the color
+	// to be updated.
+	event := allDayEvent("2025-03-11", "V")
+	event.Description = "Add-To-ZenithPlanner: true"
+	created := env.insert(t, event)
+	env.sync(t)
+
+	var patches int
+	for _, item := range env.store.outbox {
+		if item.Operation == database.OutboxPatch && item.EventID == created.Id {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("the event was patched %d times, want the patches to be merged", patches)
+	}
+	got := env.onlyEventOn(t, "2025-03-11")
+	if !calendar.HasManagedProperty(got) || calendar.HasDescriptionTag(got) || got.ColorId != "10" {
+		t.Errorf("event = %+v, want it to be managed, with color 10 and without the tag", got)
+	}
+}
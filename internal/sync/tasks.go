@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"gomodules.avm99963.com/zenithplanner/internal/database"
+
 	"github.com/google/uuid"
 	gcal "google.golang.org/api/calendar/v3"
 )
@@ -22,23 +24,26 @@ const (
 func (s *Syncer) RunHorizonMaintenanceTask(ctx context.Context) error {
 	const logPrefix = "Horizon Maintenance Task:"
 	log.Println(logPrefix, "Waiting for lock...")
-	s.mutex.Lock()
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	}
 	log.Println(logPrefix, "Starting...")
-	defer s.mutex.Unlock()
+	defer unlock()
 	defer log.Println(logPrefix, "Finished.")
+	ctx = withSyncRun(ctx, database.TriggerHorizonMaintenance)
 
-	startDate := time.Now()
-	endDate := startDate.AddDate(0, 0, s.cfg.App.FutureHorizonDays)
-	datesToCheck := generateDateRange(startDate, endDate)
+	datesToCheck := s.horizonDates()
 
-	log.Printf("%s Checking %d dates from %s to %s",
+	log.Printf("%s Checking %d dates from %s to %s (%s)",
 		logPrefix,
 		len(datesToCheck),
-		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02"))
+		datesToCheck[0].Format("2006-01-02"),
+		datesToCheck[len(datesToCheck)-1].Format("2006-01-02"),
+		s.cfg.App.Timezone)
 
 	log.Printf("%s Triggering reconciliation for %d dates...", logPrefix, len(datesToCheck))
-	err := s.RunReconciliation(ctx, datesToCheck, false)
+	err = s.RunReconciliation(ctx, datesToCheck, false, nil)
 	if err != nil {
 		return fmt.Errorf("%s Error during reconciliation: %w", logPrefix, err)
 	}
@@ -49,6 +54,12 @@ func (s *Syncer) RunHorizonMaintenanceTask(ctx context.Context) error {
 // RunChannelRenewalTask performs the daily webhook channel renewal check.
 func (s *Syncer) RunChannelRenewalTask(ctx context.Context) error {
 	const logPrefix = "Channel Renewal Task:"
+	log.Println(logPrefix, "Waiting for lock...")
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("%s %w", logPrefix, err)
+	}
+	defer unlock()
 	log.Println(logPrefix, "Starting...")
 	defer log.Println(logPrefix, "Finished.") // Use defer for guaranteed finish log
 
@@ -56,17 +67,17 @@ func (s *Syncer) RunChannelRenewalTask(ctx context.Context) error {
 	if err != nil {
 		log.Printf("%s Error retrieving existing channel info: %v. Ensuring channel exists.", logPrefix, err)
 		// Fallback to ensure logic if retrieval failed or info is missing
-		return s.EnsureWebhookChannelExists(ctx)
+		return s.ensureWebhookChannelExists(ctx)
 	}
 
 	expirationTime, err := time.Parse(time.RFC3339Nano, expirationStr)
 	if err != nil {
 		log.Printf("%s Cannot parse stored expiration time '%s': %v. Ensuring channel exists.", logPrefix, expirationStr, err)
 		// If parsing fails, assume the stored data is bad, treat as missing
-		return s.EnsureWebhookChannelExists(ctx)
+		return s.ensureWebhookChannelExists(ctx)
 	}
 
-	renewalThreshold := time.Now().AddDate(0, 0, channelRenewalThresholdDays)
+	renewalThreshold := s.now().AddDate(0, 0, channelRenewalThresholdDays)
 	if !expirationTime.Before(renewalThreshold) {
 		log.Printf("%s Channel %s expiration (%s) is not within %d-day renewal threshold. No action needed.",
 			logPrefix, channelID, expirationTime.Format(time.RFC1123), channelRenewalThresholdDays)
@@ -95,6 +106,15 @@ func (s *Syncer) RunChannelRenewalTask(ctx context.Context) error {
 
 // EnsureWebhookChannelExists creates and stores info for a new webhook channel.
 func (s *Syncer) EnsureWebhookChannelExists(ctx context.Context) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.ensureWebhookChannelExists(ctx)
+}
+
+func (s *Syncer) ensureWebhookChannelExists(ctx context.Context) error {
 	logPrefix := "Ensure Webhook Channel Exists:"
 	newChannel, err := s.createCalendarWebhookChannel(ctx, logPrefix)
 	if err != nil {
@@ -135,15 +155,13 @@ func (s *Syncer) createCalendarWebhookChannel(ctx context.Context, logPrefix str
 	// Ensure trailing slash is removed before appending path
 	webhookURL := strings.TrimSuffix(s.cfg.App.BaseURL, "/") + "/webhook/calendar"
 
-	watchCall := s.calendarService.Events.Watch(s.cfg.Google.CalendarID, &gcal.Channel{
+	newChannel, err := s.calendarService.Watch(ctx, &gcal.Channel{
 		Id:      newChannelID,
 		Type:    "web_hook",
 		Address: webhookURL,
 		Token:   s.cfg.Google.WebhookVerificationToken,
 		// Params: // Add params if needed
 	})
-
-	newChannel, err := watchCall.Do()
 	if err != nil {
 		log.Printf("%s Failed API call to create webhook channel: %v", logPrefix, err)
 		return nil, fmt.Errorf("calendar API watch request failed: %w", err)
@@ -194,9 +212,7 @@ func (s *Syncer) stopCalendarWebhookChannel(ctx context.Context, channelID, reso
 	}
 
 	log.Printf("%s Attempting to stop channel via API: ID=%s, ResourceID=%s", logPrefix, channelID, resourceID)
-	stopCall := s.calendarService.Channels.Stop(&gcal.Channel{Id: channelID, ResourceId: resourceID})
-
-	err := stopCall.Do()
+	err := s.calendarService.StopChannel(ctx, &gcal.Channel{Id: channelID, ResourceId: resourceID})
 
 	if err == nil {
 		log.Printf("%s Successfully stopped channel %s.", logPrefix, channelID)
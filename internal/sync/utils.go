@@ -4,14 +4,43 @@ import (
 	"time"
 )
 
-// generateDateRange creates a slice of dates between start and end (inclusive).
+// dateIn returns the calendar date of the instant t in the given location.
+// Dates are represented across ZenithPlanner as midnight UTC of that
+// calendar date, which is how they are parsed from Google Calendar and
+// stored in the DB.
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// today returns the current date in the user's timezone.
+func (s *Syncer) today() time.Time {
+	return dateIn(s.now(), s.cfg.App.Timezone)
+}
+
+// horizonDates returns the dates from today until the end of the future
+// horizon (inclusive).
+func (s *Syncer) horizonDates() []time.Time {
+	today := s.today()
+	return generateDateRange(today, today.AddDate(0, 0, s.cfg.App.FutureHorizonDays))
+}
+
+// syncWindowDates returns the dates from the start of the past sync window
+// until the end of the future horizon (inclusive).
+func (s *Syncer) syncWindowDates() []time.Time {
+	today := s.today()
+	return generateDateRange(today.AddDate(0, 0, -s.cfg.App.PastSyncWindowDays), today.AddDate(0, 0, s.cfg.App.FutureHorizonDays))
+}
+
+// generateDateRange creates a slice of dates between start and end
+// (inclusive). Both are interpreted as calendar dates, ignoring their time
+// of day.
 func generateDateRange(start, end time.Time) []time.Time {
 	var dates []time.Time
-	current := start
-	// Normalize to start of day UTC for comparison
+	current := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
 	endNormalized := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
 	for !current.After(endNormalized) {
-		dates = append(dates, time.Date(current.Year(), current.Month(), current.Day(), 0, 0, 0, 0, time.UTC))
+		dates = append(dates, current)
 		current = current.AddDate(0, 0, 1)
 	}
 	return dates
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"gomodules.avm99963.com/zenithplanner/internal/config"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
+func newTestSyncerAt(t *testing.T, tz string, now time.Time) *Syncer {
+	t.Helper()
+	return &Syncer{
+		cfg: &config.Config{
+			App: config.AppConfig{
+				Timezone:           mustLoadLocation(t, tz),
+				FutureHorizonDays:  3,
+				PastSyncWindowDays: 2,
+			},
+		},
+		now: func() time.Time { return now },
+	}
+}
+
+func TestDateIn(t *testing.T) {
+	madrid := mustLoadLocation(t, "Europe/Madrid")
+	tests := []struct {
+		name string
+		t    time.Time
+		loc  *time.Location
+		want string
+	}{
+		{
+			name: "UTC evening is the next day in Madrid (CEST)",
+			t:    time.Date(2025, 6, 30, 22, 30, 0, 0, time.UTC),
+			loc:  madrid,
+			want: "2025-07-01",
+		},
+		{
+			name: "UTC evening is the next day in Madrid (CET)",
+			t:    time.Date(2025, 1, 31, 23, 30, 0, 0, time.UTC),
+			loc:  madrid,
+			want: "2025-02-01",
+		},
+		{
+			name: "UTC evening before the offset is still the same day in Madrid (CET)",
+			t:    time.Date(2025, 1, 31, 22, 30, 0, 0, time.UTC),
+			loc:  madrid,
+			want: "2025-01-31",
+		},
+		{
+			name: "Just before the spring forward transition",
+			t:    time.Date(2025, 3, 30, 1, 59, 0, 0, madrid),
+			loc:  madrid,
+			want: "2025-03-30",
+		},
+		{
+			name: "Just after the spring forward transition",
+			t:    time.Date(2025, 3, 30, 3, 0, 0, 0, madrid),
+			loc:  madrid,
+			want: "2025-03-30",
+		},
+		{
+			name: "Midnight after the spring forward day",
+			t:    time.Date(2025, 3, 30, 22, 0, 0, 0, time.UTC),
+			loc:  madrid,
+			want: "2025-03-31",
+		},
+		{
+			name: "Repeated hour during the fall back transition",
+			t:    time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC), // 02:30 CET, after the clocks went back
+			loc:  madrid,
+			want: "2025-10-26",
+		},
+		{
+			name: "Midnight after the fall back day",
+			t:    time.Date(2025, 10, 26, 23, 0, 0, 0, time.UTC),
+			loc:  madrid,
+			want: "2025-10-27",
+		},
+		{
+			name: "Timezone behind UTC",
+			t:    time.Date(2025, 3, 9, 4, 0, 0, 0, time.UTC),
+			loc:  mustLoadLocation(t, "America/New_York"),
+			want: "2025-03-08",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dateIn(tt.t, tt.loc)
+			if got.Format("2006-01-02") != tt.want {
+				t.Errorf("dateIn(%v, %s) = %s, want %s", tt.t, tt.loc, got.Format("2006-01-02"), tt.want)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 || got.Minute() != 0 {
+				t.Errorf("dateIn(%v, %s) = %v, want midnight UTC", tt.t, tt.loc, got)
+			}
+		})
+	}
+}
+
+func TestGenerateDateRangeAcrossDST(t *testing.T) {
+	madrid := mustLoadLocation(t, "Europe/Madrid")
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		want  []string
+	}{
+		{
+			name:  "Spring forward",
+			start: time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC),
+			want:  []string{"2025-03-29", "2025-03-30", "2025-03-31"},
+		},
+		{
+			name:  "Fall back",
+			start: time.Date(2025, 10, 25, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2025, 10, 27, 0, 0, 0, 0, time.UTC),
+			want:  []string{"2025-10-25", "2025-10-26", "2025-10-27"},
+		},
+		{
+			name:  "Local times with a time of day",
+			start: time.Date(2025, 10, 25, 23, 30, 0, 0, madrid),
+			end:   time.Date(2025, 10, 26, 0, 30, 0, 0, madrid),
+			want:  []string{"2025-10-25", "2025-10-26"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateDateRange(tt.start, tt.end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("generateDateRange() returned %d dates, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i, d := range got {
+				if d.Format("2006-01-02") != tt.want[i] {
+					t.Errorf("generateDateRange()[%d] = %s, want %s", i, d.Format("2006-01-02"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHorizonDatesUseUserTimezone(t *testing.T) {
+	// 23:30 UTC on the day the clocks go back is already the next day in
+	// Madrid, but still the same day in UTC.
+	now := time.Date(2025, 10, 26, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		tz          string
+		wantHorizon []string
+		wantWindow  []string
+	}{
+		{
+			tz:          "Europe/Madrid",
+			wantHorizon: []string{"2025-10-27", "2025-10-28", "2025-10-29", "2025-10-30"},
+			wantWindow:  []string{"2025-10-25", "2025-10-26", "2025-10-27", "2025-10-28", "2025-10-29", "2025-10-30"},
+		},
+		{
+			tz:          "UTC",
+			wantHorizon: []string{"2025-10-26", "2025-10-27", "2025-10-28", "2025-10-29"},
+			wantWindow:  []string{"2025-10-24", "2025-10-25", "2025-10-26", "2025-10-27", "2025-10-28", "2025-10-29"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tz, func(t *testing.T) {
+			s := newTestSyncerAt(t, tt.tz, now)
+			assertDates(t, "horizonDates()", s.horizonDates(), tt.wantHorizon)
+			assertDates(t, "syncWindowDates()", s.syncWindowDates(), tt.wantWindow)
+		})
+	}
+}
+
+func TestHorizonDatesAcrossSpringForward(t *testing.T) {
+	// 00:30 local time on the day the clocks go forward in Madrid.
+	s := newTestSyncerAt(t, "Europe/Madrid", time.Date(2025, 3, 29, 23, 30, 0, 0, time.UTC))
+	assertDates(t, "horizonDates()", s.horizonDates(), []string{"2025-03-30", "2025-03-31", "2025-04-01", "2025-04-02"})
+}
+
+func assertDates(t *testing.T, name string, got []time.Time, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s returned %d dates, want %d: %v", name, len(got), len(want), got)
+	}
+	for i, d := range got {
+		if d.Format("2006-01-02") != want[i] {
+			t.Errorf("%s[%d] = %s, want %s", name, i, d.Format("2006-01-02"), want[i])
+		}
+	}
+}